@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Aggregate holds the counters needed for the top-N report. It is filled
+// while the log is scanned, so GetTopIPs and GetTopLongRequests do not have
+// to re-read every LogEntry. First and Last are the earliest and the latest
+// timestamp counted. RTimes and PathRTimes hold the response-time statistics
+// per class and per request path (without query string). UAClassCount counts
+// the requests per User-Agent class (see classifyUserAgent), Seconds the
+// requests per second (Unix time), for the timeline of all requests.
+//
+// With MaxClasses > 0 the number of tracked classes is bounded: whenever the
+// limit is exceeded the least frequent half of the classes is dropped
+// (heavy-hitters pass). Counts of classes that survive a pruning may be too
+// low by at most ErrorBound; the top classes of a large log are not affected
+// in practice because they are never the ones being dropped. RTimes and
+// PathRTimes are bounded by MaxClasses as well, keeping the keys with the
+// highest total response time.
+type Aggregate struct {
+	Total        int
+	ClassCount   map[string]int
+	SourceCount  map[string]int
+	CodeCount    map[int]int
+	UAClassCount map[string]int
+	Seconds      map[int64]int
+	RTimeMax     map[string]float64
+	RTimes       map[string]*RTimeStats
+	PathRTimes   map[string]*RTimeStats
+	First        time.Time
+	Last         time.Time
+	MaxClasses   int
+	ErrorBound   int
+}
+
+// NewAggregate returns an empty Aggregate tracking at most maxClasses classes
+// (0 means unbounded).
+func NewAggregate(maxClasses int) *Aggregate {
+	return &Aggregate{
+		ClassCount:   make(map[string]int),
+		SourceCount:  make(map[string]int),
+		CodeCount:    make(map[int]int),
+		UAClassCount: make(map[string]int),
+		Seconds:      make(map[int64]int),
+		RTimeMax:     make(map[string]float64),
+		RTimes:       make(map[string]*RTimeStats),
+		PathRTimes:   make(map[string]*RTimeStats),
+		MaxClasses:   maxClasses,
+	}
+}
+
+// Add counts a single entry.
+func (a *Aggregate) Add(entry LogEntry) {
+	a.Total++
+	a.ClassCount[entry.Class]++
+	a.SourceCount[entry.Source]++
+	a.CodeCount[entry.Code]++
+	a.UAClassCount[entry.UAClass]++
+	if !entry.TimeStamp.IsZero() {
+		a.Seconds[entry.TimeStamp.Unix()]++
+	}
+	if rt, ok := rtimeSeconds(entry.RTime); ok {
+		if rt > a.RTimeMax[entry.Class] {
+			a.RTimeMax[entry.Class] = rt
+		}
+		addRTime(a.RTimes, entry.Class, rt)
+		addRTime(a.PathRTimes, requestPath(entry.Request), rt)
+		a.prunePaths()
+	}
+	a.extend(entry.TimeStamp, entry.TimeStamp)
+	if a.MaxClasses > 0 && len(a.ClassCount) > a.MaxClasses {
+		a.prune()
+	}
+}
+
+// Merge adds the counters of b to a.
+func (a *Aggregate) Merge(b *Aggregate) {
+	a.Total += b.Total
+	for class, count := range b.ClassCount {
+		a.ClassCount[class] += count
+	}
+	for source, count := range b.SourceCount {
+		a.SourceCount[source] += count
+	}
+	for code, count := range b.CodeCount {
+		a.CodeCount[code] += count
+	}
+	for class, count := range b.UAClassCount {
+		a.UAClassCount[class] += count
+	}
+	for second, count := range b.Seconds {
+		a.Seconds[second] += count
+	}
+	for class, rt := range b.RTimeMax {
+		if rt > a.RTimeMax[class] {
+			a.RTimeMax[class] = rt
+		}
+	}
+	mergeRTimes(a.RTimes, b.RTimes)
+	mergeRTimes(a.PathRTimes, b.PathRTimes)
+	a.prunePaths()
+	a.ErrorBound += b.ErrorBound
+	a.extend(b.First, b.Last)
+	if a.MaxClasses > 0 && len(a.ClassCount) > a.MaxClasses {
+		a.prune()
+	}
+}
+
+// extend widens the time span First to Last so it covers first to last.
+// Zero times are ignored.
+func (a *Aggregate) extend(first, last time.Time) {
+	if !first.IsZero() && (a.First.IsZero() || first.Before(a.First)) {
+		a.First = first
+	}
+	if !last.IsZero() && last.After(a.Last) {
+		a.Last = last
+	}
+}
+
+// ErrorNote returns a note on the class counts when classes were dropped by
+// pruning, or "" if the counts are exact.
+func (a *Aggregate) ErrorNote() string {
+	if a.ErrorBound == 0 {
+		return ""
+	}
+	return fmt.Sprintf("counts may be low by up to %d, more than MaxTrackedClasses (%d) classes were seen", a.ErrorBound, a.MaxClasses)
+}
+
+// prune drops the least frequent half of the tracked classes and raises
+// ErrorBound by the highest count that was dropped.
+func (a *Aggregate) prune() {
+	classes := sortedByCount(a.ClassCount)
+	keep := a.MaxClasses / 2
+	dropped := 0
+	for _, class := range classes[keep:] {
+		if a.ClassCount[class] > dropped {
+			dropped = a.ClassCount[class]
+		}
+		delete(a.ClassCount, class)
+	}
+	a.ErrorBound += dropped
+	// RTimeMax is ranked by response time, so it is bounded on its own
+	if len(a.RTimeMax) > a.MaxClasses {
+		for _, class := range sortedByRtime(a.RTimeMax)[keep:] {
+			delete(a.RTimeMax, class)
+		}
+	}
+	if len(a.RTimes) > a.MaxClasses {
+		pruneRTimes(a.RTimes, keep)
+	}
+}
+
+// prunePaths bounds PathRTimes, which grows independently of the classes.
+func (a *Aggregate) prunePaths() {
+	if a.MaxClasses > 0 && len(a.PathRTimes) > a.MaxClasses {
+		pruneRTimes(a.PathRTimes, a.MaxClasses/2)
+	}
+}
+
+// addRTime counts the response time rt for key in stats.
+func addRTime(stats map[string]*RTimeStats, key string, rt float64) {
+	s, ok := stats[key]
+	if !ok {
+		s = &RTimeStats{}
+		stats[key] = s
+	}
+	s.Add(rt)
+}
+
+// mergeRTimes adds the statistics of from to stats.
+func mergeRTimes(stats, from map[string]*RTimeStats) {
+	for key, o := range from {
+		s, ok := stats[key]
+		if !ok {
+			s = &RTimeStats{}
+			stats[key] = s
+		}
+		s.Merge(o)
+	}
+}
+
+// rtimeSeconds converts a raw RTime value to seconds using
+// config.LogFormat.RTime.Unit (falling back to milliseconds when the unit is
+// not set). ok is false for empty or non-numeric values.
+func rtimeSeconds(raw string) (seconds float64, ok bool) {
+	if raw == "" {
+		return 0, false
+	}
+	rt, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false
+	}
+	unit := float64(config.LogFormat.RTime.Unit)
+	if unit == 0 {
+		unit = 1000
+	}
+	return rt / unit, true
+}
+
+// sortedByCount returns the keys of counts ordered by descending count.
+// Ties are ordered by key so the result is deterministic.
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// sortedByRtime returns the keys of rtimes ordered by descending value.
+func sortedByRtime(rtimes map[string]float64) []string {
+	keys := make([]string, 0, len(rtimes))
+	for key := range rtimes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if rtimes[keys[i]] != rtimes[keys[j]] {
+			return rtimes[keys[i]] > rtimes[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// topN returns the n entries of counts with the highest count (all of them
+// when n <= 0).
+func topN(counts map[string]int, n int) map[string]int {
+	top := make(map[string]int)
+	keys := sortedByCount(counts)
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	for _, key := range keys {
+		top[key] = counts[key]
+	}
+	return top
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// Aggregate
+// ──────────────────────────────────────────────
+
+func TestAggregateAdd(t *testing.T) {
+	setupTestGlobals()
+
+	agg := NewAggregate(0)
+	agg.Add(LogEntry{Class: "1.1.1.1", Code: 200, RTime: "1500"})
+	agg.Add(LogEntry{Class: "1.1.1.1", Code: 404, RTime: "500"})
+	agg.Add(LogEntry{Class: "2.2.2.2", Code: 200})
+
+	if agg.Total != 3 {
+		t.Errorf("Total: got %d, want 3", agg.Total)
+	}
+	if agg.ClassCount["1.1.1.1"] != 2 {
+		t.Errorf("1.1.1.1 count: got %d, want 2", agg.ClassCount["1.1.1.1"])
+	}
+	if agg.CodeCount[200] != 2 {
+		t.Errorf("code 200 count: got %d, want 2", agg.CodeCount[200])
+	}
+	if agg.RTimeMax["1.1.1.1"] != 1.5 {
+		t.Errorf("1.1.1.1 max rtime: got %v, want 1.5", agg.RTimeMax["1.1.1.1"])
+	}
+	if _, ok := agg.RTimeMax["2.2.2.2"]; ok {
+		t.Error("2.2.2.2 without RTime should not have a max rtime")
+	}
+}
+
+func TestAggregateMerge(t *testing.T) {
+	setupTestGlobals()
+
+	a := NewAggregate(0)
+	a.Add(LogEntry{Class: "1.1.1.1", Code: 200, RTime: "1000"})
+	b := NewAggregate(0)
+	b.Add(LogEntry{Class: "1.1.1.1", Code: 200, RTime: "3000"})
+	b.Add(LogEntry{Class: "2.2.2.2", Code: 500})
+
+	a.Merge(b)
+
+	if a.Total != 3 {
+		t.Errorf("Total: got %d, want 3", a.Total)
+	}
+	if a.ClassCount["1.1.1.1"] != 2 || a.ClassCount["2.2.2.2"] != 1 {
+		t.Errorf("ClassCount: got %v", a.ClassCount)
+	}
+	if a.CodeCount[200] != 2 || a.CodeCount[500] != 1 {
+		t.Errorf("CodeCount: got %v", a.CodeCount)
+	}
+	if a.RTimeMax["1.1.1.1"] != 3.0 {
+		t.Errorf("1.1.1.1 max rtime: got %v, want 3.0", a.RTimeMax["1.1.1.1"])
+	}
+}
+
+func TestAggregateTimeSpan(t *testing.T) {
+	setupTestGlobals()
+
+	t0 := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	a := NewAggregate(0)
+	a.Add(LogEntry{Class: "1.1.1.1", TimeStamp: t0.Add(time.Minute)})
+	a.Add(LogEntry{Class: "1.1.1.1"}) // unparsable timestamp
+	b := NewAggregate(0)
+	b.Add(LogEntry{Class: "2.2.2.2", TimeStamp: t0.Add(5 * time.Minute)})
+	b.Add(LogEntry{Class: "2.2.2.2", TimeStamp: t0})
+
+	a.Merge(b)
+
+	if !a.First.Equal(t0) || !a.Last.Equal(t0.Add(5*time.Minute)) {
+		t.Errorf("got %v - %v", a.First, a.Last)
+	}
+}
+
+func TestAggregatePruneKeepsHeavyHitters(t *testing.T) {
+	setupTestGlobals()
+
+	agg := NewAggregate(10)
+	for i := 0; i < 1000; i++ {
+		agg.Add(LogEntry{Class: "1.1.1.1", Code: 200})
+		agg.Add(LogEntry{Class: fmt.Sprintf("10.0.%d.%d", i/256, i%256), Code: 200})
+		if i%2 == 0 {
+			agg.Add(LogEntry{Class: "2.2.2.2", Code: 200})
+		}
+	}
+
+	if len(agg.ClassCount) > 10 {
+		t.Errorf("tracked classes: got %d, want <= 10", len(agg.ClassCount))
+	}
+	if agg.ClassCount["1.1.1.1"] != 1000 {
+		t.Errorf("1.1.1.1 count: got %d, want 1000", agg.ClassCount["1.1.1.1"])
+	}
+	if agg.ClassCount["2.2.2.2"] != 500 {
+		t.Errorf("2.2.2.2 count: got %d, want 500", agg.ClassCount["2.2.2.2"])
+	}
+	if agg.ErrorBound == 0 {
+		t.Error("ErrorBound should be raised after pruning")
+	}
+	if want := fmt.Sprintf("counts may be low by up to %d, more than MaxTrackedClasses (10) classes were seen", agg.ErrorBound); agg.ErrorNote() != want {
+		t.Errorf("ErrorNote: got %q, want %q", agg.ErrorNote(), want)
+	}
+	if NewAggregate(10).ErrorNote() != "" {
+		t.Error("ErrorNote should be empty without pruning")
+	}
+	if agg.Total != 2500 {
+		t.Errorf("Total: got %d, want 2500", agg.Total)
+	}
+}
+
+func TestTopN(t *testing.T) {
+	counts := map[string]int{"a": 3, "b": 5, "c": 1, "d": 5}
+
+	top := topN(counts, 2)
+	if len(top) != 2 || top["b"] != 5 || top["d"] != 5 {
+		t.Errorf("topN(2): got %v", top)
+	}
+	if all := topN(counts, 0); len(all) != 4 {
+		t.Errorf("topN(0): got %d entries, want 4", len(all))
+	}
+}
+
+func TestSortedByCountTiesAreDeterministic(t *testing.T) {
+	got := sortedByCount(map[string]int{"b": 1, "a": 1, "c": 2})
+	want := []string{"c", "a", "b"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
+	"net/netip"
 	"os"
 	"sort"
 	"strconv"
@@ -12,6 +14,9 @@ import (
 )
 
 // LogEntry represents a single parsed line from a web server log file.
+// filtered is set by the parser for lines that are no entries of the log,
+// e.g. syslog messages of other programs (see EnvelopeConfig). reject is the
+// reason why a malformed line is not counted (see Rejects).
 type LogEntry struct {
 	IP        string
 	Class     string
@@ -21,19 +26,54 @@ type LogEntry struct {
 	Code      int
 	RTime     string
 	UserAgent string
+	UAClass   string
+	Referer   string
+	VHost     string
+	Source    string
+	filtered  bool
+	reject    string
 }
 
 // Log2Analyze holds the state for a log analysis session, including the parsed
-// entries, time window, and metadata about the file being analysed.
+// entries, time window, and metadata about the files being analysed.
+//
+// FileNames lists the files of the analysis; if it is empty FileName is the
+// only one.
+//
+// IPFilter and NotIPFilter (-i and -ni) restrict the analysis to, or exclude,
+// the entries whose IP lies in one of their networks; nil disables them.
+// UAClasses (-ua-class) filters the entries by the class of their User-Agent.
+//
+// While scanning, the counters for the report are kept in Agg. The matching
+// entries themselves are kept in Entries until config.MaxEntriesInMemory (or
+// maxEntries, see entryLimit) is reached. Beyond that the files are read a
+// second time, once the top classes are known, and only their entries are
+// retained (see retainTop); keep then holds these classes. Entries that still
+// exceed the limit, or that cannot be read again (standard input and pipes),
+// are spilled to a temporary file, which is removed by Close.
+//
+// Malformed lines are not counted but in Rejects (nil if there are none).
 type Log2Analyze struct {
 	FileName     string
+	FileNames    []string
 	DateLayout   string
 	StartTime    time.Time
 	EndTime      time.Time
 	Date2analyze string
 	QueryString  string
+	IPFilter     *ipFilter
+	NotIPFilter  *ipFilter
+	UAClasses    *uaClassFilter
 	Entries      []LogEntry
 	EntryCount   int
+	LinesRead    int
+	Agg          *Aggregate
+	Rejects      *Rejects
+	maxEntries   int
+	spill        *entrySpill
+	keep         map[string]bool // retain only the entries of these classes
+	rescan       bool            // drop the entries beyond the entryLimit, see retainTop
+	overflow     bool            // entries were dropped
 }
 
 // safeGet returns parts[i] or "" when i is out of range.
@@ -44,35 +84,126 @@ func safeGet(parts []string, i int) string {
 	return ""
 }
 
+// invalidClass is the class of entries whose IP field is not a valid address.
+const invalidClass = "invalid"
+
+// ipClassPresets maps the -k classes A to D to the prefix lengths used for
+// IPv4 and IPv6 addresses.
+var ipClassPresets = map[string][2]int{
+	"A": {8, 32},
+	"B": {16, 48},
+	"C": {24, 64},
+	"D": {32, 128},
+}
+
+// ipClassBits are the IPv4 and IPv6 prefix lengths of -k, set once by main
+// with applyIPClass.
+var ipClassBits = ipClassPresets["D"]
+
+// parseIPClass returns the IPv4 and IPv6 prefix lengths of the -k value
+// class: one of the presets A to D, a single prefix length for the family it
+// fits ("/24" for IPv4, "/48" for IPv6; the other family keeps the full
+// address) or an IPv4 and an IPv6 length separated by a comma ("/24,/48").
+func parseIPClass(class string) (v4, v6 int, err error) {
+	if bits, ok := ipClassPresets[class]; ok {
+		return bits[0], bits[1], nil
+	}
+	lengths := strings.Split(class, ",")
+	if len(lengths) > 2 {
+		return 0, 0, fmt.Errorf("invalid IP class %q, use A, B, C, D, /len or /len4,/len6", class)
+	}
+	var bits [2]int
+	for i, length := range lengths {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(length), "/"))
+		if err != nil || n < 0 || n > 128 || (i == 0 && len(lengths) == 2 && n > 32) {
+			return 0, 0, fmt.Errorf("invalid IP class %q, use A, B, C, D, /len or /len4,/len6", class)
+		}
+		bits[i] = n
+	}
+	switch {
+	case len(lengths) == 2:
+		return bits[0], bits[1], nil
+	case bits[0] > 32:
+		return 32, bits[0], nil
+	default:
+		return bits[0], 128, nil
+	}
+}
+
+// applyIPClass parses the -k value and sets ipClassBits.
+func applyIPClass() error {
+	v4, v6, err := parseIPClass(*IPclass)
+	if err != nil {
+		return err
+	}
+	ipClassBits = [2]int{v4, v6}
+	return nil
+}
+
 // ipToClass derives the aggregation class from a raw IP string according to
-// the -k flag (A/B/C/D). Non-IPv4 addresses are returned unchanged.
+// the -k flag: the network of the configured prefix length in CIDR notation
+// (e.g. 10.20.30.0/24 or 2001:db8::/48), or the address itself when the
+// prefix covers the full address. Malformed addresses are grouped under
+// invalidClass.
 func ipToClass(ip string) string {
-	p := strings.Split(ip, ".")
-	if len(p) != 4 {
-		return ip
+	addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+	if err != nil {
+		return invalidClass
 	}
-	switch *IPclass {
-	case "A":
-		return p[0]
-	case "B":
-		return p[0] + "." + p[1]
-	case "C":
-		return p[0] + "." + p[1] + "." + p[2]
-	default: // "D" and anything else
-		return ip
+	addr = addr.Unmap().WithZone("")
+	bits := ipClassBits[1]
+	if addr.Is4() {
+		bits = ipClassBits[0]
 	}
+	if bits >= addr.BitLen() {
+		return addr.String()
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.String()
+}
+
+// parseGeneric returns the main fields of a log line parsed by
+// parseGenericEntry: ip, class, timestamp, method, request, code, rtime and
+// user agent.
+func parseGeneric(line string) (string, string, time.Time, string, string, int, string, string) {
+	e := parseGenericEntry(line)
+	return e.IP, e.Class, e.TimeStamp, e.Method, e.Request, e.Code, e.RTime, e.UserAgent
 }
 
-// parseGeneric tokenizes a log line (quote removal + space split) and extracts
-// all fields using the positions defined in config.LogFormat.
+// parseGenericEntry parses a log line by the compiled log format (a Format,
+// a Pattern, a structured log type or an envelope, see
+// ApplicationConfig.compileFormat), or else by the positions defined in
+// config.LogFormat (see parsePositions). A line without a valid timestamp
+// is rejected, unless it was already rejected for too few fields.
+func parseGenericEntry(line string) LogEntry {
+	var entry LogEntry
+	if config.LogFormat.compiled != nil {
+		entry = config.LogFormat.compiled.parse(line)
+	} else {
+		entry = parsePositions(config.LogFormat, line)
+	}
+	if !entry.filtered && entry.reject != rejectFields && entry.TimeStamp.IsZero() {
+		entry.reject = rejectTimestamp
+	}
+	return entry
+}
+
+// parsePositions tokenizes a log line (quote removal + space split) and
+// extracts all fields using the positions defined in lf.
 //
 // Tokenization: strings.Replace(line, `"`, "", -1)  →  strings.Split(" ")
 //
 // The timestamp always spans two consecutive tokens (lf.TimeStamp and
 // lf.TimeStamp+1); square brackets are stripped before parsing.
-func parseGeneric(line string) (string, string, time.Time, string, string, int, string, string) {
-	lf := config.LogFormat
+//
+// A line that ends before the IP, the timestamp or the code is rejected for
+// too few fields, an invalid code for the code.
+func parsePositions(lf LogFormatConfig, line string) LogEntry {
 	parts := strings.Split(strings.Replace(line, `"`, "", -1), " ")
+	var reject string
+	if len(parts) <= max(lf.IP, lf.TimeStamp, lf.Code) {
+		reject = rejectFields
+	}
 
 	// IP with optional fallback and optional port stripping
 	ip := safeGet(parts, lf.IP)
@@ -90,8 +221,6 @@ func parseGeneric(line string) (string, string, time.Time, string, string, int,
 	// are detected automatically: if ts1 already ends with "]" after "[" removal
 	// the second token is not used.
 	ts1 := strings.Replace(safeGet(parts, lf.TimeStamp), "[", "", 1)
-	var timestamp time.Time
-	var err error
 	var tsStr string
 	if strings.HasSuffix(ts1, "]") {
 		tsStr = strings.TrimSuffix(ts1, "]")
@@ -99,23 +228,19 @@ func parseGeneric(line string) (string, string, time.Time, string, string, int,
 		ts2 := strings.Replace(safeGet(parts, lf.TimeStamp+1), "]", "", 1)
 		tsStr = ts1 + " " + ts2
 	}
-	timestamp, err = time.Parse(log2Analyze.DateLayout, tsStr)
-	if err != nil {
-		LogIt.Error("Error parsing timestamp: " + tsStr + " with layout " + log2Analyze.DateLayout)
-		LogIt.Error("Error: " + err.Error())
-	}
+	timestamp := parseLogTime(tsStr, log2Analyze.DateLayout)
 
 	// Method and Request
 	method := safeGet(parts, lf.Method)
 	request := safeGet(parts, lf.Request)
 
 	// Response code
-	codeStr := safeGet(parts, lf.Code)
-	code, err := strconv.Atoi(codeStr)
-	if err != nil {
-		LogIt.Error("Error parsing code (maybe hacking?): " + codeStr)
-		LogIt.Error(line)
-		code = 0
+	var code int
+	if lf.Code >= 0 {
+		var ok bool
+		if code, ok = parseCode(safeGet(parts, lf.Code), line); !ok && reject == "" {
+			reject = rejectCode
+		}
 	}
 
 	// Response time (only when Unit > 0)
@@ -130,113 +255,471 @@ func parseGeneric(line string) (string, string, time.Time, string, string, int,
 		userAgent = strings.Join(parts[lf.UserAgent:], " ")
 	}
 
-	class := ipToClass(ip)
-	return ip, class, timestamp, method, request, code, rtime, userAgent
+	referer, vhost := "", ""
+	if lf.Referer >= 0 {
+		referer = safeGet(parts, lf.Referer)
+	}
+	if lf.VHost >= 0 {
+		vhost = safeGet(parts, lf.VHost)
+	}
+
+	return LogEntry{
+		IP:        ip,
+		Class:     ipToClass(ip),
+		TimeStamp: timestamp,
+		Method:    method,
+		Request:   request,
+		Code:      code,
+		RTime:     rtime,
+		UserAgent: userAgent,
+		Referer:   referer,
+		VHost:     vhost,
+		reject:    reject,
+	}
 }
 
-// RetrieveEntries reads the log file and populates l.Entries with all log
+// parseLogTime parses the timestamp of a log line with layout. Errors are
+// logged at debug level and give the zero time.
+func parseLogTime(value, layout string) time.Time {
+	timestamp, err := time.Parse(layout, value)
+	if err != nil {
+		LogIt.Debug("Error parsing timestamp: " + value + " with layout " + layout + ": " + err.Error())
+	}
+	return timestamp
+}
+
+// parseCode parses the response code of a log line. Errors are logged at
+// debug level and give 0 and false.
+func parseCode(value, line string) (int, bool) {
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		LogIt.Debug("Error parsing code (maybe hacking?): " + value + " in line: " + line)
+		return 0, false
+	}
+	return code, true
+}
+
+// RetrieveEntries reads the log files and populates l.Entries with all log
 // entries that match the current filter criteria (time range, IP, response code,
-// query string). If timerange is 0 the entire file is scanned.
+// query string). If timerange is 0 the entire files are scanned. The entries
+// of all files are merged into one analysis; each entry records its file in
+// Source.
+//
+// Files compressed with gzip, bzip2 or zstd are detected by their magic bytes
+// and decompressed on the fly. The file name "-" reads standard input; like
+// named pipes it is read sequentially, without seeking.
+//
+// With a time range and config.SeekTimeWindow set, a log file whose sampled
+// timestamps are in order (see timeOrdered) is read from an offset found by
+// binary search just before StartTime, and reading stops once a timestamp is
+// later than EndTime plus config.SeekTolerance. Other logs, and input that
+// cannot be sampled (compressed files, pipes), are read in full.
 func (l *Log2Analyze) RetrieveEntries(endtime string, timerange int) {
-	file, err := os.Open(l.FileName)
+	if l.StartTime.IsZero() {
+		LogIt.Debug("l.StartTime is zero, setting Start and End Time")
+		l.StartTime, l.EndTime = createTimeRange(endtime, timerange, l.Date2analyze)
+		LogIt.Debug("Start Time: " + l.StartTime.Format(log2Analyze.DateLayout))
+		LogIt.Debug("End Time: " + l.EndTime.Format(log2Analyze.DateLayout))
+	}
+
+	l.rescan = l.keep == nil && canReread(l.files())
+	var last time.Time
+	for _, name := range l.files() {
+		if fileLast := l.retrieveFile(name, timerange); fileLast.After(last) {
+			last = fileLast
+		}
+	}
+	if timerange == 0 {
+		l.EndTime = last
+	}
+	if l.overflow {
+		l.retainTop(timerange)
+	}
+	l.EntryCount = l.aggregate().Total
+	LogIt.Info("checked " + fmt.Sprintf("%d", l.LinesRead) + " lines")
+	LogIt.Info("found Entries within timerange: " + fmt.Sprintf("%v", l.EntryCount))
+}
+
+// files returns the names of the files to analyze.
+func (l Log2Analyze) files() []string {
+	if len(l.FileNames) > 0 {
+		return l.FileNames
+	}
+	return []string{l.FileName}
+}
+
+// retrieveFile reads a single log file into l and returns the timestamp of
+// the last line read.
+func (l *Log2Analyze) retrieveFile(name string, timerange int) time.Time {
+	file, err := openLogFile(name)
 	if err != nil {
-		LogIt.Debug("Error opening file: " + l.FileName)
-		fmt.Println("Error opening file: " + l.FileName)
+		LogIt.Debug("Error opening file: " + name)
+		fmt.Println("Error opening file: " + name)
 		log.Fatal(err)
 	}
 	defer func() {
-		if err := file.Close(); err != nil {
-			LogIt.Debug("Error closing file: " + l.FileName)
+		if err := closeLogFile(file); err != nil {
+			LogIt.Debug("Error closing file: " + name)
 		}
 	}()
 
-	scanner := bufio.NewScanner(file)
-	c := 0
-	cl := 0
+	seek := timerange != 0 && config.SeekTimeWindow
+	var offset, size int64
+	var src io.Reader = file
+	info, err := file.Stat()
+	seekable := err == nil && info.Mode().IsRegular()
+	var format string
+	if seekable {
+		format = detectCompression(file)
+	} else {
+		// pipes and standard input can only be read once, from the start
+		var r io.Reader = file
+		if file == os.Stdin {
+			r = stdinReader()
+		}
+		buffered := bufio.NewReader(r)
+		format = peekCompression(buffered)
+		src = buffered
+	}
+	if format != "" {
+		LogIt.Info(name + " is " + format + " compressed")
+		dec, err := decompress(format, src)
+		if err != nil {
+			fmt.Println("Error decompressing file: " + name)
+			log.Fatal(err)
+		}
+		defer dec.Close()
+		src = dec
+		// compressed data can neither be seeked nor split into chunks
+		seekable = false
+	}
+	if seekable {
+		size = info.Size()
+	}
+	if seek && seekable && timeOrdered(file, size) {
+		offset = seekOffset(file, size, l.StartTime.Add(-config.SeekTolerance))
+		LogIt.Debug("seeking to offset " + fmt.Sprint(offset) + " of " + fmt.Sprint(size))
+	} else if seek {
+		LogIt.Info(name + " cannot be checked for time order or is not time-ordered, reading all of it")
+		seek = false
+	}
+
+	var last time.Time
+	if workers := parallelWorkers(size - offset); seekable && workers > 1 {
+		LogIt.Debug("parsing with " + fmt.Sprint(workers) + " workers")
+		last = l.retrieveParallel(file, name, offset, size, timerange, seek, workers)
+	} else {
+		if offset > 0 {
+			if _, err := file.Seek(offset, io.SeekStart); err != nil {
+				log.Fatal(err)
+			}
+		}
+		var lines int
+		lines, last, _, err = l.scan(src, name, timerange, seek, l.collect)
+		l.LinesRead += lines
+		if err != nil {
+			fmt.Println("Error reading from file:", err)
+		}
+	}
+	return last
+}
+
+// scan reads the lines of r and hands every entry that matches the filters
+// to collect, with Source set to source. It returns the number of lines read and the timestamp of the
+// last line. With stopAfterEnd, reading stops at the first line later than
+// EndTime plus config.SeekTolerance, and stopped is true.
+// Malformed lines are added to l.Rejects instead, which is created if it is
+// nil. Apart from that scan does not modify l; retrieveParallel creates the
+// Rejects of every worker before it starts, so scans of different parts may
+// run concurrently.
+func (l *Log2Analyze) scan(r io.Reader, source string, timerange int, stopAfterEnd bool, collect func(LogEntry)) (lines int, last time.Time, stopped bool, err error) {
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
+		lines++
 		line := scanner.Text()
-		cl++
 		entry := createEntry(line)
-		// StartTime is zero if this is the first entry
-		if l.StartTime.IsZero() {
-			LogIt.Debug("l.StartTime is zero, setting Start and End Time")
-			l.StartTime, l.EndTime = createTimeRange(endtime, timerange, l.Date2analyze)
-			LogIt.Debug("Start Time: " + l.StartTime.Format(log2Analyze.DateLayout))
-			LogIt.Debug("End Time: " + l.EndTime.Format(log2Analyze.DateLayout))
+		if entry.filtered {
+			continue
 		}
-		// check to avoid crash
-		entryIP := ""
-		if len(entry.IP) < len(*ipAddress) {
-			entryIP = entry.IP
-		} else {
-			entryIP = entry.IP[0:len(*ipAddress)]
+		if entry.reject != "" {
+			if l.Rejects == nil {
+				l.Rejects = newRejects()
+			}
+			l.Rejects.Add(entry.reject, line)
+			continue
 		}
-		entryNIP := ""
-		if len(entry.IP) < len(*notIP) {
-			entryNIP = entry.IP
-		} else {
-			entryNIP = entry.IP[0:len(*notIP)]
+		entry.Source = source
+		if stopAfterEnd && entry.TimeStamp.After(l.EndTime.Add(config.SeekTolerance)) {
+			LogIt.Debug("passed End Time at " + entry.TimeStamp.Format(l.DateLayout) + ", stop reading")
+			return lines, last, true, nil
+		}
+		if l.matches(entry, timerange) {
+			collect(entry)
+		}
+		last = entry.TimeStamp
+	}
+	return lines, last, false, scanner.Err()
+}
+
+// matches reports whether entry passes the current filter criteria (time
+// range, IP, response code, query string).
+func (l *Log2Analyze) matches(entry LogEntry, timerange int) bool {
+	return (timerange == 0 || entry.Between(l.StartTime, l.EndTime)) &&
+		(l.IPFilter == nil || l.IPFilter.Contains(entry.IP)) &&
+		(l.NotIPFilter == nil || !l.NotIPFilter.Contains(entry.IP)) &&
+		l.UAClasses.Matches(entry.UAClass) &&
+		(*responseCode == 0 || entry.Code == *responseCode) &&
+		(*noResponseCode == 0 || entry.Code != *noResponseCode) &&
+		(strings.Contains(entry.Request, l.QueryString) || l.QueryString == "")
+}
+
+// collect counts entry in l.Agg and retains it for the detail output. The
+// second pass of retainTop (keep is set) only retains it.
+func (l *Log2Analyze) collect(entry LogEntry) {
+	if l.keep != nil {
+		l.retain(entry)
+		return
+	}
+	if l.Agg == nil {
+		l.Agg = NewAggregate(config.MaxTrackedClasses)
+	}
+	l.Agg.Add(entry)
+	l.retain(entry)
+}
+
+// entryLimit returns the number of entries l keeps in memory before spilling
+// them: maxEntries if it is set, else config.MaxEntriesInMemory. 0 means
+// unbounded.
+func (l *Log2Analyze) entryLimit() int {
+	if l.maxEntries > 0 {
+		return l.maxEntries
+	}
+	return config.MaxEntriesInMemory
+}
+
+// retain keeps entry for the detail output, either in l.Entries or, once
+// the entryLimit is exceeded, in the spill file. With rescan set the entries
+// are dropped instead, to be read again by retainTop; with keep set only the
+// entries of its classes are kept.
+func (l *Log2Analyze) retain(entry LogEntry) {
+	if l.overflow || l.keep != nil && !l.keep[entry.Class] {
+		return
+	}
+	if limit := l.entryLimit(); l.spill == nil && (limit <= 0 || len(l.Entries) < limit) {
+		l.Entries = append(l.Entries, entry)
+		return
+	}
+	if l.rescan {
+		l.dropEntries()
+		return
+	}
+	if l.spill == nil {
+		spill, err := newEntrySpill()
+		if err != nil {
+			log.Fatal(err)
 		}
-		if (timerange == 0 || entry.Between(l.StartTime, l.EndTime)) &&
-			(*ipAddress == "" || entryIP == *ipAddress) &&
-			(*notIP == "" || entryNIP != *notIP) &&
-			(*responseCode == 0 || entry.Code == *responseCode) &&
-			(*noResponseCode == 0 || entry.Code != *noResponseCode) {
-			if strings.Contains(entry.Request, l.QueryString) || l.QueryString == "" {
-				l.Entries = append(l.Entries, entry)
-				c++
+		LogIt.Info("more than " + fmt.Sprint(l.entryLimit()) + " entries, spilling to " + spill.file.Name())
+		for _, e := range l.Entries {
+			if err := spill.Write(e); err != nil {
+				log.Fatal(err)
 			}
 		}
-		if timerange == 0 {
-			l.EndTime = entry.TimeStamp
+		l.Entries = nil
+		l.spill = spill
+	}
+	if err := l.spill.Write(entry); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// dropEntries discards the retained entries once they exceed the entryLimit.
+func (l *Log2Analyze) dropEntries() {
+	if !l.overflow {
+		LogIt.Info("more than " + fmt.Sprint(l.entryLimit()) + " entries, the entries of the top classes are read again after the scan")
+	}
+	l.Entries = nil
+	l.overflow = true
+}
+
+// retainTop reads the files of l a second time and retains the entries of
+// the classes shown in detail: the top classes by count and by response
+// time. The counters of the first pass are kept as they are.
+func (l *Log2Analyze) retainTop(timerange int) {
+	keep := make(map[string]bool)
+	topIPs, _ := l.GetTopIPs()
+	for class := range topIPs {
+		keep[class] = true
+	}
+	for class := range l.GetTopLongRequests() {
+		keep[class] = true
+	}
+	LogIt.Info("reading the entries of " + fmt.Sprint(len(keep)) + " top classes")
+	pass := &Log2Analyze{
+		DateLayout:  l.DateLayout,
+		StartTime:   l.StartTime,
+		EndTime:     l.EndTime,
+		QueryString: l.QueryString,
+		IPFilter:    l.IPFilter,
+		NotIPFilter: l.NotIPFilter,
+		UAClasses:   l.UAClasses,
+		maxEntries:  l.maxEntries,
+		keep:        keep,
+	}
+	for _, name := range l.files() {
+		pass.retrieveFile(name, timerange)
+	}
+	// the malformed lines were counted by the first pass
+	pass.Rejects.Close()
+	l.Entries, l.spill, l.keep, l.overflow = pass.Entries, pass.spill, keep, false
+}
+
+// aggregate returns l.Agg, or builds the counters from l.Entries when the
+// entries were not collected by RetrieveEntries.
+func (l Log2Analyze) aggregate() *Aggregate {
+	if l.Agg != nil {
+		return l.Agg
+	}
+	agg := NewAggregate(0)
+	for _, entry := range l.Entries {
+		agg.Add(entry)
+	}
+	return agg
+}
+
+// EachEntry calls fn for every retained entry, in log order, regardless of
+// whether it is held in memory or in the spill file.
+func (l Log2Analyze) EachEntry(fn func(LogEntry)) {
+	if l.spill != nil {
+		if err := l.spill.Each(fn); err != nil {
+			log.Fatal(err)
 		}
+		return
 	}
-	l.EntryCount = len(l.Entries)
-	LogIt.Info("checked " + fmt.Sprintf("%d", cl) + " lines")
-	LogIt.Info("found Entries within timerange: " + fmt.Sprintf("%v", l.EntryCount))
-	LogIt.Debug(" counter says: " + fmt.Sprintf("%d", c))
+	for _, entry := range l.Entries {
+		fn(entry)
+	}
+}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Println("Error reading from file:", err)
+// Close releases the spill file, if one was created.
+func (l *Log2Analyze) Close() {
+	if l.spill != nil {
+		if err := l.spill.Close(); err != nil {
+			LogIt.Debug("Error removing spill file: " + err.Error())
+		}
+		l.spill = nil
+	}
+	if err := l.Rejects.Close(); err != nil {
+		LogIt.Debug("Error removing reject bucket: " + err.Error())
 	}
 }
 
 // GetTopIPs returns the top N IP classes by request count along with a map of
 // HTTP status code frequencies. N is controlled by the -n flag (topIPsCount).
 func (l Log2Analyze) GetTopIPs() (map[string]int, map[int]int) {
-	ipCount := make(map[string]int)
-	codeCount := make(map[int]int)
-	for _, record := range l.Entries {
-		ipCount[record.Class]++
-		codeCount[record.Code]++
+	agg := l.aggregate()
+	return topN(agg.ClassCount, *topIPsCount), agg.CodeCount
+}
+
+// classFileName returns class in a form usable in a file name: characters
+// other than letters, digits, ".", ":" and "-" are replaced by "_" (the CIDR
+// 10.20.30.0/24 becomes 10.20.30.0_24, the path /api/v1 _api_v1), and long
+// keys such as user agents are cut to 100 characters.
+func classFileName(class string) string {
+	name := []byte(class)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == ':' || c == '-') {
+			name[i] = '_'
+		}
 	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return string(name)
+}
 
-	topIPs := make(map[string]int)
-	entries := len(ipCount)
-	if entries > *topIPsCount && *topIPsCount > 0 {
-		entries = *topIPsCount
+// addSourceInfos adds the number of requests per file to infos when more than
+// one file is analyzed.
+func (l Log2Analyze) addSourceInfos(infos map[string]string) {
+	if len(l.files()) < 2 {
+		return
 	}
-	if entries > 0 {
-		ips := make([]string, 0, entries)
-		for ip := range ipCount {
-			ips = append(ips, ip)
+	sourceCount := l.aggregate().SourceCount
+	for _, name := range l.files() {
+		infos["requests in "+name] = fmt.Sprintf("%v", sourceCount[name])
+	}
+}
+
+// formatEntryLine renders entry as a tab separated detail line for the
+// output files. When several files are analyzed the source file is appended
+// as the last column.
+func (l Log2Analyze) formatEntryLine(entry LogEntry) string {
+	line := entry.TimeStamp.Format(l.DateLayout) + "\t" + entry.IP + "\t" + entry.Method + "\t" + entry.Request + "\t" + fmt.Sprintf("%d", entry.Code) + "\t" + entry.RTime + "\t" + entry.UserAgent
+	if len(l.files()) > 1 {
+		line += "\t" + entry.Source
+	}
+	return line + "\n"
+}
+
+// writeEntriesByClass streams the retained entries once and writes the detail
+// line of each entry whose class has a writer in writers, rendered by format.
+func (l Log2Analyze) writeEntriesByClass(writers map[string]io.Writer, format func(LogEntry) string) {
+	l.EachEntry(func(entry LogEntry) {
+		if w, ok := writers[entry.Class]; ok {
+			io.WriteString(w, format(entry))
 		}
-		sort.SliceStable(ips, func(i, j int) bool {
-			return ipCount[ips[i]] > ipCount[ips[j]]
-		})
-		for i := 0; i < entries; i++ {
-			topIPs[ips[i]] = ipCount[ips[i]]
+	})
+}
+
+// writeSections writes one section per class to w: the header returned by
+// header, followed by the detail lines of that class rendered by format. The
+// entries are read only once; the sections are buffered in temporary files so
+// that the classes can be written one after another.
+func (l Log2Analyze) writeSections(w io.Writer, classes []string, header func(class string) string, footer string, format func(LogEntry) string) {
+	sections := make(map[string]*os.File, len(classes))
+	writers := make(map[string]io.Writer, len(classes))
+	for _, class := range classes {
+		tmp, err := os.CreateTemp("", "topFive-section-*")
+		if err != nil {
+			log.Fatal(err)
 		}
+		defer func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}()
+		sections[class] = tmp
+		writers[class] = tmp
+	}
+	l.writeEntriesByClass(writers, format)
+	for _, class := range classes {
+		io.WriteString(w, header(class))
+		if _, err := sections[class].Seek(0, io.SeekStart); err != nil {
+			log.Fatal(err)
+		}
+		if _, err := io.Copy(w, sections[class]); err != nil {
+			log.Fatal(err)
+		}
+		io.WriteString(w, footer)
 	}
-	return topIPs, codeCount
 }
 
 // WriteOutputFiles writes the analysis results to the configured output folder.
 // Depending on the -combined flag it writes either one file per top IP or a
-// single combined file. A response-code summary file is always written.
+// single combined file. With -export csv or tsv these files are spreadsheet
+// tables with a header row instead of text. A response-code summary file is
+// always written.
 func (l Log2Analyze) WriteOutputFiles(topIPs map[string]int, codeCounts map[int]int) {
+	format := l.detailFormatter(*exportFormat)
+	_, export := exportSeparators[*exportFormat]
 	if *topIPsCount > 0 {
-		if *combinedFile {
+		if *combinedFile && export {
+			cfile, err := os.Create(config.OutputFolder + "combined-" + time.Now().Local().Format("20060102_150405") + exportExtension(*exportFormat))
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer cfile.Close()
+			cfile.WriteString(formatRecord(exportHeader, *exportFormat))
+			l.writeSections(cfile, sortedByCount(topIPs), func(string) string { return "" }, "", format)
+		} else if *combinedFile {
 			cfile, err := os.Create(config.OutputFolder + "combined-" + time.Now().Local().Format("20060102_150405") + ".txt")
 			if err != nil {
 				log.Fatal(err)
@@ -248,46 +731,53 @@ func (l Log2Analyze) WriteOutputFiles(topIPs map[string]int, codeCounts map[int]
 			if *timeRange != 0 {
 				timestamps = append(timestamps, l.StartTime.Format("2006-01-02 15:04"))
 				timestamps = append(timestamps, l.EndTime.Format("2006-01-02 15:04"))
-				infos["Requests per second"] = fmt.Sprintf("%v", l.EntryCount/(*timeRange*60))
+			}
+			if rate, ok := l.requestsPerSecond(); ok {
+				infos["Requests per second"] = fmt.Sprintf("%.2f", rate)
 			}
 			if l.QueryString != "" {
 				infos["query string"] = l.QueryString
 			}
+			l.addSourceInfos(infos)
 
-			header := BuildOutputHeader(l.FileName, time.Now().Local().Format("20060102_150405"), timestamps, infos)
+			header := BuildOutputHeader(l.files(), time.Now().Local().Format("20060102_150405"), timestamps, infos)
 			cfile.WriteString(header)
 
 			if *topIPsCount < 31 {
-				cfile.WriteString("\n\tTop IPs\t\t: count")
+				cfile.WriteString("\n\tTop " + groupLabel() + "\t\t: count")
 				cfile.WriteString("\n\t------------------------------\n")
 				cfile.WriteString(sortByRcount(topIPs))
 			}
 
 			cfile.WriteString("\n")
-			for ip, count := range topIPs {
-				cfile.WriteString("\n")
-				cfile.WriteString(ip + "\t" + "=> " + fmt.Sprintf("%v", count) + " requests\n")
-				cfile.WriteString("==================================================================\n")
-				for _, record := range l.Entries {
-					if record.Class == ip {
-						cfile.WriteString(record.TimeStamp.Format(l.DateLayout) + "\t" + record.IP + "\t" + record.Method + "\t" + record.Request + "\t" + fmt.Sprintf("%d", record.Code) + "\t" + record.RTime + "\t" + record.UserAgent + "\n")
-					}
-				}
-			}
+			l.writeSections(cfile, sortedByCount(topIPs), func(ip string) string {
+				return "\n" + ip + "\t" + "=> " + fmt.Sprintf("%v", topIPs[ip]) + " requests\n" +
+					"==================================================================\n"
+			}, "", format)
 		} else {
-			for ip, count := range topIPs {
-				file, err := os.Create(config.OutputFolder + fmt.Sprintf("%05d", count) + "_" + ip + ".txt")
+			writers := make(map[string]io.Writer, len(topIPs))
+			names := make(map[string]bool, len(topIPs))
+			for _, ip := range sortedByCount(topIPs) {
+				count := topIPs[ip]
+				// different keys may map to the same file name
+				name := fmt.Sprintf("%05d", count) + "_" + classFileName(ip)
+				for i := 2; names[name]; i++ {
+					name = fmt.Sprintf("%05d_%s_%d", count, classFileName(ip), i)
+				}
+				names[name] = true
+				file, err := os.Create(config.OutputFolder + name + exportExtension(*exportFormat))
 				if err != nil {
 					log.Fatal(err)
 				}
 				defer file.Close()
-				file.WriteString(ip + "\t" + fmt.Sprintf("%v", count) + "\n")
-				for _, record := range l.Entries {
-					if record.Class == ip {
-						file.WriteString(record.TimeStamp.Format(l.DateLayout) + "\t" + record.IP + "\t" + record.Method + "\t" + record.Request + "\t" + fmt.Sprintf("%d", record.Code) + "\t" + record.RTime + "\t" + record.UserAgent + "\n")
-					}
+				if export {
+					file.WriteString(formatRecord(exportHeader, *exportFormat))
+				} else {
+					file.WriteString(ip + "\t" + fmt.Sprintf("%v", count) + "\n")
 				}
+				writers[ip] = file
 			}
+			l.writeEntriesByClass(writers, format)
 		}
 	} else {
 		file, err := os.Create(config.OutputFolder + "ip-list.txt")
@@ -295,14 +785,7 @@ func (l Log2Analyze) WriteOutputFiles(topIPs map[string]int, codeCounts map[int]
 			log.Fatal(err)
 		}
 		defer file.Close()
-		ips := make([]string, 0, len(topIPs))
-		for ip := range topIPs {
-			ips = append(ips, ip)
-		}
-		sort.SliceStable(ips, func(i, j int) bool {
-			return topIPs[ips[i]] > topIPs[ips[j]]
-		})
-		for _, ip := range ips {
+		for _, ip := range sortedByCount(topIPs) {
 			file.WriteString(ip + "\t" + fmt.Sprintf("%v", topIPs[ip]) + "\n")
 		}
 	}
@@ -327,49 +810,43 @@ func (l Log2Analyze) WriteOutputFiles(topIPs map[string]int, codeCounts map[int]
 	}
 }
 
-// GetTopLongRequests returns the top N IP classes by maximum response time.
-// The raw RTime string is divided by config.LogFormat.RTime.Unit to convert
-// to seconds. N is controlled by the -n flag (topIPsCount).
+// GetTopLongRequests returns the top N IP classes by the response-time
+// statistic chosen with -rt-stat (the maximum by default), in seconds. The
+// raw RTime string is divided by config.LogFormat.RTime.Unit to convert to
+// seconds. N is controlled by the -n flag (topIPsCount).
 func (l Log2Analyze) GetTopLongRequests() map[string]float64 {
-	unit := float64(config.LogFormat.RTime.Unit)
-	if unit == 0 {
-		unit = 1000
-	}
-	rtimeMax := make(map[string]float64)
-	for _, entry := range l.Entries {
-		if entry.RTime == "" {
-			continue
-		}
-		rt, err := strconv.ParseFloat(entry.RTime, 64)
-		if err != nil {
-			continue
-		}
-		rt = rt / unit
-		if rt > rtimeMax[entry.Class] {
-			rtimeMax[entry.Class] = rt
-		}
-	}
+	return l.topRTimes(*rtStat)
+}
 
+// topRTimes returns the top N classes by the response-time statistic stat
+// (see rtimeStatistics) with its value.
+func (l Log2Analyze) topRTimes(stat string) map[string]float64 {
+	agg := l.aggregate()
 	topRequests := make(map[string]float64)
-	entries := len(rtimeMax)
-	if entries > *topIPsCount && *topIPsCount > 0 {
-		entries = *topIPsCount
-	}
-	if entries > 0 {
-		ips := make([]string, 0, len(rtimeMax))
-		for ip := range rtimeMax {
-			ips = append(ips, ip)
+	if stat == "max" {
+		// RTimeMax is pruned by response time, so it keeps the slowest
+		// classes even when RTimes dropped them
+		ips := sortedByRtime(agg.RTimeMax)
+		if len(ips) > *topIPsCount && *topIPsCount > 0 {
+			ips = ips[:*topIPsCount]
 		}
-		sort.SliceStable(ips, func(i, j int) bool {
-			return rtimeMax[ips[i]] > rtimeMax[ips[j]]
-		})
-		for i := 0; i < entries; i++ {
-			topRequests[ips[i]] = rtimeMax[ips[i]]
+		for _, ip := range ips {
+			topRequests[ip] = agg.RTimeMax[ip]
 		}
+		return topRequests
+	}
+	for _, ip := range rankByRTime(agg.RTimes, stat, *topIPsCount) {
+		topRequests[ip] = rtimeStatistics[stat](agg.RTimes[ip])
 	}
 	return topRequests
 }
 
+// TopPathRTimes returns the top N request paths by the response-time
+// statistic chosen with -rt-stat, ranked.
+func (l Log2Analyze) TopPathRTimes() []string {
+	return rankByRTime(l.aggregate().PathRTimes, *rtStat, *topIPsCount)
+}
+
 // WriteResponseTimeFile writes a file containing all log entries whose IP class
 // appears in topLongRequests. The file is written to config.OutputFolder.
 func (l Log2Analyze) WriteResponseTimeFile(topLongRequests map[string]float64) {
@@ -378,16 +855,10 @@ func (l Log2Analyze) WriteResponseTimeFile(topLongRequests map[string]float64) {
 		log.Fatal(err)
 	}
 	defer file.Close()
-	for ip, rtime := range topLongRequests {
-		file.WriteString(fmt.Sprintf("%s\t=> %.1f s\n", ip, rtime))
-		file.WriteString("==================================================================\n")
-		for _, entry := range l.Entries {
-			if entry.Class == ip {
-				file.WriteString(entry.TimeStamp.Format(l.DateLayout) + "\t" + entry.IP + "\t" + entry.Method + "\t" + entry.Request + "\t" + fmt.Sprintf("%d", entry.Code) + "\t" + entry.RTime + "\t" + entry.UserAgent + "\n")
-			}
-		}
-		file.WriteString("\n")
-	}
+	l.writeSections(file, sortedByRtime(topLongRequests), func(ip string) string {
+		return fmt.Sprintf("%s\t=> %.1f s\n", ip, topLongRequests[ip]) +
+			"==================================================================\n"
+	}, "\n", l.formatEntryLine)
 }
 
 // Between reports whether e.TimeStamp falls strictly between start and end
@@ -396,19 +867,14 @@ func (e LogEntry) Between(start, end time.Time) bool {
 	return e.TimeStamp.After(start) && e.TimeStamp.Before(end)
 }
 
-// createEntry parses a log line and returns a LogEntry using the generic parser.
+// createEntry parses a log line and returns a LogEntry using the generic
+// parser. The Class of the entry is the key chosen with -by (see groupKey),
+// UAClass the class of its User-Agent (see classifyUserAgent).
 func createEntry(line string) LogEntry {
-	ip, class, timestamp, method, request, code, rtime, userAgent := parseGeneric(line)
-	return LogEntry{
-		IP:        ip,
-		Class:     class,
-		TimeStamp: timestamp,
-		Method:    method,
-		Request:   request,
-		Code:      code,
-		RTime:     rtime,
-		UserAgent: userAgent,
-	}
+	entry := parseGenericEntry(line)
+	entry.UAClass = classifyUserAgent(entry.UserAgent)
+	entry.Class = groupKey(entry)
+	return entry
 }
 
 // createTimeRange builds a start/end time window. The window ends at
@@ -417,7 +883,7 @@ func createEntry(line string) LogEntry {
 func createTimeRange(endtimestring string, timerange int, date2analyze string) (time.Time, time.Time) {
 	LogIt.Debug("got End Time String: " + endtimestring)
 	LogIt.Debug("got Time Range: " + fmt.Sprintf("%d", timerange))
-	endtimestring = fmt.Sprintf("%s %s:00 %s", date2analyze, endtimestring, time.Now().Local().Format("Z0700"))
+	endtimestring = fmt.Sprintf("%s %s:00 %s", date2analyze, endtimestring, time.Now().Local().Format("-0700"))
 	LogIt.Debug("End Time String: " + endtimestring)
 	endtime, _ := time.Parse("2006-01-02 15:04:05 -0700", endtimestring)
 	LogIt.Debug("created End Time: " + endtime.Format(log2Analyze.DateLayout))
@@ -31,11 +31,8 @@ func setupTestGlobals() {
 	defaultIPClass := "D"
 	IPclass = &defaultIPClass
 
-	defaultIP := ""
-	ipAddress = &defaultIP
-
-	defaultNotIP := ""
-	notIP = &defaultNotIP
+	ipAddress = &stringList{}
+	notIP = &stringList{}
 
 	defaultResponseCode := 0
 	responseCode = &defaultResponseCode
@@ -51,6 +48,30 @@ func setupTestGlobals() {
 
 	defaultCombined := false
 	combinedFile = &defaultCombined
+
+	defaultUAClass := ""
+	uaClass = &defaultUAClass
+
+	defaultRTStat := "max"
+	rtStat = &defaultRTStat
+
+	defaultExportFormat := "text"
+	exportFormat = &defaultExportFormat
+
+	defaultGroupBy := "class"
+	groupBy = &defaultGroupBy
+	groupByFields = nil
+	ipClassBits = ipClassPresets["D"]
+	loadUserAgentRules(nil)
+}
+
+// useIPClass sets -k to class as main does.
+func useIPClass(t *testing.T, class string) {
+	t.Helper()
+	IPclass = &class
+	if err := applyIPClass(); err != nil {
+		t.Fatal(err)
+	}
 }
 
 // ──────────────────────────────────────────────
@@ -107,8 +128,7 @@ func TestParseGenericApache(t *testing.T) {
 
 func TestParseGenericApacheIPClassA(t *testing.T) {
 	setupTestGlobals()
-	classA := "A"
-	IPclass = &classA
+	useIPClass(t, "A")
 
 	line := `10.20.30.40 - - [10/Feb/2026:12:00:00 +0000] "POST /api HTTP/1.1" 201 512 "-" "curl/7.0"`
 	ip, class, _, method, request, code, _, _ := parseGeneric(line)
@@ -116,8 +136,8 @@ func TestParseGenericApacheIPClassA(t *testing.T) {
 	if ip != "10.20.30.40" {
 		t.Errorf("ip: got %q, want %q", ip, "10.20.30.40")
 	}
-	if class != "10" {
-		t.Errorf("class A: got %q, want %q", class, "10")
+	if class != "10.0.0.0/8" {
+		t.Errorf("class A: got %q, want %q", class, "10.0.0.0/8")
 	}
 	if method != "POST" {
 		t.Errorf("method: got %q, want %q", method, "POST")
@@ -132,27 +152,25 @@ func TestParseGenericApacheIPClassA(t *testing.T) {
 
 func TestParseGenericApacheIPClassB(t *testing.T) {
 	setupTestGlobals()
-	classB := "B"
-	IPclass = &classB
+	useIPClass(t, "B")
 
 	line := `10.20.30.40 - - [10/Feb/2026:12:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "-"`
 	_, class, _, _, _, _, _, _ := parseGeneric(line)
 
-	if class != "10.20" {
-		t.Errorf("class B: got %q, want %q", class, "10.20")
+	if class != "10.20.0.0/16" {
+		t.Errorf("class B: got %q, want %q", class, "10.20.0.0/16")
 	}
 }
 
 func TestParseGenericApacheIPClassC(t *testing.T) {
 	setupTestGlobals()
-	classC := "C"
-	IPclass = &classC
+	useIPClass(t, "C")
 
 	line := `10.20.30.40 - - [10/Feb/2026:12:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "-"`
 	_, class, _, _, _, _, _, _ := parseGeneric(line)
 
-	if class != "10.20.30" {
-		t.Errorf("class C: got %q, want %q", class, "10.20.30")
+	if class != "10.20.30.0/24" {
+		t.Errorf("class C: got %q, want %q", class, "10.20.30.0/24")
 	}
 }
 
@@ -221,8 +239,7 @@ func TestParseGenericApache408Like(t *testing.T) {
 
 func TestParseGenericApacheIPv6(t *testing.T) {
 	setupTestGlobals()
-	classA := "A"
-	IPclass = &classA
+	useIPClass(t, "A")
 
 	line := `2001:db8::1 - - [10/Feb/2026:12:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "-"`
 	ip, class, _, _, _, _, _, _ := parseGeneric(line)
@@ -230,9 +247,70 @@ func TestParseGenericApacheIPv6(t *testing.T) {
 	if ip != "2001:db8::1" {
 		t.Errorf("ip: got %q, want %q", ip, "2001:db8::1")
 	}
-	// non-4-part IP → class = full IP
-	if class != ip {
-		t.Errorf("class: got %q, want %q (full IP fallback)", class, ip)
+	// class A of an IPv6 address is its /32 network
+	if class != "2001:db8::/32" {
+		t.Errorf("class: got %q, want %q", class, "2001:db8::/32")
+	}
+}
+
+// ──────────────────────────────────────────────
+// ipToClass / parseIPClass
+// ──────────────────────────────────────────────
+
+func TestIPToClassPrefixLength(t *testing.T) {
+	setupTestGlobals()
+	tests := []struct {
+		class, ip, want string
+	}{
+		{"/24", "10.20.30.40", "10.20.30.0/24"},
+		{"/20", "10.20.30.40", "10.20.16.0/20"},
+		{"/48", "2001:db8:abcd:12::1", "2001:db8:abcd::/48"},
+		{"/48", "10.20.30.40", "10.20.30.40"},
+		{"/24,/64", "10.20.30.40", "10.20.30.0/24"},
+		{"/24,/64", "2001:db8:abcd:12::1", "2001:db8:abcd:12::/64"},
+		{"C", "2001:db8:abcd:12::1", "2001:db8:abcd:12::/64"},
+		{"D", "2001:db8::1", "2001:db8::1"},
+		{"/24", "::ffff:10.20.30.40", "10.20.30.0/24"},
+		{"/64", "[2001:db8::1]", "2001:db8::/64"},
+		{"/24", "2001:db8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		useIPClass(t, tt.class)
+		if got := ipToClass(tt.ip); got != tt.want {
+			t.Errorf("-k %s %s: got %q, want %q", tt.class, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestIPToClassInvalid(t *testing.T) {
+	setupTestGlobals()
+	for _, ip := range []string{"-", "", "unknown", "10.20.30", "10.20.30.400", "example.org"} {
+		if got := ipToClass(ip); got != invalidClass {
+			t.Errorf("%q: got %q, want %q", ip, got, invalidClass)
+		}
+	}
+}
+
+func TestParseIPClass(t *testing.T) {
+	tests := map[string][2]int{
+		"A":       {8, 32},
+		"D":       {32, 128},
+		"/24":     {24, 128},
+		"/32":     {32, 128},
+		"/56":     {32, 56},
+		"24":      {24, 128},
+		"/24,/48": {24, 48},
+	}
+	for class, want := range tests {
+		v4, v6, err := parseIPClass(class)
+		if err != nil || v4 != want[0] || v6 != want[1] {
+			t.Errorf("%s: got %d, %d, %v, want %v", class, v4, v6, err, want)
+		}
+	}
+	for _, class := range []string{"E", "/129", "/-1", "/33,/48", "/24,/48,/64", "/x"} {
+		if _, _, err := parseIPClass(class); err == nil {
+			t.Errorf("%s: expected an error", class)
+		}
 	}
 }
 
@@ -417,37 +495,34 @@ func TestParseGenericRosettaIPFallback(t *testing.T) {
 
 func TestParseGenericRosettaIPClassA(t *testing.T) {
 	setupRosettaConfig()
-	classA := "A"
-	IPclass = &classA
+	useIPClass(t, "A")
 
 	_, class, _, _, _, _, _, _ := parseGeneric(realRosettaLine)
 
-	if class != "129" {
-		t.Errorf("class A: got %q, want %q", class, "129")
+	if class != "129.0.0.0/8" {
+		t.Errorf("class A: got %q, want %q", class, "129.0.0.0/8")
 	}
 }
 
 func TestParseGenericRosettaIPClassB(t *testing.T) {
 	setupRosettaConfig()
-	classB := "B"
-	IPclass = &classB
+	useIPClass(t, "B")
 
 	_, class, _, _, _, _, _, _ := parseGeneric(realRosettaLine)
 
-	if class != "129.132" {
-		t.Errorf("class B: got %q, want %q", class, "129.132")
+	if class != "129.132.0.0/16" {
+		t.Errorf("class B: got %q, want %q", class, "129.132.0.0/16")
 	}
 }
 
 func TestParseGenericRosettaIPClassC(t *testing.T) {
 	setupRosettaConfig()
-	classC := "C"
-	IPclass = &classC
+	useIPClass(t, "C")
 
 	_, class, _, _, _, _, _, _ := parseGeneric(realRosettaLine)
 
-	if class != "129.132.181" {
-		t.Errorf("class C: got %q, want %q", class, "129.132.181")
+	if class != "129.132.181.0/24" {
+		t.Errorf("class C: got %q, want %q", class, "129.132.181.0/24")
 	}
 }
 
@@ -1049,8 +1124,10 @@ func TestRetrieveEntriesWithTimeRange(t *testing.T) {
 
 func TestRetrieveEntriesIPFilter(t *testing.T) {
 	setupTestGlobals()
-	filterIP := "192.168.1.1"
-	ipAddress = &filterIP
+	filter, err := newIPFilter([]string{"192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	logContent := `192.168.1.1 - - [10/Feb/2026:12:00:00 +0000] "GET /a HTTP/1.1" 200 100 "-" "-"
 10.0.0.1 - - [10/Feb/2026:12:01:00 +0000] "GET /b HTTP/1.1" 200 100 "-" "-"
@@ -1062,6 +1139,7 @@ func TestRetrieveEntriesIPFilter(t *testing.T) {
 	l := &Log2Analyze{
 		FileName:   tmpFile,
 		DateLayout: "02/Jan/2006:15:04:05 -0700",
+		IPFilter:   filter,
 	}
 	log2Analyze = l
 
@@ -1079,8 +1157,10 @@ func TestRetrieveEntriesIPFilter(t *testing.T) {
 
 func TestRetrieveEntriesNotIPFilter(t *testing.T) {
 	setupTestGlobals()
-	excludeIP := "10.0.0.1"
-	notIP = &excludeIP
+	filter, err := newIPFilter([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	logContent := `192.168.1.1 - - [10/Feb/2026:12:00:00 +0000] "GET /a HTTP/1.1" 200 100 "-" "-"
 10.0.0.1 - - [10/Feb/2026:12:01:00 +0000] "GET /b HTTP/1.1" 200 100 "-" "-"
@@ -1090,8 +1170,9 @@ func TestRetrieveEntriesNotIPFilter(t *testing.T) {
 	defer os.Remove(tmpFile)
 
 	l := &Log2Analyze{
-		FileName:   tmpFile,
-		DateLayout: "02/Jan/2006:15:04:05 -0700",
+		FileName:    tmpFile,
+		DateLayout:  "02/Jan/2006:15:04:05 -0700",
+		NotIPFilter: filter,
 	}
 	log2Analyze = l
 
@@ -1186,6 +1267,56 @@ func TestRetrieveEntriesNoResponseCodeFilter(t *testing.T) {
 	}
 }
 
+func TestRetrieveEntriesMultipleFiles(t *testing.T) {
+	setupTestGlobals()
+	dir := t.TempDir()
+	config.OutputFolder = dir + "/"
+
+	first := writeTempLogFile(t, `192.168.1.1 - - [10/Feb/2026:12:00:00 +0000] "GET /a HTTP/1.1" 200 100 "-" "-"
+10.0.0.1 - - [10/Feb/2026:12:01:00 +0000] "GET /b HTTP/1.1" 200 100 "-" "-"
+`)
+	defer os.Remove(first)
+	second := writeTempLogFile(t, `192.168.1.1 - - [10/Feb/2026:12:02:00 +0000] "GET /c HTTP/1.1" 200 100 "-" "-"
+`)
+	defer os.Remove(second)
+
+	l := &Log2Analyze{
+		FileNames:  []string{first, second},
+		DateLayout: "02/Jan/2006:15:04:05 -0700",
+	}
+	log2Analyze = l
+	l.RetrieveEntries("12:05", 0)
+
+	if l.EntryCount != 3 {
+		t.Errorf("EntryCount: got %d, want 3", l.EntryCount)
+	}
+	if l.Entries[0].Source != first || l.Entries[2].Source != second {
+		t.Errorf("Source not set: %q, %q", l.Entries[0].Source, l.Entries[2].Source)
+	}
+	if want := time.Date(2026, 2, 10, 12, 2, 0, 0, time.UTC); !l.EndTime.Equal(want) {
+		t.Errorf("EndTime: got %v, want %v", l.EndTime, want)
+	}
+
+	topIPs, codeCounts := l.GetTopIPs()
+	if topIPs["192.168.1.1"] != 2 {
+		t.Errorf("192.168.1.1 count: got %d, want 2", topIPs["192.168.1.1"])
+	}
+	l.WriteOutputFiles(topIPs, codeCounts)
+	content, err := os.ReadFile(dir + "/00002_192.168.1.1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "/a\t200\t\t-\t"+first) || !strings.Contains(string(content), "\t"+second) {
+		t.Errorf("per-IP file should name the source files, got: %s", content)
+	}
+
+	infos := make(map[string]string)
+	l.addSourceInfos(infos)
+	if infos["requests in "+first] != "2" || infos["requests in "+second] != "1" {
+		t.Errorf("source infos: got %v", infos)
+	}
+}
+
 // ──────────────────────────────────────────────
 // WriteOutputFiles
 // ──────────────────────────────────────────────
@@ -1237,6 +1368,30 @@ func TestWriteOutputFilesSeparate(t *testing.T) {
 	l.WriteOutputFiles(topIPs, codeCounts)
 }
 
+func TestWriteOutputFilesCIDRClass(t *testing.T) {
+	setupTestGlobals()
+	dir := t.TempDir()
+	config.OutputFolder = dir + "/"
+
+	l := Log2Analyze{
+		FileName:   "test.log",
+		DateLayout: "02/Jan/2006:15:04:05 -0700",
+		EntryCount: 1,
+		Entries: []LogEntry{
+			{IP: "10.20.30.40", Class: "10.20.30.0/24", TimeStamp: time.Date(2026, 2, 10, 12, 1, 0, 0, time.UTC), Method: "GET", Request: "/x", Code: 200},
+		},
+	}
+	l.WriteOutputFiles(map[string]int{"10.20.30.0/24": 1}, map[int]int{200: 1})
+
+	content, err := os.ReadFile(dir + "/00001_10.20.30.0_24.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "10.20.30.0/24\t1\n") || !strings.Contains(string(content), "10.20.30.40") {
+		t.Errorf("got: %s", content)
+	}
+}
+
 func TestWriteOutputFilesAllIPs(t *testing.T) {
 	setupTestGlobals()
 	n := 0
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// autoSampleLines is the number of lines -lt auto parses to pick the log
+// type.
+const autoSampleLines = 100
+
+// autoLogTypes are the log types tried by -lt auto: every preset of
+// logTypePresets (without aliases) and the structured types, which use the
+// LogFormat.Keys of the config file. When several parse the sample equally
+// well, the one filling more fields wins, and then the first.
+var autoLogTypes = []string{"apache_common", "apache_combined", "haproxy_http", "rosetta", "json", "logfmt"}
+
+// commonDateLayouts are the DateLayouts tried by -lt auto besides the
+// configured one.
+var commonDateLayouts = []string{
+	"02/Jan/2006:15:04:05 -0700",
+	"02/Jan/2006:15:04:05.000",
+	"02/Jan/2006:15:04:05.000 -0700",
+	"02/Jan/2006:15:04:05",
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+}
+
+// Detection is the log type and DateLayout chosen by detectLogType.
+type Detection struct {
+	LogType    string
+	DateLayout string
+	Parsed     int // sampled lines with a valid IP, timestamp and code
+	Sampled    int
+	fields     int // optional fields filled in the sample
+}
+
+// Confidence returns the share of the sampled lines that were parsed.
+func (d Detection) Confidence() float64 {
+	if d.Sampled == 0 {
+		return 0
+	}
+	return float64(d.Parsed) / float64(d.Sampled)
+}
+
+// better reports whether d parses the sample better than other.
+func (d Detection) better(other Detection) bool {
+	if d.Parsed != other.Parsed {
+		return d.Parsed > other.Parsed
+	}
+	return d.fields > other.fields
+}
+
+// String describes the Detection, e.g. for the console.
+func (d Detection) String() string {
+	return fmt.Sprintf("log type %s with DateLayout %q (confidence %.0f%%, %d of %d sampled lines parsed)",
+		d.LogType, d.DateLayout, d.Confidence()*100, d.Parsed, d.Sampled)
+}
+
+// AutoDetect samples the first lines of the first log file, picks the preset
+// of autoLogTypes and the DateLayout of layouts that parse most of them, and
+// sets config.LogType, config.LogFormat and l.DateLayout accordingly. An
+// Envelope is kept and applied to every candidate.
+func (l *Log2Analyze) AutoDetect(layouts []string) (Detection, error) {
+	name := l.files()[0]
+	lines, err := sampleLines(name, autoSampleLines)
+	if err != nil {
+		return Detection{}, err
+	}
+	base := config.LogFormat
+	best, err := detectLogType(lines, layouts)
+	if err != nil {
+		return best, fmt.Errorf("cannot detect the log type of %s: %w", name, err)
+	}
+	if err := useLogType(best.LogType, base); err != nil {
+		return best, err
+	}
+	l.DateLayout = best.DateLayout
+	return best, nil
+}
+
+// useLogType sets config.LogType to logType and compiles its format. The
+// structured types keep the Keys and RTime of base, the LogFormat of the
+// config file.
+func useLogType(logType string, base LogFormatConfig) error {
+	config.LogType = logType
+	config.LogFormat = base
+	config.applyLogTypePreset()
+	return config.compileFormat()
+}
+
+// detectLogType parses lines with every combination of autoLogTypes and
+// layouts and returns the best one. The structured types are skipped when
+// the config file names no LogFormat.Keys for them. It changes
+// config.LogType, config.LogFormat and log2Analyze.DateLayout.
+func detectLogType(lines []string, layouts []string) (Detection, error) {
+	// the candidates that do not match would fill the log with parse errors
+	logger := LogIt
+	LogIt = slog.New(slog.DiscardHandler)
+	defer func() { LogIt = logger }()
+
+	base := config.LogFormat
+	var best Detection
+	for _, logType := range autoLogTypes {
+		if err := useLogType(logType, base); err != nil {
+			if _, preset := logTypePresets[logType]; preset {
+				return best, err
+			}
+			logger.Debug("not trying " + logType + ": " + err.Error())
+			continue
+		}
+		var tried []string
+		for _, layout := range layouts {
+			if slices.Contains(tried, layout) {
+				continue
+			}
+			tried = append(tried, layout)
+			log2Analyze.DateLayout = layout
+			d := sampleDetection(lines)
+			d.LogType, d.DateLayout = logType, layout
+			if best.LogType == "" || d.better(best) {
+				best = d
+			}
+		}
+	}
+	if best.Sampled == 0 {
+		return best, fmt.Errorf("no lines to sample")
+	}
+	if best.Parsed == 0 {
+		return best, fmt.Errorf("none of %s parses the sampled lines, use -lt and -dl", strings.Join(autoLogTypes, ", "))
+	}
+	return best, nil
+}
+
+// sampleDetection parses lines with the current configuration and counts the
+// lines with a valid IP, timestamp and response code.
+func sampleDetection(lines []string) Detection {
+	var d Detection
+	for _, line := range lines {
+		entry := parseGenericEntry(line)
+		if entry.filtered {
+			continue
+		}
+		d.Sampled++
+		if entry.TimeStamp.IsZero() || ipToClass(entry.IP) == invalidClass || entry.Code < 100 || entry.Code > 599 {
+			continue
+		}
+		d.Parsed++
+		for _, field := range []string{entry.Method, entry.Request, entry.RTime, entry.UserAgent, entry.Referer, entry.VHost} {
+			if field != "" {
+				d.fields++
+			}
+		}
+	}
+	return d
+}
+
+// sampleLines returns the first n non-empty lines of the log file name,
+// decompressed if necessary. Regular files are read without moving their
+// offset; from piped standard input the data read is kept in stdinReplay.
+func sampleLines(name string, n int) ([]string, error) {
+	file, err := openLogFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer closeLogFile(file)
+
+	var r io.Reader
+	var recorded *bytes.Buffer
+	info, err := file.Stat()
+	switch {
+	case err == nil && info.Mode().IsRegular():
+		r = io.NewSectionReader(file, 0, info.Size())
+	case file == os.Stdin:
+		recorded = new(bytes.Buffer)
+		r = io.TeeReader(stdinReader(), recorded)
+	default:
+		return nil, fmt.Errorf("cannot sample %s, it can only be read once; use -lt", name)
+	}
+
+	buffered := bufio.NewReader(r)
+	dec, err := decompress(peekCompression(buffered), buffered)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	var lines []string
+	scanner := bufio.NewScanner(dec)
+	for len(lines) < n && scanner.Scan() {
+		if line := scanner.Text(); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if recorded != nil {
+		stdinReplay = recorded.Bytes()
+	}
+	return lines, scanner.Err()
+}
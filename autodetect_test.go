@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	autoCombinedLine = `10.0.0.1 - - [10/Feb/2026:12:00:00 +0100] "GET /a HTTP/1.1" 200 512 "https://example.org/" "Mozilla/5.0 (X11)"`
+	autoCommonLine   = `10.0.0.1 - frank [10/Feb/2026:12:00:00 +0100] "GET /a HTTP/1.1" 200 512`
+)
+
+// autoLayouts are the layouts tried in the tests, the configured one first.
+func autoLayouts() []string {
+	return append([]string{"2006-01-02 15:04:05"}, commonDateLayouts...)
+}
+
+// repeatLines returns n copies of line.
+func repeatLines(line string, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = line
+	}
+	return lines
+}
+
+// ──────────────────────────────────────────────
+// detectLogType
+// ──────────────────────────────────────────────
+
+func TestDetectLogType(t *testing.T) {
+	tests := map[string]struct {
+		line       string
+		logType    string
+		dateLayout string
+	}{
+		"combined": {autoCombinedLine, "apache_combined", "02/Jan/2006:15:04:05 -0700"},
+		"common":   {autoCommonLine, "apache_common", "02/Jan/2006:15:04:05 -0700"},
+		"haproxy":  {realHAProxyLine, "haproxy_http", "02/Jan/2006:15:04:05.000"},
+		"rosetta":  {realRosettaLine, "rosetta", "02/Jan/2006:15:04:05 -0700"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			setupTestGlobals()
+			defer setupTestGlobals()
+			d, err := detectLogType(repeatLines(tt.line, 10), autoLayouts())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.LogType != tt.logType || d.DateLayout != tt.dateLayout {
+				t.Errorf("got %s / %s, want %s / %s", d.LogType, d.DateLayout, tt.logType, tt.dateLayout)
+			}
+			if d.Confidence() != 1 {
+				t.Errorf("confidence: got %v, want 1", d.Confidence())
+			}
+		})
+	}
+}
+
+func TestDetectLogTypeConfidence(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	lines := append(repeatLines(autoCombinedLine, 3), "garbage", `10.0.0.1 - - [yesterday] "GET / HTTP/1.1" 200 1 "-" "-"`)
+	d, err := detectLogType(lines, autoLayouts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.LogType != "apache_combined" || d.Parsed != 3 || d.Sampled != 5 {
+		t.Errorf("got %+v", d)
+	}
+	if want := "log type apache_combined with DateLayout \"02/Jan/2006:15:04:05 -0700\" (confidence 60%, 3 of 5 sampled lines parsed)"; d.String() != want {
+		t.Errorf("got %q, want %q", d.String(), want)
+	}
+}
+
+func TestDetectLogTypeFixedLayout(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	// with -dl only the given layout is tried
+	if _, err := detectLogType(repeatLines(autoCombinedLine, 3), []string{"2006-01-02 15:04:05"}); err == nil {
+		t.Error("expected an error, no layout parses the timestamps")
+	}
+}
+
+func TestDetectLogTypeNothingParses(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	_, err := detectLogType([]string{"garbage", "more garbage"}, autoLayouts())
+	if err == nil || !strings.Contains(err.Error(), "use -lt and -dl") {
+		t.Errorf("got %v", err)
+	}
+	if _, err := detectLogType(nil, autoLayouts()); err == nil {
+		t.Error("no lines: expected an error")
+	}
+}
+
+func TestAutoLogTypesCoverPresets(t *testing.T) {
+	for name, preset := range logTypePresets {
+		covered := false
+		for _, logType := range autoLogTypes {
+			if auto, ok := logTypePresets[logType]; ok && auto() == preset() {
+				covered = true
+			}
+		}
+		if !covered {
+			t.Errorf("the preset %s is not tried by -lt auto", name)
+		}
+	}
+	for _, logType := range []string{"json", "logfmt"} {
+		if !slices.Contains(autoLogTypes, logType) {
+			t.Errorf("%s is not tried by -lt auto", logType)
+		}
+	}
+}
+
+func TestDetectLogTypeStructured(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	config.LogFormat.Keys = FieldKeys{IP: "ip", TimeStamp: "ts", Code: "status", Request: "uri"}
+	lines := repeatLines(`{"ip":"2001:db8::1","ts":"2026-02-10T12:00:00Z","status":200,"uri":"/a"}`, 5)
+	d, err := detectLogType(lines, autoLayouts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.LogType != "json" || d.Confidence() != 1 {
+		t.Errorf("got %+v", d)
+	}
+	// without Keys the structured types are not tried
+	config.LogFormat.Keys = FieldKeys{}
+	if _, err := detectLogType(lines, autoLayouts()); err == nil {
+		t.Error("expected an error, no preset parses JSON lines")
+	}
+}
+
+func TestSampleDetectionBracketedIPv6(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	line := `[2001:db8::1] - - [10/Feb/2026:12:00:00 +0100] "GET /a HTTP/1.1" 200 512 "-" "-"`
+	if d := sampleDetection([]string{line}); d.Parsed != 1 {
+		t.Errorf("a bracketed IPv6 address should be accepted: %+v", d)
+	}
+}
+
+func TestDetectLogTypeEnvelope(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	config.Envelope = EnvelopeConfig{Type: "syslog", Program: "haproxy"}
+	lines := []string{
+		"Feb  6 12:14:14 lb1 haproxy[1234]: " + realHAProxyLine,
+		"Feb  6 12:14:15 lb1 sshd[99]: Accepted publickey for root",
+	}
+	d, err := detectLogType(lines, autoLayouts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.LogType != "haproxy_http" || d.Sampled != 1 || d.Parsed != 1 {
+		t.Errorf("got %+v", d)
+	}
+}
+
+// ──────────────────────────────────────────────
+// AutoDetect and sampleLines
+// ──────────────────────────────────────────────
+
+func TestAutoDetect(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	config.LogType = "auto"
+	content := strings.Join(repeatLines(realHAProxyLine, autoSampleLines+10), "\n") + "\n"
+	tmpFile := t.TempDir() + "/haproxy.log"
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	log2Analyze.FileNames = []string{tmpFile}
+	d, err := log2Analyze.AutoDetect(autoLayouts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Sampled != autoSampleLines {
+		t.Errorf("sampled: got %d, want %d", d.Sampled, autoSampleLines)
+	}
+	if config.LogType != "haproxy_http" || log2Analyze.DateLayout != "02/Jan/2006:15:04:05.000" || !config.LogFormat.IPStripPort {
+		t.Errorf("configuration not applied: %s %q %+v", config.LogType, log2Analyze.DateLayout, config.LogFormat)
+	}
+	if entry := createEntry(realHAProxyLine); entry.IP != "10.0.1.2" || entry.TimeStamp.IsZero() {
+		t.Errorf("got %+v", entry)
+	}
+}
+
+func TestSampleLinesStdinReplay(t *testing.T) {
+	setupTestGlobals()
+	t.Cleanup(func() { stdinReplay = nil })
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	io.WriteString(gw, "\nfirst\nsecond\nthird\n")
+	gw.Close()
+	pipeToStdin(t, gz.Bytes())
+
+	lines, err := sampleLines(stdinName, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, ",") != "first,second" {
+		t.Errorf("got %q", lines)
+	}
+	// the analysis still reads standard input from the start
+	rest, err := io.ReadAll(stdinReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, gz.Bytes()) {
+		t.Errorf("replayed %d bytes, want %d", len(rest), gz.Len())
+	}
+}
+
+func TestSampleLinesKeepsOffset(t *testing.T) {
+	tmpFile := writeTempLogFile(t, "first\nsecond\n")
+	defer os.Remove(tmpFile)
+	file, err := os.Open(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	stdin := os.Stdin
+	os.Stdin = file
+	defer func() { os.Stdin = stdin }()
+
+	if lines, err := sampleLines(stdinName, 1); err != nil || len(lines) != 1 {
+		t.Fatalf("got %q, %v", lines, err)
+	}
+	if data, _ := io.ReadAll(file); string(data) != "first\nsecond\n" {
+		t.Errorf("offset was moved, read %q", data)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BlockListConfig configures the firewall block lists written with -block.
+//
+// An entry of the top IPs qualifies when it has at least MinCount requests
+// and at least MinRate requests per second within the analyzed time window
+// (the -m window, or the span of the requests with -m 0; a zero value
+// disables the check). Networks overlapping Allowlist (IP
+// addresses or CIDRs) are never blocked. SetName is the name of the nftables
+// set or ipset; IPv6 addresses go into SetName with a "6" appended.
+type BlockListConfig struct {
+	MinCount  int      `yaml:"MinCount"`
+	MinRate   float64  `yaml:"MinRate"`
+	Allowlist []string `yaml:"Allowlist"`
+	SetName   string   `yaml:"SetName"`
+}
+
+// blockListFormats maps the -block formats to the extension of the written file.
+var blockListFormats = map[string]string{
+	"nftables": ".nft",
+	"ipset":    ".ipset",
+	"apache":   ".conf",
+	"nginx":    ".conf",
+	"haproxy":  ".acl",
+}
+
+// blockEntry is a network to block together with its request count.
+type blockEntry struct {
+	Prefix netip.Prefix
+	Count  int
+}
+
+// classPrefix returns the network covered by class (see ipToClass): a CIDR
+// as it is and a single IP address as a single-address prefix.
+func classPrefix(class string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(class); err == nil {
+		return prefix.Masked(), nil
+	}
+	if addr, err := netip.ParseAddr(class); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	return netip.Prefix{}, fmt.Errorf("%q is not an IP address or network", class)
+}
+
+// parseAllowlist parses the IP addresses and CIDRs of the allowlist.
+func parseAllowlist(allowlist []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(allowlist))
+	for _, allowed := range allowlist {
+		prefix, err := classPrefix(strings.TrimSpace(allowed))
+		if err != nil {
+			return nil, fmt.Errorf("invalid BlockList Allowlist entry: %w", err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// BlockList returns the networks of topIPs that qualify for blocking, most
+// requests first. Entries below the thresholds of config.BlockList and
+// networks overlapping its allowlist are left out.
+func (l Log2Analyze) BlockList(topIPs map[string]int) ([]blockEntry, error) {
+	cfg := config.BlockList
+	allowed, err := parseAllowlist(cfg.Allowlist)
+	if err != nil {
+		return nil, err
+	}
+	seconds := l.analyzedSeconds()
+
+	var entries []blockEntry
+	for _, class := range sortedByCount(topIPs) {
+		count := topIPs[class]
+		if count < cfg.MinCount {
+			continue
+		}
+		if cfg.MinRate > 0 && seconds > 0 && float64(count)/seconds < cfg.MinRate {
+			continue
+		}
+		prefix, err := classPrefix(class)
+		if err != nil {
+			LogIt.Warn("not blocking " + class + ": " + err.Error())
+			continue
+		}
+		if overlapsAny(prefix, allowed) {
+			LogIt.Info("not blocking " + prefix.String() + ", it overlaps the allowlist")
+			continue
+		}
+		entries = append(entries, blockEntry{Prefix: prefix, Count: count})
+	}
+	return entries, nil
+}
+
+// overlapsAny reports whether prefix overlaps one of prefixes.
+func overlapsAny(prefix netip.Prefix, prefixes []netip.Prefix) bool {
+	for _, p := range prefixes {
+		if prefix.Overlaps(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockAddress returns prefix in the notation used in block lists: a plain
+// address for single addresses, CIDR otherwise.
+func blockAddress(prefix netip.Prefix) string {
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String()
+	}
+	return prefix.String()
+}
+
+// splitFamilies returns the IPv4 and the IPv6 networks of entries in address
+// order.
+func splitFamilies(entries []blockEntry) (v4, v6 []string) {
+	entries = append([]blockEntry(nil), entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].Prefix, entries[j].Prefix
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+	for _, entry := range entries {
+		if entry.Prefix.Addr().Is4() {
+			v4 = append(v4, blockAddress(entry.Prefix))
+		} else {
+			v6 = append(v6, blockAddress(entry.Prefix))
+		}
+	}
+	return v4, v6
+}
+
+// WriteBlockList writes entries to w as rules in format (nftables, ipset,
+// apache, nginx or haproxy).
+func WriteBlockList(w io.Writer, format string, entries []blockEntry, setName string) error {
+	if setName == "" {
+		setName = "topfive_block"
+	}
+	v4, v6 := splitFamilies(entries)
+	var b strings.Builder
+	b.WriteString("# topFive block list, generated " + time.Now().Format(time.RFC3339) + "\n")
+	switch format {
+	case "nftables":
+		b.WriteString("# the sets need the interval flag, e.g.\n")
+		b.WriteString("#   nft add set inet filter " + setName + " '{ type ipv4_addr; flags interval; }'\n")
+		b.WriteString("#   nft add set inet filter " + setName + "6 '{ type ipv6_addr; flags interval; }'\n")
+		if len(v4) > 0 {
+			b.WriteString("add element inet filter " + setName + " { " + strings.Join(v4, ", ") + " }\n")
+		}
+		if len(v6) > 0 {
+			b.WriteString("add element inet filter " + setName + "6 { " + strings.Join(v6, ", ") + " }\n")
+		}
+	case "ipset":
+		b.WriteString("# load with: ipset restore < this file\n")
+		b.WriteString("#   iptables -I INPUT -m set --match-set " + setName + " src -j DROP\n")
+		b.WriteString("#   ip6tables -I INPUT -m set --match-set " + setName + "6 src -j DROP\n")
+		b.WriteString("create " + setName + " hash:net family inet -exist\n")
+		for _, network := range v4 {
+			b.WriteString("add " + setName + " " + network + " -exist\n")
+		}
+		b.WriteString("create " + setName + "6 hash:net family inet6 -exist\n")
+		for _, network := range v6 {
+			b.WriteString("add " + setName + "6 " + network + " -exist\n")
+		}
+	case "apache":
+		b.WriteString("<RequireAll>\n    Require all granted\n")
+		for _, network := range append(v4, v6...) {
+			b.WriteString("    Require not ip " + network + "\n")
+		}
+		b.WriteString("</RequireAll>\n")
+	case "nginx":
+		for _, network := range append(v4, v6...) {
+			b.WriteString("deny " + network + ";\n")
+		}
+	case "haproxy":
+		b.WriteString("# use with: acl topfive_block src -f <this file>\n")
+		for _, network := range append(v4, v6...) {
+			b.WriteString(network + "\n")
+		}
+	default:
+		return fmt.Errorf("unknown block list format %q", format)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteBlockListFile writes the block list of topIPs in format to the output
+// folder and returns the name of the file and the number of blocked networks.
+func (l Log2Analyze) WriteBlockListFile(topIPs map[string]int, format string) (string, int, error) {
+	entries, err := l.BlockList(topIPs)
+	if err != nil {
+		return "", 0, err
+	}
+	name := config.OutputFolder + "blocklist-" + format + "-" + time.Now().Local().Format("20060102_150405") + blockListFormats[format]
+	file, err := os.Create(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	if err := WriteBlockList(file, format, entries, config.BlockList.SetName); err != nil {
+		return "", 0, err
+	}
+	return name, len(entries), nil
+}
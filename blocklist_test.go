@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// ──────────────────────────────────────────────
+// classPrefix
+// ──────────────────────────────────────────────
+
+func TestClassPrefix(t *testing.T) {
+	tests := map[string]string{
+		"10.1.2.3":       "10.1.2.3/32",
+		"2001:db8::1":    "2001:db8::1/128",
+		"2001:db8::1/48": "2001:db8::/48",
+		"192.0.2.7/24":   "192.0.2.0/24",
+	}
+	for class, want := range tests {
+		prefix, err := classPrefix(class)
+		if err != nil {
+			t.Errorf("%s: %v", class, err)
+			continue
+		}
+		if prefix.String() != want {
+			t.Errorf("%s: got %s, want %s", class, prefix, want)
+		}
+	}
+}
+
+func TestClassPrefixInvalid(t *testing.T) {
+	for _, class := range []string{"", "-", "invalid", "10.1.2", "300.1.2.3/8"} {
+		if _, err := classPrefix(class); err == nil {
+			t.Errorf("%q: expected an error", class)
+		}
+	}
+}
+
+func TestParseAllowlistInvalid(t *testing.T) {
+	if _, err := parseAllowlist([]string{"10.0.0.0/8", "nonsense"}); err == nil {
+		t.Error("expected an error for an invalid allowlist entry")
+	}
+}
+
+// ──────────────────────────────────────────────
+// BlockList
+// ──────────────────────────────────────────────
+
+func TestBlockListThresholdAndAllowlist(t *testing.T) {
+	setupTestGlobals()
+	config.BlockList = BlockListConfig{MinCount: 10, Allowlist: []string{"192.0.2.0/28"}}
+	topIPs := map[string]int{
+		"198.51.100.7": 50,
+		"192.0.2.5":    40, // allowlisted
+		"192.0.2.0/24": 30, // -k C class overlapping the allowlist
+		"203.0.113.9":  9,  // below MinCount
+		"2001:db8::1":  20,
+		"invalid":      99, // not an address
+	}
+	entries, err := Log2Analyze{}.BlockList(topIPs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Prefix.String())
+	}
+	if strings.Join(got, " ") != "198.51.100.7/32 2001:db8::1/128" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestBlockListMinRate(t *testing.T) {
+	setupTestGlobals()
+	config.BlockList = BlockListConfig{MinRate: 1}
+	// -m 5 is 300 seconds, so 1 request/s means at least 300 requests
+	topIPs := map[string]int{"198.51.100.7": 300, "198.51.100.8": 299}
+	entries, err := Log2Analyze{}.BlockList(topIPs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Prefix.Addr().String() != "198.51.100.7" {
+		t.Errorf("got %v", entries)
+	}
+
+}
+
+func TestBlockListMinRateWholeFile(t *testing.T) {
+	setupTestGlobals()
+	config.BlockList = BlockListConfig{MinRate: 0.05}
+	tr := 0
+	timeRange = &tr
+	// with -m 0 the rate is taken over the 570 seconds from the first to the
+	// last request, so 0.05 requests/s means at least 28.5 requests
+	l := timelineTestAnalysis()
+	topIPs := map[string]int{"1.1.1.1": 29, "2.2.2.2": 20}
+	entries, err := l.BlockList(topIPs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Prefix.Addr().String() != "1.1.1.1" {
+		t.Errorf("got %v", entries)
+	}
+}
+
+// ──────────────────────────────────────────────
+// WriteBlockList
+// ──────────────────────────────────────────────
+
+func blockTestEntries(t *testing.T) []blockEntry {
+	t.Helper()
+	var entries []blockEntry
+	for _, class := range []string{"198.51.100.0/24", "2001:db8::1", "10.1.2.3"} {
+		prefix, err := classPrefix(class)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, blockEntry{Prefix: prefix, Count: 1})
+	}
+	return entries
+}
+
+func TestWriteBlockListFormats(t *testing.T) {
+	tests := map[string][]string{
+		"nftables": {
+			"add element inet filter blk { 10.1.2.3, 198.51.100.0/24 }\n",
+			"add element inet filter blk6 { 2001:db8::1 }\n",
+		},
+		"ipset": {
+			"create blk hash:net family inet -exist\nadd blk 10.1.2.3 -exist\nadd blk 198.51.100.0/24 -exist\n",
+			"create blk6 hash:net family inet6 -exist\nadd blk6 2001:db8::1 -exist\n",
+		},
+		"apache": {
+			"<RequireAll>\n    Require all granted\n    Require not ip 10.1.2.3\n    Require not ip 198.51.100.0/24\n    Require not ip 2001:db8::1\n</RequireAll>\n",
+		},
+		"nginx": {
+			"deny 10.1.2.3;\ndeny 198.51.100.0/24;\ndeny 2001:db8::1;\n",
+		},
+		"haproxy": {
+			"\n10.1.2.3\n198.51.100.0/24\n2001:db8::1\n",
+		},
+	}
+	for format, wants := range tests {
+		var buf bytes.Buffer
+		if err := WriteBlockList(&buf, format, blockTestEntries(t), "blk"); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s: missing %q in:\n%s", format, want, buf.String())
+			}
+		}
+	}
+}
+
+func TestWriteBlockListEmptyNftables(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteBlockList(&buf, "nftables", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "add element") {
+		t.Errorf("no elements expected, got:\n%s", buf.String())
+	}
+}
+
+func TestWriteBlockListUnknownFormat(t *testing.T) {
+	if err := WriteBlockList(&bytes.Buffer{}, "pf", nil, ""); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestWriteBlockListFile(t *testing.T) {
+	setupTestGlobals()
+	config.OutputFolder = t.TempDir() + "/"
+	name, count, err := Log2Analyze{}.WriteBlockListFile(map[string]int{"198.51.100.7": 5}, "nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || !strings.HasSuffix(name, ".conf") {
+		t.Errorf("got %s with %d networks", name, count)
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "deny 198.51.100.7;") {
+		t.Errorf("got:\n%s", content)
+	}
+}
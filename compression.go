@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// magic numbers of the supported compression formats. bzip2Magic is
+// followed by the block size, a digit from 1 to 9.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// detectCompression returns the compression format of the data in r
+// ("gzip", "bzip2" or "zstd") based on its magic bytes, or "" for
+// uncompressed data.
+func detectCompression(r io.ReaderAt) string {
+	header := make([]byte, 4)
+	n, _ := r.ReadAt(header, 0)
+	return compressionOf(header[:n])
+}
+
+// compressionOf returns the compression format indicated by the magic bytes
+// at the start of header, or "" if there are none.
+func compressionOf(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(header, bzip2Magic) && len(header) > 3 && header[3] >= '1' && header[3] <= '9':
+		return "bzip2"
+	case bytes.HasPrefix(header, zstdMagic):
+		return "zstd"
+	}
+	return ""
+}
+
+// decompress wraps r in a decompressing reader for the given format.
+// Concatenated gzip members (as written by some logrotate setups) are read
+// as one stream.
+func decompress(format string, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "bzip2":
+		return io.NopCloser(bzip2.NewReader(bufio.NewReader(r))), nil
+	case "zstd":
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const compressionTestLog = `192.168.1.1 - - [10/Feb/2026:12:00:00 +0000] "GET /a HTTP/1.1" 200 100 "-" "-"
+10.0.0.1 - - [10/Feb/2026:12:01:00 +0000] "GET /b HTTP/1.1" 404 100 "-" "-"
+`
+
+// compressionTestLogBzip2 is compressionTestLog compressed with bzip2 -9
+// (the standard library cannot write bzip2).
+const compressionTestLogBzip2 = "QlpoOTFBWSZTWWh6lOIAADZfAEAQUAv1cAPARAoyACAAdBKmmjSAGRoxBKmppmU0AwTQYzBDwQkMXH7xMexHKag6AKPRDvrAxAURzm6EHiHhJSYopvBnFClzQyIwasZCmoiv0KvgiilhiZI8PhC4pYYwYPxdyRThQkGh6lOI"
+
+// compressedTestLogs returns compressionTestLog in every supported format.
+func compressedTestLogs(t *testing.T) map[string][]byte {
+	t.Helper()
+	logs := make(map[string][]byte)
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(compressionTestLog))
+	gw.Close()
+	logs["gzip"] = gz.Bytes()
+
+	bz, err := base64.StdEncoding.DecodeString(compressionTestLogBzip2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs["bzip2"] = bz
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs["zstd"] = enc.EncodeAll([]byte(compressionTestLog), nil)
+	enc.Close()
+	return logs
+}
+
+// ──────────────────────────────────────────────
+// detectCompression / decompress
+// ──────────────────────────────────────────────
+
+func TestDetectCompression(t *testing.T) {
+	for format, data := range compressedTestLogs(t) {
+		if got := detectCompression(bytes.NewReader(data)); got != format {
+			t.Errorf("%s: detected %q", format, got)
+		}
+	}
+	if got := detectCompression(bytes.NewReader([]byte(compressionTestLog))); got != "" {
+		t.Errorf("plain text: detected %q, want none", got)
+	}
+	if got := detectCompression(bytes.NewReader(nil)); got != "" {
+		t.Errorf("empty input: detected %q, want none", got)
+	}
+	for _, text := range []string{"BZh", "BZhello world\n", "BZh0"} {
+		if got := detectCompression(bytes.NewReader([]byte(text))); got != "" {
+			t.Errorf("%q: detected %q, want none", text, got)
+		}
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	for format, data := range compressedTestLogs(t) {
+		r, err := decompress(format, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if string(got) != compressionTestLog {
+			t.Errorf("%s: got %q", format, got)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// RetrieveEntries on compressed files
+// ──────────────────────────────────────────────
+
+func TestRetrieveEntriesCompressed(t *testing.T) {
+	setupTestGlobals()
+
+	for format, data := range compressedTestLogs(t) {
+		// the extension is deliberately misleading, detection uses magic bytes
+		tmpFile := t.TempDir() + "/ssl_access_log.1"
+		if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		l := &Log2Analyze{
+			FileName:   tmpFile,
+			DateLayout: "02/Jan/2006:15:04:05 -0700",
+		}
+		log2Analyze = l
+		l.RetrieveEntries("12:05", 0)
+
+		if l.EntryCount != 2 {
+			t.Errorf("%s: EntryCount got %d, want 2", format, l.EntryCount)
+		}
+		_, codeCounts := l.GetTopIPs()
+		if codeCounts[404] != 1 || codeCounts[0] != 0 {
+			t.Errorf("%s: unexpected code counts %v", format, codeCounts)
+		}
+	}
+}
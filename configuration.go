@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -38,6 +39,22 @@ type RTimeConfig struct {
 // Because User-Agent values can contain spaces (and the flat tokenizer splits
 // on every space after quote removal), the parser joins all tokens from
 // UserAgent to the end of the line. Set to -1 to disable UA parsing.
+//
+// Referer and VHost are the indexes of the Referer and of the virtual host
+// (e.g. Apache %v); set to -1 if the format has none.
+//
+// Format is an alternative to the positions: an Apache LogFormat or nginx
+// log_format string (see compileLogFormat). The line is then split into
+// fields respecting quotes and brackets, so requests and Referers may contain
+// spaces, and the positions above are ignored. compileFormat compiles it.
+//
+// Pattern is the regular expression of LogType regex; its named groups
+// capture the fields (see regexGroups). Only RTime.Unit of the positions is
+// used with it.
+//
+// Keys names the fields of LogType json and logfmt (see FieldKeys). Their
+// numeric durations are divided by RTime.Unit, which defaults to 1 (seconds)
+// for them.
 type LogFormatConfig struct {
 	IP          int         `yaml:"IP"`
 	IPFallback  int         `yaml:"IPFallback"`
@@ -48,17 +65,89 @@ type LogFormatConfig struct {
 	Code        int         `yaml:"Code"`
 	RTime       RTimeConfig `yaml:"RTime"`
 	UserAgent   int         `yaml:"UserAgent"`
+	Referer     int         `yaml:"Referer"`
+	VHost       int         `yaml:"VHost"`
+	Format      string      `yaml:"Format"`
+	Pattern     string      `yaml:"Pattern"`
+	Keys        FieldKeys   `yaml:"Keys"`
+	compiled    lineParser
 }
 
 // ApplicationConfig holds the top-level application settings, typically loaded
 // from a YAML configuration file.
+//
+// MaxEntriesInMemory is the number of matching entries kept in memory (0
+// keeps all of them); beyond it only the entries of the top classes are read
+// again after the scan (see Log2Analyze.retainTop).
+// MaxTrackedClasses bounds the number of distinct classes counted while
+// scanning (0 means unbounded); see Aggregate.
+//
+// SeekTimeWindow enables the binary search for StartTime in time-ordered log
+// files; SeekTolerance is how far timestamps may be out of order around the
+// window boundaries (e.g. "30s").
+//
+// Workers is the number of goroutines parsing a log file in parallel
+// (0 means one per CPU, 1 parses sequentially).
+//
+// FollowInterval is how often the -follow view is redrawn.
+//
+// BlockList configures the firewall block lists written with -block.
+//
+// UserAgentRules are checked before the built-in rules when the User-Agents
+// are classified (see classifyUserAgent).
+//
+// DNSTimeout limits each DNS lookup of the crawler verification (-verify)
+// and of the reverse DNS enrichment.
+//
+// Enrich configures the databases used to annotate the top IPs with their
+// autonomous system and country (-enrich, -by asn).
+//
+// BurstFactor is how many times its median rate a class must exceed within
+// a -timeline bucket to be reported as a burst.
+//
+// Envelope describes a syslog or journald envelope around the lines of
+// LogType (-envelope, -program).
+//
+// MaxRejectRatio is the share of malformed lines above which a run with
+// -strict fails.
 type ApplicationConfig struct {
 	DateLayout          string          `yaml:"DateLayout"`
 	OutputFolder        string          `yaml:"OutputFolder"`
-	DefaultFile2analyze string          `yaml:"DefaultLog2analyze"`
+	DefaultFile2analyze pathList        `yaml:"DefaultLog2analyze"`
 	LogType             string          `yaml:"LogType"`
 	LogFormat           LogFormatConfig `yaml:"LogFormat"`
 	Logcfg              LogConfig       `yaml:"LogConfig"`
+	MaxEntriesInMemory  int             `yaml:"MaxEntriesInMemory"`
+	MaxTrackedClasses   int             `yaml:"MaxTrackedClasses"`
+	SeekTimeWindow      bool            `yaml:"SeekTimeWindow"`
+	SeekTolerance       time.Duration   `yaml:"SeekTolerance"`
+	Workers             int             `yaml:"Workers"`
+	FollowInterval      time.Duration   `yaml:"FollowInterval"`
+	BlockList           BlockListConfig `yaml:"BlockList"`
+	BurstFactor         float64         `yaml:"BurstFactor"`
+	UserAgentRules      []UserAgentRule `yaml:"UserAgentRules"`
+	DNSTimeout          time.Duration   `yaml:"DNSTimeout"`
+	Enrich              EnrichConfig    `yaml:"Enrich"`
+	Envelope            EnvelopeConfig  `yaml:"Envelope"`
+	MaxRejectRatio      float64         `yaml:"MaxRejectRatio"`
+}
+
+// pathList is a list of file paths or glob patterns. In YAML it may be given
+// as a single string or as a sequence.
+type pathList []string
+
+// UnmarshalYAML accepts a scalar as well as a sequence of paths.
+func (p *pathList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = pathList{value.Value}
+		return nil
+	}
+	var paths []string
+	if err := value.Decode(&paths); err != nil {
+		return err
+	}
+	*p = paths
+	return nil
 }
 
 // LogConfig contains settings for the application's own log output.
@@ -70,7 +159,8 @@ type LogConfig struct {
 // apacheLogFormat returns the LogFormatConfig for Apache Combined / Apache-Atmire
 // logs, using flat tokenization (quote removal + space split).
 //
-//	[0]=IP [1]=- [2]=user [3]=[ts1 [4]=ts2] [5]=method [6]=request [7]=protocol [8]=code …
+//	[0]=IP [1]=- [2]=user [3]=[ts1 [4]=ts2] [5]=method [6]=request [7]=protocol [8]=code
+//	[9]=bytes [10]=referer [11]=user-agent …
 func apacheLogFormat() LogFormatConfig {
 	return LogFormatConfig{
 		IP:         0,
@@ -81,9 +171,22 @@ func apacheLogFormat() LogFormatConfig {
 		Code:       8,
 		RTime:      RTimeConfig{Position: 0, Unit: 0},
 		UserAgent:  11,
+		Referer:    10,
+		VHost:      -1,
 	}
 }
 
+// customLogFormatDefaults returns the LogFormatConfig a LogFormat from the
+// config file starts from: the positions of apacheLogFormat, but without the
+// optional Referer and VHost, so a custom format without these columns does
+// not read another field as the referer.
+func customLogFormatDefaults() LogFormatConfig {
+	lf := apacheLogFormat()
+	lf.Referer = -1
+	lf.VHost = -1
+	return lf
+}
+
 // apacheCommonLogFormat returns the LogFormatConfig for the Apache Common log
 // format (no Referer or User-Agent fields). Field positions are identical to
 // Apache Combined; only UserAgent is disabled.
@@ -99,6 +202,8 @@ func apacheCommonLogFormat() LogFormatConfig {
 		Code:       8,
 		RTime:      RTimeConfig{Position: 0, Unit: 0},
 		UserAgent:  -1,
+		Referer:    -1,
+		VHost:      -1,
 	}
 }
 
@@ -119,6 +224,8 @@ func haproxyHTTPLogFormat() LogFormatConfig {
 		Code:        5,
 		RTime:       RTimeConfig{Position: 0, Unit: 0},
 		UserAgent:   -1,
+		Referer:     -1,
+		VHost:       -1,
 	}
 }
 
@@ -137,24 +244,76 @@ func rosettaLogFormat() LogFormatConfig {
 		Code:       9,
 		RTime:      RTimeConfig{Position: 11, Unit: 1000},
 		UserAgent:  16,
+		Referer:    -1,
+		VHost:      -1,
 	}
 }
 
+// logTypePresets maps the log types with predefined field positions to their
+// LogFormatConfig. apache_atmire and nginx_combined are aliases of
+// apache_combined.
+var logTypePresets = map[string]func() LogFormatConfig{
+	"apache_combined": apacheLogFormat,
+	"apache_atmire":   apacheLogFormat,
+	"nginx_combined":  apacheLogFormat,
+	"apache_common":   apacheCommonLogFormat,
+	"haproxy_http":    haproxyHTTPLogFormat,
+	"rosetta":         rosettaLogFormat,
+}
+
 // applyLogTypePreset overwrites LogFormat with the predefined field positions
-// for the given LogType. For "custom" (or any unknown type) the LogFormat
-// from the config file is used unchanged.
+// for the given LogType (see logTypePresets). For "custom", "regex", "json"
+// and "logfmt" (or any unknown type) the LogFormat from the config file is
+// used unchanged; "auto" is resolved later by Log2Analyze.AutoDetect.
 func (c *ApplicationConfig) applyLogTypePreset() {
-	switch c.LogType {
-	case "apache_combined", "apache_atmire", "nginx_combined", "logfmt":
-		c.LogFormat = apacheLogFormat()
-	case "apache_common":
-		c.LogFormat = apacheCommonLogFormat()
-	case "haproxy_http":
-		c.LogFormat = haproxyHTTPLogFormat()
-	case "rosetta":
-		c.LogFormat = rosettaLogFormat()
-	// "custom" and unknown types: leave LogFormat as configured
+	if preset, ok := logTypePresets[c.LogType]; ok {
+		c.LogFormat = preset()
+	}
+}
+
+// compileFormat compiles LogFormat.Pattern for LogType regex, LogFormat.Keys
+// for json and logfmt, or else LogFormat.Format, if set, taking the unit of
+// the response time from it. With an Envelope the lines are unwrapped
+// before they are parsed.
+func (c *ApplicationConfig) compileFormat() error {
+	lf := &c.LogFormat
+	lf.compiled = nil
+	switch {
+	case c.LogType == "regex":
+		compiled, err := compileRegexFormat(lf.Pattern)
+		if err != nil {
+			return err
+		}
+		lf.compiled = compiled
+	case c.LogType == "json" || c.LogType == "logfmt":
+		if lf.RTime.Unit == 0 {
+			lf.RTime.Unit = 1
+		}
+		compiled, err := compileStructuredFormat(c.LogType, lf.Keys, lf.RTime.Unit)
+		if err != nil {
+			return err
+		}
+		lf.compiled = compiled
+	case lf.Format != "":
+		compiled, err := compileLogFormat(lf.Format)
+		if err != nil {
+			return err
+		}
+		lf.compiled = compiled
+		lf.RTime = RTimeConfig{Unit: compiled.rtimeUnit}
 	}
+	if c.Envelope.Type != "" {
+		inner := lf.compiled
+		if inner == nil {
+			inner = positionFormat{}
+		}
+		compiled, err := newEnvelopeFormat(c.Envelope, inner)
+		if err != nil {
+			return err
+		}
+		lf.compiled = compiled
+	}
+	return nil
 }
 
 // Initialize populates the configuration by first setting defaults and then
@@ -180,16 +339,31 @@ func (config *ApplicationConfig) setDefaults() {
 		DateLayout:   "02/Jan/2006:15:04:05 -0700",
 		OutputFolder: "./output/",
 		LogType:      "apache_combined",
-		LogFormat:    apacheLogFormat(),
+		LogFormat:    customLogFormatDefaults(),
 		Logcfg: LogConfig{
 			LogLevel:  "INFO",
 			LogFolder: "./logs/",
 		},
+		MaxEntriesInMemory: 500000,
+		MaxTrackedClasses:  200000,
+		SeekTimeWindow:     true,
+		SeekTolerance:      30 * time.Second,
+		FollowInterval:     10 * time.Second,
+		BurstFactor:        5,
+		DNSTimeout:         2 * time.Second,
+		MaxRejectRatio:     0.01,
+		BlockList: BlockListConfig{
+			Allowlist: []string{"127.0.0.0/8", "::1"},
+			SetName:   "topfive_block",
+		},
 	}
 }
 
 // CheckConfig normalises directory paths (ensuring trailing slashes),
-// applies the log-type preset, and verifies that required directories exist.
+// applies the log-type preset and verifies that required directories exist.
+// The log format is not compiled here: main compiles it with compileFormat
+// once -lt and -envelope are applied, so a broken format of a log type that
+// is overridden does not abort the run.
 func (c *ApplicationConfig) CheckConfig() {
 	c.applyLogTypePreset()
 	checknaddtrailingslash(&c.Logcfg.LogFolder)
@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // ──────────────────────────────────────────────
@@ -23,7 +26,7 @@ func TestSetDefaults(t *testing.T) {
 	if cfg.LogType != "apache_combined" {
 		t.Errorf("LogType: got %q, want %q", cfg.LogType, "apache_combined")
 	}
-	want := apacheLogFormat()
+	want := customLogFormatDefaults()
 	if cfg.LogFormat != want {
 		t.Errorf("LogFormat: got %+v, want %+v", cfg.LogFormat, want)
 	}
@@ -132,6 +135,157 @@ LogConfig:
 	}
 }
 
+func TestInitializeCustomFormatWithoutReferer(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "logs") + "/"
+	outDir := filepath.Join(dir, "output") + "/"
+	os.MkdirAll(logDir, 0750)
+	os.MkdirAll(outDir, 0750)
+
+	yamlContent := `LogType: "custom"
+OutputFolder: "` + outDir + `"
+LogFormat:
+  IP: 0
+  TimeStamp: 1
+  Code: 4
+LogConfig:
+  LogFolder: "` + logDir + `"
+`
+	cfgFile := filepath.Join(dir, "custom.yml")
+	if err := os.WriteFile(cfgFile, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg ApplicationConfig
+	cfg.Initialize(&cfgFile)
+
+	if cfg.LogFormat.Referer != -1 || cfg.LogFormat.VHost != -1 {
+		t.Errorf("a custom format without a referer should not inherit one: %+v", cfg.LogFormat)
+	}
+
+	cfg.LogType = "apache_combined"
+	cfg.applyLogTypePreset()
+	if cfg.LogFormat.Referer != 10 {
+		t.Errorf("apache_combined Referer: got %d, want 10", cfg.LogFormat.Referer)
+	}
+}
+
+func TestInitializeBrokenPatternOverridden(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "logs") + "/"
+	outDir := filepath.Join(dir, "output") + "/"
+	os.MkdirAll(logDir, 0750)
+	os.MkdirAll(outDir, 0750)
+
+	yamlContent := `LogType: "regex"
+OutputFolder: "` + outDir + `"
+LogFormat:
+  Pattern: '^(?P<ip>\S+'
+LogConfig:
+  LogFolder: "` + logDir + `"
+`
+	cfgFile := filepath.Join(dir, "regex.yml")
+	if err := os.WriteFile(cfgFile, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg ApplicationConfig
+	cfg.Initialize(&cfgFile) // must not exit on the broken pattern
+
+	if err := cfg.compileFormat(); err == nil {
+		t.Error("expected an error for the broken pattern of LogType regex")
+	}
+
+	// -lt apache_combined replaces the unused regex type
+	cfg.LogType = "apache_combined"
+	cfg.applyLogTypePreset()
+	if err := cfg.compileFormat(); err != nil {
+		t.Errorf("apache_combined after override: %v", err)
+	}
+}
+
+func TestInitializeIncompleteKeysOverridden(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "logs") + "/"
+	outDir := filepath.Join(dir, "output") + "/"
+	os.MkdirAll(logDir, 0750)
+	os.MkdirAll(outDir, 0750)
+
+	yamlContent := `LogType: "json"
+OutputFolder: "` + outDir + `"
+LogFormat:
+  Keys:
+    Request: "uri"
+LogConfig:
+  LogFolder: "` + logDir + `"
+`
+	cfgFile := filepath.Join(dir, "json.yml")
+	if err := os.WriteFile(cfgFile, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg ApplicationConfig
+	cfg.Initialize(&cfgFile) // must not exit on the missing IP and TimeStamp keys
+
+	if err := cfg.compileFormat(); err == nil {
+		t.Error("expected an error for json without IP and TimeStamp keys")
+	}
+
+	// -lt rosetta replaces the unused json type
+	cfg.LogType = "rosetta"
+	cfg.applyLogTypePreset()
+	if err := cfg.compileFormat(); err != nil {
+		t.Errorf("rosetta after override: %v", err)
+	}
+}
+
+func TestInitializeSeekSettings(t *testing.T) {
+	dir := t.TempDir()
+	logDir := filepath.Join(dir, "logs") + "/"
+	outDir := filepath.Join(dir, "output") + "/"
+	os.MkdirAll(logDir, 0750)
+	os.MkdirAll(outDir, 0750)
+
+	yamlContent := `OutputFolder: "` + outDir + `"
+SeekTimeWindow: false
+SeekTolerance: 2m
+LogConfig:
+  LogFolder: "` + logDir + `"
+`
+	cfgFile := filepath.Join(dir, "seek.yml")
+	if err := os.WriteFile(cfgFile, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg ApplicationConfig
+	cfg.Initialize(&cfgFile)
+
+	if cfg.SeekTimeWindow {
+		t.Error("SeekTimeWindow: got true, want false")
+	}
+	if cfg.SeekTolerance != 2*time.Minute {
+		t.Errorf("SeekTolerance: got %v, want 2m", cfg.SeekTolerance)
+	}
+}
+
+func TestDefaultLog2analyzeScalarAndList(t *testing.T) {
+	var cfg ApplicationConfig
+	if err := yaml.Unmarshal([]byte("DefaultLog2analyze: /var/log/a.log\n"), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.DefaultFile2analyze) != 1 || cfg.DefaultFile2analyze[0] != "/var/log/a.log" {
+		t.Errorf("scalar: got %v", cfg.DefaultFile2analyze)
+	}
+
+	list := "DefaultLog2analyze:\n  - /var/log/a.log\n  - /var/log/*.log\n"
+	if err := yaml.Unmarshal([]byte(list), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.DefaultFile2analyze) != 2 || cfg.DefaultFile2analyze[1] != "/var/log/*.log" {
+		t.Errorf("list: got %v", cfg.DefaultFile2analyze)
+	}
+}
+
 // ──────────────────────────────────────────────
 // CheckConfig
 // ──────────────────────────────────────────────
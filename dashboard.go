@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// dashboardRow holds the statistics of one class shown in the dashboard.
+// UAClass is the most frequent User-Agent class of its requests.
+type dashboardRow struct {
+	Class    string
+	Count    int
+	Errors   int
+	MaxRTime float64
+	UAClass  string
+}
+
+// dashboardData is a snapshot of the analysis shown by the dashboard.
+// perSecond counts the requests per Unix second; lastSecond is the newest
+// second seen. requests returns the detail lines of a class for the
+// drill-down view.
+type dashboardData struct {
+	title      string
+	total      int
+	rows       []dashboardRow
+	perSecond  map[int64]int
+	lastSecond int64
+	requests   func(class string) []string
+}
+
+// collectDashboardData computes the dashboard statistics from the entries
+// that each passes to its callback.
+func collectDashboardData(title string, each func(func(LogEntry))) dashboardData {
+	data := dashboardData{title: title, perSecond: make(map[int64]int)}
+	rows := make(map[string]*dashboardRow)
+	uaClasses := make(map[string]map[string]int)
+	each(func(entry LogEntry) {
+		data.total++
+		row, ok := rows[entry.Class]
+		if !ok {
+			row = &dashboardRow{Class: entry.Class}
+			rows[entry.Class] = row
+			uaClasses[entry.Class] = make(map[string]int)
+		}
+		row.Count++
+		uaClasses[entry.Class][entry.UAClass]++
+		if entry.Code >= 400 {
+			row.Errors++
+		}
+		if rt, ok := rtimeSeconds(entry.RTime); ok && rt > row.MaxRTime {
+			row.MaxRTime = rt
+		}
+		if !entry.TimeStamp.IsZero() {
+			second := entry.TimeStamp.Unix()
+			data.perSecond[second]++
+			if second > data.lastSecond {
+				data.lastSecond = second
+			}
+		}
+	})
+	for class, row := range rows {
+		row.UAClass = sortedByCount(uaClasses[class])[0]
+		data.rows = append(data.rows, *row)
+	}
+	return data
+}
+
+// dashboard columns the table can be sorted by
+const (
+	sortByCount = iota
+	sortByErrorRate
+	sortByMaxRTime
+	sortByClass
+	sortColumns
+)
+
+var sortColumnNames = [sortColumns]string{"count", "error rate", "max response time", "class"}
+
+// dashboard is the state of the interactive terminal view: the table of
+// classes, or the requests of one class (detail) when drilled down. The
+// requests are fetched once when drilling down and on each refresh, not on
+// every redraw.
+type dashboard struct {
+	sortBy    int
+	selected  int
+	top       int
+	detail    string
+	requests  []string
+	detailTop int
+	width     int
+	height    int
+}
+
+// sortRows orders rows by the selected column, descending (class ascending).
+func (d *dashboard) sortRows(rows []dashboardRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch d.sortBy {
+		case sortByErrorRate:
+			ra, rb := float64(a.Errors)/float64(a.Count), float64(b.Errors)/float64(b.Count)
+			if ra != rb {
+				return ra > rb
+			}
+		case sortByMaxRTime:
+			if a.MaxRTime != b.MaxRTime {
+				return a.MaxRTime > b.MaxRTime
+			}
+		case sortByClass:
+			return a.Class < b.Class
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Class < b.Class
+	})
+}
+
+// tableHeight is the number of table rows that fit on the screen.
+func (d *dashboard) tableHeight() int {
+	// title, separator, column header, sparkline (2), help
+	return max(d.height-6, 1)
+}
+
+// handleKey updates the view for key. It reports whether the dashboard
+// should be closed.
+func (d *dashboard) handleKey(key string, data dashboardData) (quit bool) {
+	page := d.tableHeight()
+	if d.detail != "" {
+		switch key {
+		case "q", "ctrl-c":
+			return true
+		case "esc", "left", "backspace":
+			d.detail, d.requests = "", nil
+		case "up", "k":
+			d.detailTop--
+		case "down", "j":
+			d.detailTop++
+		case "pgup":
+			d.detailTop -= page
+		case "pgdown", " ":
+			d.detailTop += page
+		case "home", "g":
+			d.detailTop = 0
+		}
+		d.detailTop = max(d.detailTop, 0)
+		return false
+	}
+	switch key {
+	case "q", "esc", "ctrl-c":
+		return true
+	case "up", "k":
+		d.selected--
+	case "down", "j":
+		d.selected++
+	case "pgup":
+		d.selected -= page
+	case "pgdown", " ":
+		d.selected += page
+	case "home", "g":
+		d.selected = 0
+	case "end", "G":
+		d.selected = len(data.rows) - 1
+	case "s", "tab":
+		d.sortBy = (d.sortBy + 1) % sortColumns
+	case "1", "2", "3", "4":
+		d.sortBy = int(key[0] - '1')
+	case "enter", "right":
+		if d.selected < len(data.rows) {
+			rows := append([]dashboardRow(nil), data.rows...)
+			d.sortRows(rows)
+			d.detail = rows[d.selected].Class
+			d.requests = data.requests(d.detail)
+			d.detailTop = 0
+		}
+	}
+	d.clamp(len(data.rows))
+	return false
+}
+
+// clamp keeps the selection within the rows and scrolls it into view.
+func (d *dashboard) clamp(rows int) {
+	d.selected = max(min(d.selected, rows-1), 0)
+	if d.selected < d.top {
+		d.top = d.selected
+	}
+	if page := d.tableHeight(); d.selected >= d.top+page {
+		d.top = d.selected - page + 1
+	}
+}
+
+// sparkBlocks are the bar characters of the sparkline, lowest first.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values as a line of bar characters scaled to the
+// largest value.
+func sparkline(values []int) string {
+	peak := 0
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		switch {
+		case v == 0:
+			b.WriteRune(' ')
+		default:
+			b.WriteRune(sparkBlocks[v*(len(sparkBlocks)-1)/peak])
+		}
+	}
+	return b.String()
+}
+
+// fit cuts s to width runes.
+func fit(s string, width int) string {
+	if r := []rune(s); len(r) > width {
+		return string(r[:max(width, 0)])
+	}
+	return s
+}
+
+// render returns the screen lines for data.
+func (d *dashboard) render(data dashboardData) []string {
+	if d.detail != "" {
+		return d.renderDetail(data)
+	}
+	rows := append([]dashboardRow(nil), data.rows...)
+	d.sortRows(rows)
+	d.clamp(len(rows))
+
+	lines := []string{
+		fit(fmt.Sprintf("topFive  %s  %d requests  %d classes  sorted by %s", data.title, data.total, len(rows), sortColumnNames[d.sortBy]), d.width),
+		strings.Repeat("=", d.width),
+		fit(fmt.Sprintf("%5s  %-39s %9s %7s %7s %9s  %s", "#", "Class", "Count", "Share", "Errors", "Max RT", "Agent"), d.width),
+	}
+	for i := d.top; i < len(rows) && i < d.top+d.tableHeight(); i++ {
+		row := rows[i]
+		share := 100 * float64(row.Count) / float64(max(data.total, 1))
+		errRate := 100 * float64(row.Errors) / float64(row.Count)
+		line := fit(fmt.Sprintf("%5d  %-39s %9d %6.1f%% %6.1f%% %8.1fs  %s", i+1, row.Class, row.Count, share, errRate, row.MaxRTime, row.UAClass), d.width)
+		if i == d.selected {
+			line = "\033[7m" + line + "\033[0m"
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < d.height-3 {
+		lines = append(lines, "")
+	}
+
+	width := max(d.width-12, 1)
+	values := make([]int, width)
+	peak := 0
+	for i := range values {
+		values[i] = data.perSecond[data.lastSecond-int64(width-1-i)]
+		peak = max(peak, values[i])
+	}
+	lines = append(lines,
+		fit(fmt.Sprintf("requests per second, last %d s (peak %d/s)", width, peak), d.width),
+		fit("req/s      "+sparkline(values), d.width),
+		fit("↑↓ select  enter requests  s/1-4 sort  q quit", d.width),
+	)
+	return lines
+}
+
+// renderDetail returns the screen lines of the drill-down view.
+func (d *dashboard) renderDetail(data dashboardData) []string {
+	requests := d.requests
+	page := d.tableHeight() + 2
+	d.detailTop = max(min(d.detailTop, len(requests)-page), 0)
+	lines := []string{
+		fit(fmt.Sprintf("topFive  %s  requests of %s: %d", data.title, d.detail, len(requests)), d.width),
+		strings.Repeat("=", d.width),
+	}
+	for i := d.detailTop; i < len(requests) && i < d.detailTop+page; i++ {
+		lines = append(lines, fit(strings.ReplaceAll(strings.TrimSuffix(requests[i], "\n"), "\t", "  "), d.width))
+	}
+	for len(lines) < d.height-1 {
+		lines = append(lines, "")
+	}
+	return append(lines, fit("↑↓ scroll  esc back  q quit", d.width))
+}
+
+// parseKey returns the name of the key sent by the terminal as b.
+func parseKey(b []byte) string {
+	switch string(b) {
+	case "\x1b[A", "\x1bOA":
+		return "up"
+	case "\x1b[B", "\x1bOB":
+		return "down"
+	case "\x1b[C", "\x1bOC":
+		return "right"
+	case "\x1b[D", "\x1bOD":
+		return "left"
+	case "\x1b[5~":
+		return "pgup"
+	case "\x1b[6~":
+		return "pgdown"
+	case "\x1b[H", "\x1b[1~", "\x1bOH":
+		return "home"
+	case "\x1b[F", "\x1b[4~", "\x1bOF":
+		return "end"
+	case "\x1b":
+		return "esc"
+	case "\r", "\n":
+		return "enter"
+	case "\t":
+		return "tab"
+	case "\x7f", "\b":
+		return "backspace"
+	case "\x03":
+		return "ctrl-c"
+	}
+	return string(b)
+}
+
+// RunDashboard shows the interactive dashboard on the terminal in and out
+// until the user quits. snapshot is called for the data to show; with a
+// refresh interval > 0 it is called again at that interval (live mode).
+func RunDashboard(snapshot func() dashboardData, refresh time.Duration, in, out *os.File) error {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("the dashboard needs a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	// alternate screen, hidden cursor
+	io.WriteString(out, "\033[?1049h\033[?25l")
+	defer io.WriteString(out, "\033[?25h\033[?1049l")
+
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- parseKey(buf[:n])
+		}
+	}()
+	var tick <-chan time.Time
+	if refresh > 0 {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	d := &dashboard{}
+	data := snapshot()
+	for {
+		d.width, d.height, err = term.GetSize(int(out.Fd()))
+		if err != nil {
+			d.width, d.height = 80, 24
+		}
+		io.WriteString(out, "\033[H\033[2J"+strings.Join(d.render(data), "\r\n"))
+		select {
+		case key, ok := <-keys:
+			if !ok || d.handleKey(key, data) {
+				return nil
+			}
+		case <-tick:
+			data = snapshot()
+			if d.detail != "" {
+				d.requests = data.requests(d.detail)
+			}
+		}
+	}
+}
+
+// dashboardSnapshot returns the dashboard data of a one-shot analysis.
+func (l *Log2Analyze) dashboardSnapshot() dashboardData {
+	title := strings.Join(l.files(), ", ")
+	if *timeRange != 0 {
+		title += "  " + l.StartTime.Format("2006-01-02 15:04") + " - " + l.EndTime.Format("15:04")
+	}
+	data := collectDashboardData(title, l.EachEntry)
+	if l.keep != nil {
+		// only the entries of the top classes are retained
+		agg := l.aggregate()
+		data.total, data.perSecond, data.lastSecond = agg.Total, agg.Seconds, agg.Last.Unix()
+	}
+	data.requests = func(class string) []string {
+		var lines []string
+		l.EachEntry(func(entry LogEntry) {
+			if entry.Class == class {
+				lines = append(lines, l.formatEntryLine(entry))
+			}
+		})
+		return lines
+	}
+	return data
+}
+
+// snapshot returns the dashboard data of the current follow window.
+func (f *follower) snapshot() dashboardData {
+	f.poll(time.Now())
+	title := strings.Join(f.l.files(), ", ") + "  live"
+	if f.window.span > 0 {
+		title += ", last " + f.window.span.String()
+	}
+	entries := append([]LogEntry(nil), f.window.entries...)
+	each := func(fn func(LogEntry)) {
+		for _, entry := range entries {
+			fn(entry)
+		}
+	}
+	data := collectDashboardData(title, each)
+	data.requests = func(class string) []string {
+		var lines []string
+		each(func(entry LogEntry) {
+			if entry.Class == class {
+				lines = append(lines, f.l.formatEntryLine(entry))
+			}
+		})
+		return lines
+	}
+	return data
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// dashboardTestData returns dashboard data for three classes.
+func dashboardTestData() dashboardData {
+	ts := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	entries := []LogEntry{
+		{Class: "1.1.1.1", Code: 200, RTime: "100", TimeStamp: ts, Request: "/a"},
+		{Class: "1.1.1.1", Code: 200, RTime: "200", TimeStamp: ts, Request: "/b"},
+		{Class: "1.1.1.1", Code: 200, RTime: "300", TimeStamp: ts.Add(time.Second), Request: "/c"},
+		{Class: "2.2.2.2", Code: 500, RTime: "9000", TimeStamp: ts.Add(2 * time.Second), Request: "/slow"},
+		{Class: "2.2.2.2", Code: 200, RTime: "100", TimeStamp: ts.Add(2 * time.Second), Request: "/d"},
+		{Class: "3.3.3.3", Code: 404, TimeStamp: ts.Add(3 * time.Second), Request: "/e"},
+	}
+	each := func(fn func(LogEntry)) {
+		for _, e := range entries {
+			fn(e)
+		}
+	}
+	data := collectDashboardData("test.log", each)
+	data.requests = func(class string) []string {
+		var lines []string
+		each(func(e LogEntry) {
+			if e.Class == class {
+				lines = append(lines, e.Request)
+			}
+		})
+		return lines
+	}
+	return data
+}
+
+// ──────────────────────────────────────────────
+// collectDashboardData
+// ──────────────────────────────────────────────
+
+func TestCollectDashboardData(t *testing.T) {
+	setupTestGlobals()
+	data := dashboardTestData()
+
+	if data.total != 6 || len(data.rows) != 3 {
+		t.Fatalf("got total %d and %d rows, want 6 and 3", data.total, len(data.rows))
+	}
+	for _, row := range data.rows {
+		if row.Class == "2.2.2.2" && (row.Count != 2 || row.Errors != 1 || row.MaxRTime != 9.0) {
+			t.Errorf("2.2.2.2: got %+v", row)
+		}
+	}
+	start := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC).Unix()
+	if data.perSecond[start] != 2 || data.perSecond[start+2] != 2 || data.lastSecond != start+3 {
+		t.Errorf("perSecond: got %v, last %d", data.perSecond, data.lastSecond)
+	}
+}
+
+// ──────────────────────────────────────────────
+// dashboard view
+// ──────────────────────────────────────────────
+
+func TestDashboardSorting(t *testing.T) {
+	setupTestGlobals()
+	data := dashboardTestData()
+	d := &dashboard{width: 100, height: 20}
+
+	firstRow := func() string {
+		rows := append([]dashboardRow(nil), data.rows...)
+		d.sortRows(rows)
+		return rows[0].Class
+	}
+	if got := firstRow(); got != "1.1.1.1" {
+		t.Errorf("by count: got %s first", got)
+	}
+	d.handleKey("2", data)
+	if got := firstRow(); got != "3.3.3.3" {
+		t.Errorf("by error rate: got %s first", got)
+	}
+	d.handleKey("s", data)
+	if got := firstRow(); got != "2.2.2.2" {
+		t.Errorf("by max response time: got %s first", got)
+	}
+}
+
+func TestDashboardNavigationAndDrillDown(t *testing.T) {
+	setupTestGlobals()
+	data := dashboardTestData()
+	d := &dashboard{width: 100, height: 20}
+
+	d.handleKey("up", data)
+	if d.selected != 0 {
+		t.Errorf("selection should not go above the first row, got %d", d.selected)
+	}
+	d.handleKey("down", data)
+	d.handleKey("down", data)
+	d.handleKey("down", data)
+	if d.selected != 2 {
+		t.Errorf("selection should stop at the last row, got %d", d.selected)
+	}
+
+	fetched := 0
+	requests := data.requests
+	data.requests = func(class string) []string {
+		fetched++
+		return requests(class)
+	}
+	d.handleKey("up", data)
+	d.handleKey("enter", data)
+	if d.detail != "2.2.2.2" {
+		t.Fatalf("drill-down: got %q, want 2.2.2.2", d.detail)
+	}
+	screen := strings.Join(d.render(data), "\n")
+	if !strings.Contains(screen, "/slow") || strings.Contains(screen, "/a") {
+		t.Errorf("detail view should list only the requests of 2.2.2.2, got:\n%s", screen)
+	}
+	d.handleKey("down", data)
+	d.render(data)
+	if fetched != 1 {
+		t.Errorf("the requests should be fetched once when drilling down, got %d times", fetched)
+	}
+
+	if d.handleKey("esc", data) || d.detail != "" || d.requests != nil {
+		t.Error("esc should go back to the table and drop the requests")
+	}
+	if !d.handleKey("q", data) {
+		t.Error("q should quit")
+	}
+}
+
+func TestDashboardRender(t *testing.T) {
+	setupTestGlobals()
+	data := dashboardTestData()
+	d := &dashboard{width: 90, height: 12}
+
+	lines := d.render(data)
+	if len(lines) != 12 {
+		t.Errorf("expected %d lines, got %d", 12, len(lines))
+	}
+	screen := strings.Join(lines, "\n")
+	for _, want := range []string{"test.log", "6 requests", "1.1.1.1", "50.0%", "\033[7m", "req/s"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("screen missing %q:\n%s", want, screen)
+		}
+	}
+	for _, line := range lines {
+		if n := len([]rune(strings.NewReplacer("\033[7m", "", "\033[0m", "").Replace(line))); n > 90 {
+			t.Errorf("line wider than the terminal (%d): %q", n, line)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// sparkline / parseKey
+// ──────────────────────────────────────────────
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]int{0, 1, 4, 8}); got != " ▁▄█" {
+		t.Errorf("got %q", got)
+	}
+	if got := sparkline([]int{0, 0}); got != "  " {
+		t.Errorf("all zero: got %q", got)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	cases := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1b[6~": "pgdown", "\r": "enter",
+		"\x1b": "esc", "\x03": "ctrl-c", "q": "q",
+	}
+	for in, want := range cases {
+		if got := parseKey([]byte(in)); got != want {
+			t.Errorf("parseKey(%q): got %q, want %q", in, got, want)
+		}
+	}
+}
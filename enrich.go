@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// EnrichConfig configures the annotation of the top IPs with -enrich and the
+// asn and country fields of -by.
+//
+// ASNDatabase is a MaxMind-format ASN database (e.g. GeoLite2-ASN.mmdb), a
+// GeoLite2-ASN-Blocks CSV file or an ip2asn TSV file (iptoasn.com).
+// CountryDatabase is a MaxMind-format country or city database (e.g.
+// GeoLite2-Country.mmdb). ReverseDNS adds the PTR names of the top IPs.
+type EnrichConfig struct {
+	ASNDatabase     string `yaml:"ASNDatabase"`
+	CountryDatabase string `yaml:"CountryDatabase"`
+	ReverseDNS      bool   `yaml:"ReverseDNS"`
+}
+
+// ipInfo is what is known about an address: its PTR name, its autonomous
+// system and its country (ISO code).
+type ipInfo struct {
+	PTR     string
+	ASN     uint
+	Org     string
+	Country string
+}
+
+// String formats info for the text output, e.g.
+// "AS15169 Google LLC, US, crawl-66-249-66-1.googlebot.com".
+func (info ipInfo) String() string {
+	var parts []string
+	if info.ASN != 0 {
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("AS%d %s", info.ASN, info.Org)))
+	}
+	if info.Country != "" {
+		parts = append(parts, info.Country)
+	}
+	if info.PTR != "" {
+		parts = append(parts, info.PTR)
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// asnSource finds the autonomous system of an address. country is empty if
+// the source does not know it.
+type asnSource interface {
+	lookupASN(addr netip.Addr) (asn uint, org, country string, ok bool)
+}
+
+// Enricher annotates addresses from the configured databases. A nil
+// Enricher knows nothing.
+type Enricher struct {
+	asn      asnSource
+	country  *maxminddb.Reader
+	resolver Resolver
+	timeout  time.Duration
+}
+
+// ipDatabases is the Enricher used by the asn and country fields of -by; it
+// is set up by main.
+var ipDatabases *Enricher
+
+// newEnricher opens the databases of cfg. PTR names are looked up with
+// resolver if cfg.ReverseDNS is set.
+func newEnricher(cfg EnrichConfig, resolver Resolver, timeout time.Duration) (*Enricher, error) {
+	e := &Enricher{timeout: timeout}
+	if cfg.ReverseDNS {
+		e.resolver = resolver
+	}
+	if cfg.ASNDatabase != "" {
+		source, err := openASNDatabase(cfg.ASNDatabase)
+		if err != nil {
+			return nil, err
+		}
+		e.asn = source
+	}
+	if cfg.CountryDatabase != "" {
+		reader, err := maxminddb.Open(cfg.CountryDatabase)
+		if err != nil {
+			return nil, fmt.Errorf("country database %s: %w", cfg.CountryDatabase, err)
+		}
+		e.country = reader
+	}
+	return e, nil
+}
+
+// Close closes the databases.
+func (e *Enricher) Close() {
+	if e == nil {
+		return
+	}
+	if db, ok := e.asn.(*mmdbASN); ok {
+		db.reader.Close()
+	}
+	if e.country != nil {
+		e.country.Close()
+	}
+}
+
+// Lookup returns what the databases know about addr.
+func (e *Enricher) Lookup(addr netip.Addr) ipInfo {
+	var info ipInfo
+	if e == nil {
+		return info
+	}
+	addr = addr.Unmap()
+	if e.asn != nil {
+		info.ASN, info.Org, info.Country, _ = e.asn.lookupASN(addr)
+	}
+	if e.country != nil {
+		var record struct {
+			Country struct {
+				ISOCode string `maxminddb:"iso_code"`
+			} `maxminddb:"country"`
+			RegisteredCountry struct {
+				ISOCode string `maxminddb:"iso_code"`
+			} `maxminddb:"registered_country"`
+		}
+		if err := e.country.Lookup(net.IP(addr.AsSlice()), &record); err == nil {
+			country := record.Country.ISOCode
+			if country == "" {
+				country = record.RegisteredCountry.ISOCode
+			}
+			if country != "" {
+				info.Country = country
+			}
+		}
+	}
+	return info
+}
+
+// classAddress returns the address a class stands for: the address itself,
+// or the network address of a CIDR. single is false for networks, which have
+// no PTR name.
+func classAddress(class string) (addr netip.Addr, single, ok bool) {
+	if prefix, err := netip.ParsePrefix(class); err == nil {
+		return prefix.Addr(), prefix.IsSingleIP(), true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(class, "[]"))
+	return addr, true, err == nil
+}
+
+// Annotate returns the ipInfo of each of classes that is an IP address or a
+// network. PTR names are looked up in parallel, each limited to the timeout.
+func (e *Enricher) Annotate(classes []string) map[string]ipInfo {
+	infos := make(map[string]ipInfo, len(classes))
+	if e == nil {
+		return infos
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, dnsWorkers)
+	ptrs := make(map[string]string)
+	for _, class := range classes {
+		addr, single, ok := classAddress(class)
+		if !ok {
+			continue
+		}
+		infos[class] = e.Lookup(addr)
+		if e.resolver == nil || !single {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(class string, addr netip.Addr) {
+			defer wg.Done()
+			ptr := e.reverseDNS(addr)
+			mu.Lock()
+			ptrs[class] = ptr
+			mu.Unlock()
+			<-sem
+		}(class, addr)
+	}
+	wg.Wait()
+	for class, ptr := range ptrs {
+		info := infos[class]
+		info.PTR = ptr
+		infos[class] = info
+	}
+	return infos
+}
+
+// reverseDNS returns the first PTR name of addr, or "" if it has none.
+func (e *Enricher) reverseDNS(addr netip.Addr) string {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+	names, err := e.resolver.LookupAddr(ctx, addr.Unmap().String())
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// asnKey returns the -by asn key of ip, e.g. "AS15169 Google LLC", or "" if
+// the autonomous system is unknown.
+func (e *Enricher) asnKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || e == nil || e.asn == nil {
+		return ""
+	}
+	asn, org, _, ok := e.asn.lookupASN(addr.Unmap())
+	if !ok || asn == 0 {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprintf("AS%d %s", asn, org))
+}
+
+// countryKey returns the -by country key of ip, its ISO country code.
+func (e *Enricher) countryKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	return e.Lookup(addr).Country
+}
+
+// knowsCountries reports whether e can find the country of an address: with
+// a CountryDatabase, or an ASN table with a country column (ip2asn).
+func (e *Enricher) knowsCountries() bool {
+	if e == nil {
+		return false
+	}
+	if e.country != nil {
+		return true
+	}
+	table, ok := e.asn.(asnTable)
+	return ok && table.hasCountries()
+}
+
+// openASNDatabase opens a MaxMind-format database by its extension .mmdb, or
+// a CSV/TSV file otherwise.
+func openASNDatabase(name string) (asnSource, error) {
+	if strings.HasSuffix(strings.ToLower(name), ".mmdb") {
+		reader, err := maxminddb.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("ASN database %s: %w", name, err)
+		}
+		return &mmdbASN{reader: reader}, nil
+	}
+	table, err := loadASNTable(name)
+	if err != nil {
+		return nil, fmt.Errorf("ASN database %s: %w", name, err)
+	}
+	return table, nil
+}
+
+// mmdbASN is an ASN database in the MaxMind format (GeoLite2-ASN layout).
+type mmdbASN struct {
+	reader *maxminddb.Reader
+}
+
+func (db *mmdbASN) lookupASN(addr netip.Addr) (uint, string, string, bool) {
+	var record struct {
+		ASN uint   `maxminddb:"autonomous_system_number"`
+		Org string `maxminddb:"autonomous_system_organization"`
+	}
+	if err := db.reader.Lookup(net.IP(addr.AsSlice()), &record); err != nil || record.ASN == 0 {
+		return 0, "", "", false
+	}
+	return record.ASN, record.Org, "", true
+}
+
+// asnRange is an address range of an autonomous system.
+type asnRange struct {
+	First, Last netip.Addr
+	ASN         uint
+	Org         string
+	Country     string
+}
+
+// asnTable is an ASN database read from a CSV or TSV file, sorted by First.
+// Ranges must not overlap.
+type asnTable []asnRange
+
+func (t asnTable) lookupASN(addr netip.Addr) (uint, string, string, bool) {
+	i := sort.Search(len(t), func(i int) bool { return addr.Less(t[i].First) }) - 1
+	if i < 0 || t[i].Last.Less(addr) || t[i].ASN == 0 {
+		return 0, "", "", false
+	}
+	return t[i].ASN, t[i].Org, t[i].Country, true
+}
+
+// hasCountries reports whether the country of at least one range is known.
+func (t asnTable) hasCountries() bool {
+	for _, r := range t {
+		if r.Country != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// loadASNTable reads an ASN database in one of two formats, recognised per
+// line:
+//
+//   - GeoLite2-ASN-Blocks CSV: network,autonomous_system_number,autonomous_system_organization
+//   - ip2asn TSV: range_start, range_end, AS_number, country_code, AS_description
+//
+// Header lines, empty lines and # comments are skipped.
+func loadASNTable(name string) (asnTable, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var table asnTable
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "network,") {
+			continue
+		}
+		r, err := parseASNLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		table = append(table, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(table, func(i, j int) bool { return table[i].First.Less(table[j].First) })
+	return table, nil
+}
+
+// parseASNLine parses a line of loadASNTable.
+func parseASNLine(text string) (asnRange, error) {
+	var r asnRange
+	if fields := strings.Split(text, "\t"); len(fields) >= 3 {
+		first, err1 := netip.ParseAddr(fields[0])
+		last, err2 := netip.ParseAddr(fields[1])
+		asn, err3 := strconv.ParseUint(fields[2], 10, 32)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return r, fmt.Errorf("invalid ip2asn line %q", text)
+		}
+		r = asnRange{First: first.Unmap(), Last: last.Unmap(), ASN: uint(asn)}
+		if len(fields) > 3 && fields[3] != "None" {
+			r.Country = fields[3]
+		}
+		if len(fields) > 4 && fields[4] != "Not routed" {
+			r.Org = fields[4]
+		}
+		return r, nil
+	}
+	network, rest, _ := strings.Cut(text, ",")
+	asnField, org, _ := strings.Cut(rest, ",")
+	prefix, err1 := netip.ParsePrefix(network)
+	asn, err2 := strconv.ParseUint(asnField, 10, 32)
+	if err1 != nil || err2 != nil {
+		return r, fmt.Errorf("invalid CSV line %q", text)
+	}
+	prefix = prefix.Masked()
+	return asnRange{First: prefix.Addr(), Last: lastAddr(prefix), ASN: uint(asn), Org: strings.Trim(org, `"`)}, nil
+}
+
+// lastAddr returns the last address of prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// formatEnrichment lists the ipInfo of classes, one per line.
+func formatEnrichment(classes []string, infos map[string]ipInfo) string {
+	var b strings.Builder
+	for _, class := range classes {
+		if info, ok := infos[class]; ok {
+			b.WriteString(fmt.Sprintf("\t%s\t: %s\n", class, info))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// a minimal MaxMind DB writer for the tests
+// ──────────────────────────────────────────────
+
+// mmdbNode is a node of the search tree of writeTestMMDB. leaf holds the
+// offset+1 of the data of a record that ends in the data section.
+type mmdbNode struct {
+	child [2]*mmdbNode
+	leaf  [2]int
+}
+
+// encodeMMDB appends the MaxMind DB encoding of v (string shorter than 285
+// bytes, uint16, uint32, uint64, map[string]any or []any with fewer than 29
+// elements) to b.
+func encodeMMDB(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case string:
+		if len(v) < 29 {
+			b = append(b, 2<<5|byte(len(v)))
+		} else {
+			b = append(b, 2<<5|29, byte(len(v)-29))
+		}
+		return append(b, v...)
+	case uint16:
+		return append(b, 5<<5|2, byte(v>>8), byte(v))
+	case uint32:
+		b = append(b, 6<<5|4)
+		return binary.BigEndian.AppendUint32(b, v)
+	case uint64:
+		b = append(b, 8, 9-7)
+		return binary.BigEndian.AppendUint64(b, v)
+	case []any:
+		b = append(b, byte(len(v)), 11-7)
+		for _, e := range v {
+			b = encodeMMDB(b, e)
+		}
+		return b
+	case map[string]any:
+		b = append(b, 7<<5|byte(len(v)))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b = encodeMMDB(b, k)
+			b = encodeMMDB(b, v[k])
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+// writeTestMMDB writes an IPv6 MaxMind DB with 24 bit records that maps the
+// networks (IPv4 or IPv6 CIDRs, not overlapping) to their records.
+func writeTestMMDB(t *testing.T, dbType string, records map[string]map[string]any) string {
+	t.Helper()
+	root := &mmdbNode{}
+	var data []byte
+	for network, record := range records {
+		prefix := netip.MustParsePrefix(network)
+		bits := prefix.Bits()
+		addr := prefix.Addr().As16()
+		if prefix.Addr().Is4() {
+			bits += 96
+			addr = netip.AddrFrom16(addr).As16()
+			copy(addr[:12], make([]byte, 12))
+		}
+		offset := len(data)
+		data = encodeMMDB(data, record)
+		node := root
+		for i := 0; i < bits; i++ {
+			bit := addr[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				node.leaf[bit] = offset + 1
+				break
+			}
+			if node.child[bit] == nil {
+				node.child[bit] = &mmdbNode{}
+			}
+			node = node.child[bit]
+		}
+	}
+
+	// number the nodes breadth first
+	nodes := []*mmdbNode{root}
+	ids := map[*mmdbNode]int{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].child {
+			if child != nil {
+				ids[child] = len(nodes)
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	var tree []byte
+	for _, node := range nodes {
+		for side := 0; side < 2; side++ {
+			record := len(nodes) // empty
+			if node.child[side] != nil {
+				record = ids[node.child[side]]
+			} else if node.leaf[side] > 0 {
+				record = len(nodes) + 16 + node.leaf[side] - 1
+			}
+			tree = append(tree, byte(record>>16), byte(record>>8), byte(record))
+		}
+	}
+
+	var file bytes.Buffer
+	file.Write(tree)
+	file.Write(make([]byte, 16))
+	file.Write(data)
+	file.WriteString("\xab\xcd\xefMaxMind.com")
+	file.Write(encodeMMDB(nil, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(0),
+		"database_type":               dbType,
+		"description":                 map[string]any{},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+	}))
+	name := filepath.Join(t.TempDir(), dbType+".mmdb")
+	if err := os.WriteFile(name, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func testASNMMDB(t *testing.T) string {
+	return writeTestMMDB(t, "GeoLite2-ASN", map[string]map[string]any{
+		"66.249.64.0/19": {"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+		"2001:4860::/32": {"autonomous_system_number": uint32(15169), "autonomous_system_organization": "GOOGLE"},
+		"52.0.0.0/11":    {"autonomous_system_number": uint32(16509), "autonomous_system_organization": "AMAZON-02"},
+	})
+}
+
+func testCountryMMDB(t *testing.T) string {
+	return writeTestMMDB(t, "GeoLite2-Country", map[string]map[string]any{
+		"66.249.64.0/19": {"country": map[string]any{"iso_code": "US"}},
+		"52.0.0.0/11":    {"registered_country": map[string]any{"iso_code": "US"}},
+		"2001:4860::/32": {"country": map[string]any{"iso_code": "US"}},
+	})
+}
+
+// ──────────────────────────────────────────────
+// ASN databases
+// ──────────────────────────────────────────────
+
+func TestEnricherMMDB(t *testing.T) {
+	e, err := newEnricher(EnrichConfig{ASNDatabase: testASNMMDB(t), CountryDatabase: testCountryMMDB(t)}, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	tests := map[string]ipInfo{
+		"66.249.66.1":          {ASN: 15169, Org: "GOOGLE", Country: "US"},
+		"::ffff:66.249.66.1":   {ASN: 15169, Org: "GOOGLE", Country: "US"},
+		"2001:4860:4801::1":    {ASN: 15169, Org: "GOOGLE", Country: "US"},
+		"52.10.20.30":          {ASN: 16509, Org: "AMAZON-02", Country: "US"},
+		"198.51.100.1":         {},
+		"2a00:1450:4001::1001": {},
+	}
+	for ip, want := range tests {
+		if got := e.Lookup(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("%s: got %+v, want %+v", ip, got, want)
+		}
+	}
+}
+
+func TestLoadASNTableCSV(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "GeoLite2-ASN-Blocks-IPv4.csv")
+	content := `network,autonomous_system_number,autonomous_system_organization
+66.249.64.0/19,15169,GOOGLE
+52.0.0.0/11,16509,"AMAZON-02, Inc."
+2001:4860::/32,15169,GOOGLE
+`
+	os.WriteFile(name, []byte(content), 0644)
+	table, err := loadASNTable(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"66.249.95.255":   "AS15169 GOOGLE",
+		"66.249.96.0":     "",
+		"52.31.255.255":   "AS16509 AMAZON-02, Inc.",
+		"2001:4860:ff::1": "AS15169 GOOGLE",
+		"10.0.0.1":        "",
+	}
+	e := &Enricher{asn: table}
+	for ip, want := range tests {
+		if got := e.asnKey(ip); got != want {
+			t.Errorf("%s: got %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestLoadASNTableIP2ASN(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "ip2asn-combined.tsv")
+	content := "1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+		"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+		"2a03:2880::\t2a03:2880:ffff:ffff:ffff:ffff:ffff:ffff\t32934\tUS\tFACEBOOK\n"
+	os.WriteFile(name, []byte(content), 0644)
+	table, err := loadASNTable(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Enricher{asn: table}
+	if got := e.Lookup(netip.MustParseAddr("1.0.0.1")); got != (ipInfo{ASN: 13335, Org: "CLOUDFLARENET", Country: "US"}) {
+		t.Errorf("got %+v", got)
+	}
+	if got := e.asnKey("1.0.2.1"); got != "" {
+		t.Errorf("not routed: got %q", got)
+	}
+	if got := e.countryKey("2a03:2880:f003::1"); got != "US" {
+		t.Errorf("country: got %q", got)
+	}
+	if !e.knowsCountries() {
+		t.Error("an ip2asn table knows the countries")
+	}
+}
+
+func TestEnricherKnowsCountries(t *testing.T) {
+	tests := map[string]struct {
+		cfg  EnrichConfig
+		want bool
+	}{
+		"mmdb ASN":     {EnrichConfig{ASNDatabase: testASNMMDB(t)}, false},
+		"mmdb country": {EnrichConfig{CountryDatabase: testCountryMMDB(t)}, true},
+		"none":         {EnrichConfig{}, false},
+	}
+	for name, tt := range tests {
+		e, err := newEnricher(tt.cfg, nil, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.knowsCountries(); got != tt.want {
+			t.Errorf("%s: got %v, want %v", name, got, tt.want)
+		}
+		e.Close()
+	}
+	csv := asnTable{{ASN: 15169, Org: "GOOGLE"}}
+	if (&Enricher{asn: csv}).knowsCountries() {
+		t.Error("a GeoLite2 CSV table has no countries")
+	}
+	var none *Enricher
+	if none.knowsCountries() {
+		t.Error("a nil Enricher knows no countries")
+	}
+}
+
+func TestLoadASNTableErrors(t *testing.T) {
+	if _, err := openASNDatabase("/nonexistent/asn.csv"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	name := filepath.Join(t.TempDir(), "bad.csv")
+	os.WriteFile(name, []byte("66.249.64.0/19,google\n"), 0644)
+	if _, err := loadASNTable(name); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected an error for line 1, got %v", err)
+	}
+}
+
+func TestLastAddr(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.0/8":     "10.255.255.255",
+		"192.0.2.7/32":   "192.0.2.7",
+		"2001:db8::/126": "2001:db8::3",
+	}
+	for prefix, want := range tests {
+		if got := lastAddr(netip.MustParsePrefix(prefix)); got.String() != want {
+			t.Errorf("%s: got %s, want %s", prefix, got, want)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// Annotate / -by asn
+// ──────────────────────────────────────────────
+
+func TestEnricherAnnotate(t *testing.T) {
+	r := newFakeResolver()
+	e, err := newEnricher(EnrichConfig{ASNDatabase: testASNMMDB(t), ReverseDNS: true}, r, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	infos := e.Annotate([]string{"66.249.66.1", "52.10.0.0/16", "/login", "198.51.100.10"})
+
+	if got := infos["66.249.66.1"]; got != (ipInfo{PTR: "crawl-66-249-66-1.googlebot.com", ASN: 15169, Org: "GOOGLE"}) {
+		t.Errorf("66.249.66.1: got %+v", got)
+	}
+	if got := infos["52.10.0.0/16"]; got != (ipInfo{ASN: 16509, Org: "AMAZON-02"}) {
+		t.Errorf("networks have no PTR name: got %+v", got)
+	}
+	if _, ok := infos["/login"]; ok {
+		t.Error("keys other than addresses should not be annotated")
+	}
+	if got := infos["198.51.100.10"]; got != (ipInfo{}) || got.String() != "-" {
+		t.Errorf("unknown address: got %+v", got)
+	}
+
+	out := formatEnrichment([]string{"66.249.66.1", "52.10.0.0/16"}, infos)
+	want := "\t66.249.66.1\t: AS15169 GOOGLE, crawl-66-249-66-1.googlebot.com\n\t52.10.0.0/16\t: AS16509 AMAZON-02\n"
+	if out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestEnricherNil(t *testing.T) {
+	var e *Enricher
+	if e.asnKey("66.249.66.1") != "" || len(e.Annotate([]string{"66.249.66.1"})) != 0 {
+		t.Error("a nil Enricher should know nothing")
+	}
+	e.Close()
+}
+
+func TestGroupByASN(t *testing.T) {
+	setupTestGlobals()
+	e, err := newEnricher(EnrichConfig{ASNDatabase: testASNMMDB(t)}, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	ipDatabases = e
+	defer func() { ipDatabases = nil }()
+	useGroupBy(t, "asn")
+
+	l := Log2Analyze{}
+	for _, ip := range []string{"52.1.1.1", "52.2.2.2", "52.3.3.3", "66.249.66.1", "198.51.100.1"} {
+		entry := createEntry(ip + ` - - [10/Feb/2026:12:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "curl/8.0"`)
+		l.Entries = append(l.Entries, entry)
+	}
+	topIPs, _ := l.GetTopIPs()
+	want := map[string]int{"AS16509 AMAZON-02": 3, "AS15169 GOOGLE": 1, "-": 1}
+	for key, count := range want {
+		if topIPs[key] != count {
+			t.Errorf("%s: got %d, want %d (%v)", key, topIPs[key], count, topIPs)
+		}
+	}
+	if !groupByUses("asn") || groupByUses("ip") {
+		t.Error("groupByUses: wrong result")
+	}
+}
+
+func TestReportAddEnrichment(t *testing.T) {
+	report := buildTestReport()
+	report.AddEnrichment(map[string]ipInfo{"1.1.1.1": {ASN: 13335, Org: "CLOUDFLARENET", Country: "AU"}})
+	var b strings.Builder
+	if err := report.WriteNDJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `{"type":"class","class":"1.1.1.1","count":2,"ua_classes":[{"ua_class":"http-library","count":1},{"ua_class":"other","count":1}],"network":{"asn":13335,"as_org":"CLOUDFLARENET","country":"AU"}}`) {
+		t.Errorf("got:\n%s", b.String())
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvelopeConfig describes an envelope around the log lines of LogType:
+//
+//   - syslog: a syslog header (RFC 3164, with or without <PRI> and with an
+//     RFC 3339 timestamp as written by rsyslog, or RFC 5424) before the
+//     message, e.g. "Feb 12 12:14:14 lb1 haproxy[1234]: <message>"
+//   - journald: the JSON lines of journalctl -o json; the log line is the
+//     MESSAGE field
+//
+// Program only analyzes the messages of this program (the syslog tag without
+// PID, or SYSLOG_IDENTIFIER in the journal); other lines are skipped.
+type EnvelopeConfig struct {
+	Type    string `yaml:"Type"`
+	Program string `yaml:"Program"`
+}
+
+// envelopeFormat unwraps the log line from its envelope and hands it to the
+// parser of the log type.
+type envelopeFormat struct {
+	unwrap  func(line string) (program, message string, ok bool)
+	program string
+	inner   lineParser
+}
+
+// positionFormat parses lines by the token positions of config.LogFormat.
+type positionFormat struct{}
+
+func (positionFormat) parse(line string) LogEntry {
+	return parsePositions(config.LogFormat, line)
+}
+
+// newEnvelopeFormat returns the parser unwrapping the envelope of cfg around
+// the lines parsed by inner.
+func newEnvelopeFormat(cfg EnvelopeConfig, inner lineParser) (*envelopeFormat, error) {
+	f := &envelopeFormat{program: cfg.Program, inner: inner}
+	switch cfg.Type {
+	case "syslog":
+		f.unwrap = parseSyslog
+	case "journald":
+		f.unwrap = parseJournalJSON
+	default:
+		return nil, fmt.Errorf("unknown envelope %q, use syslog or journald", cfg.Type)
+	}
+	return f, nil
+}
+
+// parse unwraps line and parses the message. Lines of other programs are
+// marked as filtered. Lines without a valid envelope are logged at debug
+// level and parsed as they are.
+func (f *envelopeFormat) parse(line string) LogEntry {
+	program, message, ok := f.unwrap(line)
+	if !ok {
+		LogIt.Debug("Error decoding envelope of line: " + line)
+		message = line
+	}
+	if f.program != "" && program != f.program {
+		return LogEntry{filtered: true}
+	}
+	return f.inner.parse(message)
+}
+
+// rfc3164Layout is the timestamp of an RFC 3164 syslog header, with the day
+// padded by a space ("Feb  2 12:14:14").
+const rfc3164Layout = time.Stamp
+
+// parseSyslog splits a syslog line into the program and the message. The
+// header is either RFC 5424 ("<PRI>1 TIMESTAMP HOST APP PROCID MSGID SD MSG")
+// or RFC 3164 ("[<PRI>]TIMESTAMP HOST TAG[PID]: MSG"), where TIMESTAMP is
+// "Mmm dd hh:mm:ss" or RFC 3339.
+func parseSyslog(line string) (program, message string, ok bool) {
+	rest := line
+	if strings.HasPrefix(rest, "<") {
+		end := strings.IndexByte(rest, '>')
+		if end < 2 || end > 4 {
+			return "", "", false
+		}
+		rest = rest[end+1:]
+		if version, after, found := strings.Cut(rest, " "); found && version != "" && isDigits(version) {
+			return parseSyslog5424(after)
+		}
+	}
+	// RFC 3164 timestamp, or an RFC 3339 timestamp up to the first space
+	if len(rest) >= len(rfc3164Layout) && isTime(rfc3164Layout, rest[:len(rfc3164Layout)]) {
+		rest = rest[len(rfc3164Layout):]
+	} else if ts, after, found := strings.Cut(rest, " "); found && isTime(time.RFC3339Nano, ts) {
+		rest = after
+	} else {
+		return "", "", false
+	}
+	_, rest, found := strings.Cut(strings.TrimLeft(rest, " "), " ") // host
+	if !found {
+		return "", "", false
+	}
+	tag, message, found := strings.Cut(rest, ": ")
+	if !found || strings.Contains(tag, " ") {
+		return "", "", false
+	}
+	if i := strings.IndexByte(tag, '['); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag, message, true
+}
+
+// parseSyslog5424 parses the RFC 5424 header after the version:
+// "TIMESTAMP HOST APP PROCID MSGID SD MSG". The structured data SD is "-" or
+// a sequence of [...] elements, in which "]" may be escaped as "\]".
+func parseSyslog5424(header string) (program, message string, ok bool) {
+	fields := strings.SplitN(header, " ", 6)
+	if len(fields) < 6 {
+		return "", "", false
+	}
+	program, rest := fields[2], fields[5]
+	if program == "-" {
+		program = ""
+	}
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		for strings.HasPrefix(rest, "[") {
+			i := 1
+			for ; i < len(rest) && rest[i] != ']'; i++ {
+				if rest[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(rest) {
+				return "", "", false
+			}
+			rest = rest[i+1:]
+		}
+	}
+	message = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	return program, message, true
+}
+
+// isTime reports whether value is a time in layout.
+func isTime(layout, value string) bool {
+	_, err := time.Parse(layout, value)
+	return err == nil
+}
+
+// isDigits reports whether s consists of ASCII digits only.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseJournalJSON returns the program and the message of a line of
+// journalctl -o json. A MESSAGE that is not valid UTF-8 is exported as an
+// array of bytes.
+func parseJournalJSON(line string) (program, message string, ok bool) {
+	fields, err := decodeJSONLine(line)
+	if err != nil {
+		return "", "", false
+	}
+	switch m := fields["MESSAGE"].(type) {
+	case string:
+		message = m
+	case []any:
+		b := make([]byte, 0, len(m))
+		for _, v := range m {
+			n, err := strconv.Atoi(valueString(v))
+			if err != nil {
+				return "", "", false
+			}
+			b = append(b, byte(n))
+		}
+		message = string(b)
+	default:
+		return "", "", false
+	}
+	program = valueString(fields["SYSLOG_IDENTIFIER"])
+	if program == "" {
+		program = valueString(fields["_COMM"])
+	}
+	return program, message, true
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// haproxyMessage is a HAProxy HTTP log line without syslog header, in the
+// layout of the haproxy_http preset.
+const haproxyMessage = `10.0.1.2:33317 [06/Feb/2026:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 ---- 1/1/1/1/0 0/0 "GET /index.html HTTP/1.1"`
+
+func TestParseSyslog(t *testing.T) {
+	tests := map[string][2]string{
+		"Feb 12 12:14:14 lb1 haproxy[1234]: " + haproxyMessage:                                 {"haproxy", haproxyMessage},
+		"Feb  2 12:14:14 lb1 haproxy: msg with: colon":                                         {"haproxy", "msg with: colon"},
+		"<134>Feb 12 12:14:14 lb1 haproxy[1234]: msg":                                          {"haproxy", "msg"},
+		"2026-02-12T12:14:14.123456+01:00 lb1 nginx[99]: msg":                                  {"nginx", "msg"},
+		"<134>1 2026-02-12T12:14:14.003Z lb1 haproxy 1234 - - msg":                             {"haproxy", "msg"},
+		`<134>1 2026-02-12T12:14:14Z lb1 haproxy 1234 ID47 [ex@32473 a="x\]y"][b@1 c="d"] msg`: {"haproxy", "msg"},
+		"<134>1 2026-02-12T12:14:14Z lb1 - - - - \ufeffmsg":                                    {"", "msg"},
+	}
+	for line, want := range tests {
+		program, message, ok := parseSyslog(line)
+		if !ok || program != want[0] || message != want[1] {
+			t.Errorf("%q: got %q %q %v, want %q %q", line, program, message, ok, want[0], want[1])
+		}
+	}
+	for _, line := range []string{haproxyMessage, "<13>", "Feb 12 12:14:14 lb1", "Feb 12 12:14:14 lb1 no tag here", "<134>1 2026-02-12T12:14:14Z lb1 app 1 - [unterminated"} {
+		if _, _, ok := parseSyslog(line); ok {
+			t.Errorf("%q: expected no syslog header", line)
+		}
+	}
+}
+
+func TestParseJournalJSON(t *testing.T) {
+	program, message, ok := parseJournalJSON(`{"__REALTIME_TIMESTAMP":"1770898454655000","_COMM":"haproxy","SYSLOG_IDENTIFIER":"haproxy","MESSAGE":"hello"}`)
+	if !ok || program != "haproxy" || message != "hello" {
+		t.Errorf("got %q %q %v", program, message, ok)
+	}
+	program, message, ok = parseJournalJSON(`{"_COMM":"nginx","MESSAGE":[104,105,255]}`)
+	if !ok || program != "nginx" || message != "hi\xff" {
+		t.Errorf("byte array: got %q %q %v", program, message, ok)
+	}
+	for _, line := range []string{`{"MESSAGE":null}`, `{"MESSAGE":["x"]}`, `no json`} {
+		if _, _, ok := parseJournalJSON(line); ok {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
+
+func setupEnvelopeConfig(t *testing.T, envelope EnvelopeConfig) {
+	t.Helper()
+	setupTestGlobals()
+	config.LogType = "haproxy_http"
+	config.LogFormat = haproxyHTTPLogFormat()
+	config.Envelope = envelope
+	if err := config.compileFormat(); err != nil {
+		t.Fatal(err)
+	}
+	log2Analyze.DateLayout = "02/Jan/2006:15:04:05.000"
+	t.Cleanup(setupTestGlobals)
+}
+
+func TestEnvelopeSyslogHAProxy(t *testing.T) {
+	setupEnvelopeConfig(t, EnvelopeConfig{Type: "syslog", Program: "haproxy"})
+	entry := createEntry("Feb  6 12:14:14 lb1 haproxy[1234]: " + haproxyMessage)
+	if entry.IP != "10.0.1.2" || entry.Code != 200 || entry.Method != "GET" || entry.Request != "/index.html" {
+		t.Errorf("got %+v", entry)
+	}
+	if !entry.TimeStamp.Equal(time.Date(2026, 2, 6, 12, 14, 14, 655000000, time.UTC)) {
+		t.Errorf("timestamp: got %v", entry.TimeStamp)
+	}
+	if entry := createEntry("Feb  6 12:14:14 lb1 sshd[99]: Accepted publickey for root"); !entry.filtered {
+		t.Errorf("other programs should be filtered: %+v", entry)
+	}
+}
+
+func TestEnvelopeJournald(t *testing.T) {
+	setupEnvelopeConfig(t, EnvelopeConfig{Type: "journald"})
+	entry := createEntry(`{"SYSLOG_IDENTIFIER":"haproxy","MESSAGE":"` + `10.0.1.2:33317 [06/Feb/2026:12:14:14.655] http-in static/srv1 10/0/30/69/109 503 2750 ---- 1/1/1/1/0 0/0 \"GET / HTTP/1.1\""}`)
+	if entry.IP != "10.0.1.2" || entry.Code != 503 || entry.filtered {
+		t.Errorf("got %+v", entry)
+	}
+}
+
+func TestEnvelopeRetrieveEntries(t *testing.T) {
+	setupEnvelopeConfig(t, EnvelopeConfig{Type: "syslog", Program: "haproxy"})
+	name := filepath.Join(t.TempDir(), "haproxy.log")
+	content := "Feb  6 12:14:14 lb1 haproxy[1234]: " + haproxyMessage + "\n" +
+		"Feb  6 12:14:15 lb1 systemd[1]: Started Session 42 of user root.\n" +
+		"Feb  6 12:14:16 lb1 haproxy[1234]: " + haproxyMessage + "\n"
+	os.WriteFile(name, []byte(content), 0644)
+
+	l := Log2Analyze{FileName: name, DateLayout: log2Analyze.DateLayout}
+	l.StartTime = time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	l.EndTime = l.StartTime.Add(time.Hour)
+	l.RetrieveEntries("", 60)
+	if l.LinesRead != 3 || l.EntryCount != 2 {
+		t.Errorf("got %d lines, %d entries, want 3 lines, 2 entries", l.LinesRead, l.EntryCount)
+	}
+}
+
+func TestCompileFormatUnknownEnvelope(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	config.Envelope = EnvelopeConfig{Type: "gelf"}
+	if err := config.compileFormat(); err == nil {
+		t.Error("expected an error for an unknown envelope")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/csv"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// exportSeparators maps the -export formats to their field separator. The
+// text format is not listed; it uses formatEntryLine.
+var exportSeparators = map[string]rune{
+	"csv": ',',
+	"tsv": '\t',
+}
+
+// exportHeader is the header row of the csv and tsv output files.
+var exportHeader = []string{"class", "time", "ip", "method", "request", "code", "rtime", "user_agent", "source"}
+
+// exportTimeLayout is the ISO-8601 (RFC 3339) layout of the exported
+// timestamps. It keeps the milliseconds, so the rows of one second stay in
+// order, and has a fixed width.
+const exportTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// exportRecord returns the fields of entry in the order of exportHeader. The
+// timestamp is written in exportTimeLayout and the response time in seconds,
+// empty if the log has none.
+func exportRecord(entry LogEntry) []string {
+	rtime := ""
+	if rt, ok := rtimeSeconds(entry.RTime); ok {
+		rtime = strconv.FormatFloat(rt, 'f', -1, 64)
+	}
+	return []string{
+		entry.Class,
+		entry.TimeStamp.Format(exportTimeLayout),
+		entry.IP,
+		entry.Method,
+		entry.Request,
+		strconv.Itoa(entry.Code),
+		rtime,
+		entry.UserAgent,
+		entry.Source,
+	}
+}
+
+// formatRecord renders fields as one RFC 4180 line with the separator of
+// format: fields containing the separator, quotes or line breaks are quoted
+// and embedded quotes are doubled.
+func formatRecord(fields []string, format string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Comma = exportSeparators[format]
+	w.UseCRLF = true
+	if err := w.Write(fields); err != nil {
+		log.Fatal(err)
+	}
+	w.Flush()
+	return b.String()
+}
+
+// detailFormatter returns the function rendering the detail line of an entry
+// in the output files for format (text, csv or tsv).
+func (l Log2Analyze) detailFormatter(format string) func(LogEntry) string {
+	if _, ok := exportSeparators[format]; !ok {
+		return l.formatEntryLine
+	}
+	return func(entry LogEntry) string {
+		return formatRecord(exportRecord(entry), format)
+	}
+}
+
+// exportExtension returns the file extension of the output files for format.
+func exportExtension(format string) string {
+	if _, ok := exportSeparators[format]; ok {
+		return "." + format
+	}
+	return ".txt"
+}
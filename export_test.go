@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exportTestAnalysis returns an analysis with a user agent containing the
+// characters that broke the tab separated text files.
+func exportTestAnalysis() Log2Analyze {
+	ts := time.Date(2026, 2, 10, 12, 1, 0, 0, time.FixedZone("", 3600))
+	return Log2Analyze{
+		FileName:   "test.log",
+		DateLayout: "02/Jan/2006:15:04:05 -0700",
+		EntryCount: 3,
+		Entries: []LogEntry{
+			{IP: "1.1.1.1", Class: "1.1.1.1", TimeStamp: ts, Method: "GET", Request: "/a,b", Code: 200, RTime: "1500", UserAgent: "Evil\tBot \"1.0\"", Source: "test.log"},
+			{IP: "1.1.1.1", Class: "1.1.1.1", TimeStamp: ts.Add(time.Second), Method: "GET", Request: "/c", Code: 404, Source: "test.log"},
+			{IP: "2.2.2.2", Class: "2.2.2.2", TimeStamp: ts.Add(2 * time.Second), Method: "POST", Request: "/d", Code: 500, RTime: "250", Source: "test.log"},
+		},
+	}
+}
+
+// readExport parses the csv or tsv file at path.
+func readExport(t *testing.T, path string, comma rune) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	r.Comma = comma
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("%s is not valid: %v", path, err)
+	}
+	return records
+}
+
+// ──────────────────────────────────────────────
+// exportRecord / formatRecord
+// ──────────────────────────────────────────────
+
+func TestExportRecord(t *testing.T) {
+	setupTestGlobals()
+	record := exportRecord(exportTestAnalysis().Entries[0])
+	want := []string{"1.1.1.1", "2026-02-10T12:01:00.000+01:00", "1.1.1.1", "GET", "/a,b", "200", "1.5", "Evil\tBot \"1.0\"", "test.log"}
+	if strings.Join(record, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", record, want)
+	}
+	if len(record) != len(exportHeader) {
+		t.Errorf("record has %d fields, header %d", len(record), len(exportHeader))
+	}
+	entry := LogEntry{TimeStamp: time.Date(2026, 2, 10, 12, 1, 0, 250*int(time.Millisecond), time.UTC)}
+	if got := exportRecord(entry)[1]; got != "2026-02-10T12:01:00.250Z" {
+		t.Errorf("milliseconds: got %q", got)
+	}
+}
+
+func TestExportRecordWithoutRTime(t *testing.T) {
+	setupTestGlobals()
+	if rt := exportRecord(exportTestAnalysis().Entries[1])[6]; rt != "" {
+		t.Errorf("rtime should be empty, got %q", rt)
+	}
+}
+
+func TestFormatRecordQuoting(t *testing.T) {
+	fields := []string{"a,b", "Evil\tBot \"1.0\"", "plain"}
+	if got := formatRecord(fields, "csv"); got != "\"a,b\",\"Evil\tBot \"\"1.0\"\"\",plain\r\n" {
+		t.Errorf("csv: got %q", got)
+	}
+	if got := formatRecord(fields, "tsv"); got != "a,b\t\"Evil\tBot \"\"1.0\"\"\"\tplain\r\n" {
+		t.Errorf("tsv: got %q", got)
+	}
+}
+
+func TestDetailFormatterText(t *testing.T) {
+	setupTestGlobals()
+	l := exportTestAnalysis()
+	entry := l.Entries[1]
+	if got, want := l.detailFormatter("text")(entry), l.formatEntryLine(entry); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExportExtension(t *testing.T) {
+	for format, want := range map[string]string{"text": ".txt", "csv": ".csv", "tsv": ".tsv"} {
+		if got := exportExtension(format); got != want {
+			t.Errorf("%s: got %q, want %q", format, got, want)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// WriteOutputFiles with -export
+// ──────────────────────────────────────────────
+
+func TestWriteOutputFilesExportCSV(t *testing.T) {
+	setupTestGlobals()
+	format := "csv"
+	exportFormat = &format
+	dir := t.TempDir()
+	config.OutputFolder = dir + "/"
+
+	l := exportTestAnalysis()
+	l.WriteOutputFiles(map[string]int{"1.1.1.1": 2, "2.2.2.2": 1}, map[int]int{200: 1, 404: 1, 500: 1})
+
+	records := readExport(t, filepath.Join(dir, "00002_1.1.1.1.csv"), ',')
+	if len(records) != 3 || strings.Join(records[0], ",") != strings.Join(exportHeader, ",") {
+		t.Fatalf("got %q", records)
+	}
+	if records[1][7] != "Evil\tBot \"1.0\"" || records[1][4] != "/a,b" {
+		t.Errorf("fields were not preserved: %q", records[1])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00001_2.2.2.2.csv")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteOutputFilesExportCombinedTSV(t *testing.T) {
+	setupTestGlobals()
+	format := "tsv"
+	exportFormat = &format
+	cb := true
+	combinedFile = &cb
+	dir := t.TempDir()
+	config.OutputFolder = dir + "/"
+
+	l := exportTestAnalysis()
+	l.WriteOutputFiles(map[string]int{"1.1.1.1": 2, "2.2.2.2": 1}, map[int]int{200: 1, 404: 1, 500: 1})
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "combined-*.tsv"))
+	if len(matches) != 1 {
+		t.Fatalf("expected one combined tsv file, got %v", matches)
+	}
+	records := readExport(t, matches[0], '\t')
+	if len(records) != 4 {
+		t.Fatalf("expected header and 3 rows, got %q", records)
+	}
+	classes := []string{records[1][0], records[2][0], records[3][0]}
+	if strings.Join(classes, " ") != "1.1.1.1 1.1.1.1 2.2.2.2" {
+		t.Errorf("rows should be grouped by class, most requests first: %v", classes)
+	}
+	if records[3][6] != "0.25" {
+		t.Errorf("rtime should be in seconds, got %q", records[3][6])
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// followPollInterval is how often followed files are checked for new lines.
+const followPollInterval = 500 * time.Millisecond
+
+// tailer follows a single growing log file like tail -F: when the file is
+// rotated (a new file with the same name) or truncated, it is re-opened and
+// read from the beginning. Standard input is followed as a stream (see
+// openStreamTailer).
+type tailer struct {
+	name    string
+	file    *os.File
+	info    os.FileInfo
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+
+	stream      <-chan string
+	streamErr   error
+	streamEnded bool
+}
+
+// openTailer opens name for following, starting at offset (or at the end of
+// the file if offset is negative).
+func openTailer(name string, offset int64) (*tailer, error) {
+	t := &tailer{name: name}
+	if err := t.open(offset); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// open (re-)opens the file and positions it at offset, or at its end when
+// offset is negative.
+func (t *tailer) open(offset int64) error {
+	file, err := os.Open(t.name)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if offset < 0 {
+		offset = info.Size()
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	if t.file != nil {
+		t.file.Close()
+	}
+	t.file, t.info, t.offset, t.partial = file, info, offset, ""
+	t.reader = bufio.NewReader(file)
+	return nil
+}
+
+// lines returns the complete lines appended since the last call. A trailing
+// line without newline is kept until it is completed.
+func (t *tailer) lines() ([]string, error) {
+	if t.stream != nil || t.streamEnded {
+		return t.streamLines()
+	}
+	var lines []string
+	for {
+		chunk, err := t.reader.ReadString('\n')
+		t.offset += int64(len(chunk))
+		if err == nil {
+			lines = append(lines, strings.TrimSuffix(t.partial+chunk, "\n"))
+			t.partial = ""
+			continue
+		}
+		t.partial += chunk
+		if err != io.EOF {
+			return lines, err
+		}
+		break
+	}
+	// at the end of the file: check whether it was rotated or truncated
+	info, err := os.Stat(t.name)
+	if err != nil {
+		// the file is being rotated, try again on the next call
+		return lines, nil
+	}
+	if !os.SameFile(t.info, info) {
+		LogIt.Info(t.name + " was rotated, re-opening")
+		if err := t.open(0); err != nil {
+			return lines, err
+		}
+		more, err := t.lines()
+		return append(lines, more...), err
+	}
+	if info.Size() < t.offset {
+		LogIt.Info(t.name + " was truncated, reading from the beginning")
+		if err := t.open(0); err != nil {
+			return lines, err
+		}
+	}
+	return lines, nil
+}
+
+// Close closes the followed file.
+func (t *tailer) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// followWindow is the sliding window of entries shown in follow mode. The
+// counters are updated incrementally as entries are added and evicted.
+type followWindow struct {
+	span         time.Duration
+	entries      []LogEntry
+	classCount   map[string]int
+	codeCount    map[int]int
+	uaClassCount map[string]int
+}
+
+// newFollowWindow returns an empty window covering span (0 keeps all entries).
+func newFollowWindow(span time.Duration) *followWindow {
+	return &followWindow{
+		span:         span,
+		classCount:   make(map[string]int),
+		codeCount:    make(map[int]int),
+		uaClassCount: make(map[string]int),
+	}
+}
+
+// add puts entry into the window. The entries are kept sorted by timestamp,
+// lines of several files or of a log that is not time-ordered may arrive out
+// of order.
+func (w *followWindow) add(entry LogEntry) {
+	i := sort.Search(len(w.entries), func(i int) bool { return w.entries[i].TimeStamp.After(entry.TimeStamp) })
+	w.entries = slices.Insert(w.entries, i, entry)
+	w.classCount[entry.Class]++
+	w.codeCount[entry.Code]++
+	w.uaClassCount[entry.UAClass]++
+}
+
+// evict removes the entries that are older than span before now, which are
+// the first ones as the entries are sorted by timestamp.
+func (w *followWindow) evict(now time.Time) {
+	if w.span <= 0 {
+		return
+	}
+	cutoff := now.Add(-w.span)
+	i := 0
+	for ; i < len(w.entries) && w.entries[i].TimeStamp.Before(cutoff); i++ {
+		entry := w.entries[i]
+		if w.classCount[entry.Class]--; w.classCount[entry.Class] == 0 {
+			delete(w.classCount, entry.Class)
+		}
+		if w.codeCount[entry.Code]--; w.codeCount[entry.Code] == 0 {
+			delete(w.codeCount, entry.Code)
+		}
+		if w.uaClassCount[entry.UAClass]--; w.uaClassCount[entry.UAClass] == 0 {
+			delete(w.uaClassCount, entry.UAClass)
+		}
+	}
+	w.entries = w.entries[i:]
+	// release the memory of evicted entries from time to time
+	if cap(w.entries) > 1024 && len(w.entries) < cap(w.entries)/4 {
+		w.entries = append([]LogEntry(nil), w.entries...)
+	}
+}
+
+// render writes the current top-N table, the response-code distribution and
+// the requests per User-Agent class to out, clearing the terminal first.
+func (w *followWindow) render(out io.Writer, now time.Time, files []string) {
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	b.WriteString("following " + strings.Join(files, ", ") + "\n")
+	if w.span > 0 {
+		b.WriteString(fmt.Sprintf("last %v up to %s", w.span, now.Format("2006-01-02 15:04:05")))
+	} else {
+		b.WriteString("since start, up to " + now.Format("2006-01-02 15:04:05"))
+	}
+	b.WriteString(fmt.Sprintf(", %d requests\n", len(w.entries)))
+	b.WriteString("================================================================================\n")
+	b.WriteString("\n\tTop " + groupLabel() + "\t\t: count\n")
+	b.WriteString("\t------------------------------\n")
+	b.WriteString(sortByRcount(topN(w.classCount, *topIPsCount)))
+	b.WriteString("\n\tCode\t: count\n")
+	b.WriteString("\t------------------------------\n")
+	codes := make([]int, 0, len(w.codeCount))
+	for code := range w.codeCount {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		b.WriteString(fmt.Sprintf("\t%d\t: %d\n", code, w.codeCount[code]))
+	}
+	b.WriteString("\n\tUser-Agent class\t: count\n")
+	b.WriteString("\t------------------------------\n")
+	b.WriteString(formatUAClasses(w.uaClassCount, len(w.entries)))
+	io.WriteString(out, b.String())
+}
+
+// follower reads new lines from the followed files into a sliding window.
+type follower struct {
+	l       *Log2Analyze
+	window  *followWindow
+	tailers []*tailer
+}
+
+// newFollower opens the log files of l for following. Before following, the
+// part of each file within the last timerange minutes is read (found by
+// binary search, see seekOffset; files that are not time-ordered are read
+// from the start), so the window is complete from the start.
+// Standard input is read from its current position.
+func newFollower(l *Log2Analyze, timerange int) (*follower, error) {
+	span := time.Duration(timerange) * time.Minute
+	f := &follower{l: l, window: newFollowWindow(span)}
+	for _, name := range l.files() {
+		if name == stdinName {
+			f.tailers = append(f.tailers, openStreamTailer(name, stdinReader()))
+			continue
+		}
+		offset := int64(-1)
+		if span > 0 {
+			file, err := os.Open(name)
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			if format := detectCompression(file); format != "" {
+				file.Close()
+				f.Close()
+				return nil, fmt.Errorf("%s is %s compressed and cannot be followed", name, format)
+			}
+			if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+				offset = 0
+				if timeOrdered(file, info.Size()) {
+					offset = seekOffset(file, info.Size(), time.Now().Add(-span-config.SeekTolerance))
+				}
+			}
+			file.Close()
+		}
+		t, err := openTailer(name, offset)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.tailers = append(f.tailers, t)
+	}
+	return f, nil
+}
+
+// poll adds the entries of all new lines that match the filters to the
+// window and evicts the entries that fell out of it.
+func (f *follower) poll(now time.Time) {
+	for _, t := range f.tailers {
+		lines, err := t.lines()
+		if err != nil {
+			LogIt.Error("Error following " + t.name + ": " + err.Error())
+		}
+		for _, line := range lines {
+			entry := createEntry(line)
+			entry.Source = t.name
+			if !entry.filtered && entry.reject == "" && f.l.matches(entry, 0) {
+				f.window.add(entry)
+			}
+		}
+	}
+	f.window.evict(now)
+}
+
+// Close closes the followed files.
+func (f *follower) Close() {
+	for _, t := range f.tailers {
+		t.Close()
+	}
+}
+
+// Follow tails the log files of l and redraws the top-N table for the last
+// timerange minutes on out every interval, until stop is closed.
+func (l *Log2Analyze) Follow(timerange int, interval time.Duration, out io.Writer, stop <-chan struct{}) error {
+	f, err := newFollower(l, timerange)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ticker := time.NewTicker(followPollInterval)
+	defer ticker.Stop()
+	var drawn time.Time
+	for {
+		now := time.Now()
+		f.poll(now)
+		if now.Sub(drawn) >= interval {
+			f.window.render(out, now, l.files())
+			drawn = now
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// appendToFile appends content to the file name.
+func appendToFile(t *testing.T, name, content string) {
+	t.Helper()
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ──────────────────────────────────────────────
+// tailer
+// ──────────────────────────────────────────────
+
+func TestTailerReadsAppendedLines(t *testing.T) {
+	setupTestGlobals()
+	name := t.TempDir() + "/access_log"
+	appendToFile(t, name, "old line\n")
+
+	tl, err := openTailer(name, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+
+	if lines, _ := tl.lines(); len(lines) != 0 {
+		t.Errorf("expected no lines when starting at the end, got %v", lines)
+	}
+	appendToFile(t, name, "first\nsecond (part")
+	lines, _ := tl.lines()
+	if len(lines) != 1 || lines[0] != "first" {
+		t.Errorf("got %q, want [first]", lines)
+	}
+	appendToFile(t, name, "ial)\n")
+	lines, _ = tl.lines()
+	if len(lines) != 1 || lines[0] != "second (partial)" {
+		t.Errorf("got %q, want the completed partial line", lines)
+	}
+}
+
+func TestTailerFollowsRotation(t *testing.T) {
+	setupTestGlobals()
+	dir := t.TempDir()
+	name := dir + "/access_log"
+	appendToFile(t, name, "")
+
+	tl, err := openTailer(name, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+
+	appendToFile(t, name, "before rotation\n")
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, name+".1", "late write to old file\n")
+	appendToFile(t, name, "after rotation\n")
+
+	lines, err := tl.lines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"before rotation", "late write to old file", "after rotation"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+}
+
+func TestTailerFollowsTruncation(t *testing.T) {
+	setupTestGlobals()
+	name := t.TempDir() + "/access_log"
+	appendToFile(t, name, "one\ntwo\n")
+
+	tl, err := openTailer(name, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+	tl.lines()
+
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	tl.lines()
+	appendToFile(t, name, "three\n")
+	lines, _ := tl.lines()
+	if len(lines) != 1 || lines[0] != "three" {
+		t.Errorf("got %q, want [three]", lines)
+	}
+}
+
+// ──────────────────────────────────────────────
+// followWindow
+// ──────────────────────────────────────────────
+
+func TestFollowWindowEvicts(t *testing.T) {
+	setupTestGlobals()
+	now := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	w := newFollowWindow(5 * time.Minute)
+	w.add(LogEntry{Class: "1.1.1.1", Code: 200, TimeStamp: now.Add(-10 * time.Minute)})
+	w.add(LogEntry{Class: "1.1.1.1", Code: 404, TimeStamp: now.Add(-4 * time.Minute)})
+	w.add(LogEntry{Class: "2.2.2.2", Code: 200, TimeStamp: now.Add(-time.Minute)})
+
+	w.evict(now)
+
+	if len(w.entries) != 2 {
+		t.Errorf("entries: got %d, want 2", len(w.entries))
+	}
+	if w.classCount["1.1.1.1"] != 1 || w.classCount["2.2.2.2"] != 1 {
+		t.Errorf("classCount: got %v", w.classCount)
+	}
+	if w.codeCount[200] != 1 || w.codeCount[404] != 1 {
+		t.Errorf("codeCount: got %v", w.codeCount)
+	}
+
+	w.evict(now.Add(time.Hour))
+	if len(w.entries) != 0 || len(w.classCount) != 0 || len(w.codeCount) != 0 {
+		t.Errorf("window should be empty: %v %v", w.classCount, w.codeCount)
+	}
+}
+
+func TestFollowWindowEvictsOutOfOrder(t *testing.T) {
+	setupTestGlobals()
+	now := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	w := newFollowWindow(5 * time.Minute)
+	w.add(LogEntry{Class: "2.2.2.2", Code: 200, TimeStamp: now.Add(-time.Minute)})
+	w.add(LogEntry{Class: "1.1.1.1", Code: 404, TimeStamp: now.Add(-10 * time.Minute)})
+	w.add(LogEntry{Class: "1.1.1.1", Code: 200, TimeStamp: now.Add(-4 * time.Minute)})
+	w.add(LogEntry{Class: "3.3.3.3", Code: 500, TimeStamp: now.Add(-20 * time.Minute)})
+
+	w.evict(now)
+
+	if len(w.entries) != 2 {
+		t.Errorf("entries: got %d, want 2", len(w.entries))
+	}
+	if w.classCount["1.1.1.1"] != 1 || w.classCount["2.2.2.2"] != 1 || w.classCount["3.3.3.3"] != 0 {
+		t.Errorf("classCount: got %v", w.classCount)
+	}
+	if w.codeCount[200] != 2 || w.codeCount[404] != 0 || w.codeCount[500] != 0 {
+		t.Errorf("codeCount: got %v", w.codeCount)
+	}
+}
+
+func TestFollowWindowRender(t *testing.T) {
+	setupTestGlobals()
+	now := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	w := newFollowWindow(5 * time.Minute)
+	w.add(LogEntry{Class: "1.1.1.1", Code: 200, TimeStamp: now})
+	w.add(LogEntry{Class: "1.1.1.1", Code: 503, TimeStamp: now})
+
+	var out bytes.Buffer
+	w.render(&out, now, []string{"access_log"})
+	s := out.String()
+
+	for _, want := range []string{"\033[2J", "following access_log", "2 requests", "1.1.1.1\t: 2", "503\t: 1"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("render output missing %q, got: %s", want, s)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// Follow
+// ──────────────────────────────────────────────
+
+func TestFollowShowsNewEntries(t *testing.T) {
+	setupTestGlobals()
+	name := t.TempDir() + "/access_log"
+	ts := func(d time.Duration) string {
+		return time.Now().Add(d).Format("02/Jan/2006:15:04:05 -0700")
+	}
+	appendToFile(t, name, fmt.Sprintf("9.9.9.9 - - [%s] \"GET /old HTTP/1.1\" 200 1 \"-\" \"-\"\n", ts(-time.Hour)))
+	appendToFile(t, name, fmt.Sprintf("8.8.8.8 - - [%s] \"GET /recent HTTP/1.1\" 200 1 \"-\" \"-\"\n", ts(-time.Minute)))
+
+	l := &Log2Analyze{FileName: name, DateLayout: "02/Jan/2006:15:04:05 -0700"}
+	log2Analyze = l
+	var out bytes.Buffer
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- l.Follow(5, 0, &out, stop) }()
+
+	time.Sleep(100 * time.Millisecond)
+	appendToFile(t, name, fmt.Sprintf("7.7.7.7 - - [%s] \"GET /new HTTP/1.1\" 404 1 \"-\" \"-\"\n", ts(0)))
+	time.Sleep(2 * followPollInterval)
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	frames := strings.Split(out.String(), "\033[H\033[2J")
+	last := frames[len(frames)-1]
+	if !strings.Contains(last, "8.8.8.8") || !strings.Contains(last, "7.7.7.7") {
+		t.Errorf("last frame should show the recent and the new entry, got: %s", last)
+	}
+	if strings.Contains(last, "9.9.9.9") {
+		t.Errorf("last frame should not show entries outside the window, got: %s", last)
+	}
+}
@@ -2,4 +2,11 @@ module github.com/SvenKethz/topFive
 
 go 1.24.1
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/oschwald/maxminddb-golang v1.13.1
+	golang.org/x/term v0.32.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.41.0 // indirect
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// groupKeySeparator separates the fields of a key grouped by several fields
+// (e.g. -by ip,ua).
+const groupKeySeparator = " | "
+
+// groupFields returns the value of each field the entries can be grouped by
+// with -by. path-prefix is handled by parseGroupBy.
+var groupFields = map[string]func(LogEntry) string{
+	"ip":       func(e LogEntry) string { return e.IP },
+	"class":    func(e LogEntry) string { return ipToClass(e.IP) },
+	"path":     func(e LogEntry) string { return requestPath(e.Request) },
+	"ua":       func(e LogEntry) string { return e.UserAgent },
+	"ua-class": func(e LogEntry) string { return e.UAClass },
+	"method":   func(e LogEntry) string { return e.Method },
+	"code":     func(e LogEntry) string { return strconv.Itoa(e.Code) },
+	"referer":  func(e LogEntry) string { return e.Referer },
+	"vhost":    func(e LogEntry) string { return e.VHost },
+	"asn":      func(e LogEntry) string { return ipDatabases.asnKey(e.IP) },
+	"country":  func(e LogEntry) string { return ipDatabases.countryKey(e.IP) },
+}
+
+// groupByFields are the fields of -by, parsed once by main with
+// parseGroupBy. It is nil for the default -by class, which uses the class of
+// the entry directly.
+var groupByFields []func(LogEntry) string
+
+// requestPath returns the path of request without the query string.
+func requestPath(request string) string {
+	path, _, _ := strings.Cut(request, "?")
+	return path
+}
+
+// pathPrefix returns the first depth segments of the path of request, e.g.
+// /api/v1 for /api/v1/users?id=1 and depth 2.
+func pathPrefix(request string, depth int) string {
+	path := requestPath(request)
+	if !strings.HasPrefix(path, "/") {
+		return path
+	}
+	segments := strings.SplitN(path[1:], "/", depth+1)
+	if len(segments) > depth {
+		segments = segments[:depth]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// parseGroupBy returns the functions computing the fields of the -by value
+// spec: a comma separated list of ip, class, path, path-prefix, ua, ua-class,
+// method, code, referer, vhost, asn and country. path-prefix keeps the first
+// path segment; path-prefix:N keeps N segments.
+func parseGroupBy(spec string) ([]func(LogEntry) string, error) {
+	var fields []func(LogEntry) string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if field, ok := groupFields[name]; ok {
+			fields = append(fields, field)
+			continue
+		}
+		if rest, ok := strings.CutPrefix(name, "path-prefix"); ok {
+			depth := 1
+			if rest != "" {
+				n, err := strconv.Atoi(strings.TrimPrefix(rest, ":"))
+				if err != nil || !strings.HasPrefix(rest, ":") || n < 1 {
+					return nil, fmt.Errorf("invalid -by field %q, use path-prefix or path-prefix:N", name)
+				}
+				depth = n
+			}
+			fields = append(fields, func(e LogEntry) string { return pathPrefix(e.Request, depth) })
+			continue
+		}
+		return nil, fmt.Errorf("unknown -by field %q, use ip, class, path, path-prefix, ua, ua-class, method, code, referer, vhost, asn or country", name)
+	}
+	return fields, nil
+}
+
+// applyGroupBy parses the -by value and sets groupByFields.
+func applyGroupBy() error {
+	fields, err := parseGroupBy(*groupBy)
+	if err != nil {
+		return err
+	}
+	groupByFields = nil
+	if *groupBy != "class" {
+		groupByFields = fields
+	}
+	return nil
+}
+
+// groupKey returns the key entry is counted under: the values of the -by
+// fields joined by groupKeySeparator. Empty values are shown as "-".
+func groupKey(entry LogEntry) string {
+	if groupByFields == nil {
+		return entry.Class
+	}
+	values := make([]string, len(groupByFields))
+	for i, field := range groupByFields {
+		if values[i] = field(entry); values[i] == "" {
+			values[i] = "-"
+		}
+	}
+	return strings.Join(values, groupKeySeparator)
+}
+
+// groupByUses reports whether field is one of the -by fields.
+func groupByUses(field string) bool {
+	for _, name := range strings.Split(*groupBy, ",") {
+		if strings.TrimSpace(name) == field {
+			return true
+		}
+	}
+	return false
+}
+
+// groupsByAddress reports whether the keys of -by are IP addresses or
+// networks, as needed for block lists.
+func groupsByAddress() bool {
+	return *groupBy == "ip" || *groupBy == "class"
+}
+
+// groupLabel returns the name of the keys in the output, e.g. "IPs" or "path".
+func groupLabel() string {
+	if groupsByAddress() {
+		return "IPs"
+	}
+	return *groupBy
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const groupByTestLine = `10.20.30.40 - - [10/Feb/2026:12:00:00 +0000] "GET /api/v1/users?id=7 HTTP/1.1" 404 512 "https://example.org/start" "Mozilla/5.0 (X11; Linux)"`
+
+// useGroupBy sets -by to spec as main does.
+func useGroupBy(t *testing.T, spec string) {
+	t.Helper()
+	groupBy = &spec
+	if err := applyGroupBy(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ──────────────────────────────────────────────
+// parseGroupBy / groupKey
+// ──────────────────────────────────────────────
+
+func TestGroupKeyFields(t *testing.T) {
+	setupTestGlobals()
+	tests := map[string]string{
+		"class":         "10.20.30.40",
+		"ip":            "10.20.30.40",
+		"path":          "/api/v1/users",
+		"path-prefix":   "/api",
+		"path-prefix:2": "/api/v1",
+		"path-prefix:9": "/api/v1/users",
+		"ua":            "Mozilla/5.0 (X11; Linux)",
+		"method":        "GET",
+		"code":          "404",
+		"referer":       "https://example.org/start",
+		"vhost":         "-",
+		"ip,code":       "10.20.30.40 | 404",
+		"ip, ua":        "10.20.30.40 | Mozilla/5.0 (X11; Linux)",
+	}
+	for by, want := range tests {
+		useGroupBy(t, by)
+		if got := createEntry(groupByTestLine).Class; got != want {
+			t.Errorf("-by %s: got %q, want %q", by, got, want)
+		}
+	}
+}
+
+func TestGroupKeyClassUsesIPClass(t *testing.T) {
+	setupTestGlobals()
+	useIPClass(t, "C")
+	for _, by := range []string{"class", "class,method"} {
+		useGroupBy(t, by)
+		want := map[string]string{"class": "10.20.30.0/24", "class,method": "10.20.30.0/24 | GET"}[by]
+		if got := createEntry(groupByTestLine).Class; got != want {
+			t.Errorf("-by %s: got %q, want %q", by, got, want)
+		}
+	}
+	useGroupBy(t, "ip")
+	if got := createEntry(groupByTestLine).Class; got != "10.20.30.40" {
+		t.Errorf("-by ip should ignore -k, got %q", got)
+	}
+}
+
+func TestParseGroupByInvalid(t *testing.T) {
+	for _, spec := range []string{"", "host", "ip,", "path-prefix:0", "path-prefix:x", "path-prefix2"} {
+		if _, err := parseGroupBy(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestPathPrefix(t *testing.T) {
+	tests := []struct {
+		request string
+		depth   int
+		want    string
+	}{
+		{"/", 1, "/"},
+		{"/index.html", 1, "/index.html"},
+		{"/a/b/c?x=/y/z", 2, "/a/b"},
+		{"*", 1, "*"},
+	}
+	for _, tt := range tests {
+		if got := pathPrefix(tt.request, tt.depth); got != tt.want {
+			t.Errorf("pathPrefix(%q, %d): got %q, want %q", tt.request, tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestGroupLabel(t *testing.T) {
+	setupTestGlobals()
+	if groupLabel() != "IPs" || !groupsByAddress() {
+		t.Errorf("default: got %q", groupLabel())
+	}
+	useGroupBy(t, "path,code")
+	if groupLabel() != "path,code" || groupsByAddress() {
+		t.Errorf("-by path,code: got %q", groupLabel())
+	}
+}
+
+// ──────────────────────────────────────────────
+// parseGenericEntry — Referer / VHost
+// ──────────────────────────────────────────────
+
+func TestParseGenericEntryRefererAndVHost(t *testing.T) {
+	setupTestGlobals()
+	entry := parseGenericEntry(groupByTestLine)
+	if entry.Referer != "https://example.org/start" || entry.VHost != "" {
+		t.Errorf("got referer %q, vhost %q", entry.Referer, entry.VHost)
+	}
+
+	// Apache vhost_combined: %v:%p %h ...
+	config.LogFormat = LogFormatConfig{IP: 1, IPFallback: -1, TimeStamp: 4, Method: 6, Request: 7, Code: 9, UserAgent: 12, Referer: 11, VHost: 0}
+	entry = parseGenericEntry(`www.example.org:443 ` + groupByTestLine)
+	if entry.VHost != "www.example.org:443" || entry.IP != "10.20.30.40" || entry.Referer != "https://example.org/start" {
+		t.Errorf("vhost_combined: got %+v", entry)
+	}
+}
+
+// ──────────────────────────────────────────────
+// RetrieveEntries / WriteOutputFiles with -by
+// ──────────────────────────────────────────────
+
+func TestRetrieveEntriesGroupByPath(t *testing.T) {
+	setupTestGlobals()
+	useGroupBy(t, "path")
+	logContent := `10.0.0.1 - - [10/Feb/2026:12:00:00 +0000] "GET /login?u=a HTTP/1.1" 200 100 "-" "-"
+10.0.0.2 - - [10/Feb/2026:12:01:00 +0000] "GET /login?u=b HTTP/1.1" 401 100 "-" "-"
+10.0.0.1 - - [10/Feb/2026:12:02:00 +0000] "GET / HTTP/1.1" 200 100 "-" "-"
+`
+	tmpFile := writeTempLogFile(t, logContent)
+	defer os.Remove(tmpFile)
+
+	l := &Log2Analyze{FileName: tmpFile, DateLayout: "02/Jan/2006:15:04:05 -0700"}
+	log2Analyze = l
+	l.RetrieveEntries("12:05", 0)
+
+	topIPs, _ := l.GetTopIPs()
+	if topIPs["/login"] != 2 || topIPs["/"] != 1 || len(topIPs) != 2 {
+		t.Errorf("got %v", topIPs)
+	}
+
+	dir := t.TempDir()
+	config.OutputFolder = dir + "/"
+	l.WriteOutputFiles(topIPs, map[int]int{})
+	for _, name := range []string{"00002__login.txt", "00001__.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestWriteOutputFilesFileNameCollision(t *testing.T) {
+	setupTestGlobals()
+	useGroupBy(t, "path")
+	dir := t.TempDir()
+	config.OutputFolder = dir + "/"
+
+	l := Log2Analyze{
+		FileName: "test.log",
+		Entries: []LogEntry{
+			{IP: "10.0.0.1", Class: "/a b", Request: "/a b"},
+			{IP: "10.0.0.2", Class: "/a_b", Request: "/a_b"},
+		},
+	}
+	l.WriteOutputFiles(map[string]int{"/a b": 1, "/a_b": 1}, map[int]int{})
+
+	first, _ := os.ReadFile(filepath.Join(dir, "00001__a_b.txt"))
+	second, _ := os.ReadFile(filepath.Join(dir, "00001__a_b_2.txt"))
+	if string(first[:5]) != "/a b\t" || string(second[:5]) != "/a_b\t" {
+		t.Errorf("got %q and %q", first, second)
+	}
+}
+
+func TestClassFileName(t *testing.T) {
+	tests := map[string]string{
+		"10.20.30.0/24":     "10.20.30.0_24",
+		"2001:db8::/48":     "2001:db8::_48",
+		"10.0.0.1 | 404":    "10.0.0.1___404",
+		"../../etc/passwd":  ".._.._etc_passwd",
+		"Mozilla/5.0 (X11)": "Mozilla_5.0__X11_",
+	}
+	for class, want := range tests {
+		if got := classFileName(class); got != want {
+			t.Errorf("%q: got %q, want %q", class, got, want)
+		}
+	}
+	long := classFileName(string(make([]byte, 300)))
+	if len(long) != 100 {
+		t.Errorf("long keys should be cut to 100 characters, got %d", len(long))
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+
+	"golang.org/x/term"
 )
 
 // FlagIsPassed reports whether the flag with the given name was explicitly set
@@ -68,12 +70,16 @@ func CheckIfDir(path string) bool {
 }
 
 // ToBeCreated prompts the user interactively to create the missing directory at path.
+// Without a terminal on stdin (e.g. when the log is piped in with -f -) it
+// does not ask and the directory is not created.
 func ToBeCreated(path string) {
 	fmt.Println("the folder " + path + " is missing")
 	var anlegen string
 	yes := []string{"j", "J", "y", "Y"}
-	fmt.Print("shall I create it? (y|n) [n]: ")
-	fmt.Scanln(&anlegen)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Print("shall I create it? (y|n) [n]: ")
+		fmt.Scanln(&anlegen)
+	}
 	if StringInSlice(anlegen, yes) {
 		if err := os.MkdirAll(path, 0750); err != nil && !os.IsExist(err) {
 			fmt.Println(err)
@@ -123,6 +129,55 @@ func CheckSum(hashAlgorithm hash.Hash, filename string) (string, error) {
 	}
 }
 
+// stringList is a flag.Value that collects the values of a flag that may be
+// given several times. The first Set replaces the default values.
+type stringList struct {
+	values []string
+	set    bool
+}
+
+// String returns the values joined by commas.
+func (s *stringList) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(s.values, ",")
+}
+
+// Set adds value to the list.
+func (s *stringList) Set(value string) error {
+	if !s.set {
+		s.values = nil
+		s.set = true
+	}
+	s.values = append(s.values, value)
+	return nil
+}
+
+// ExpandFiles expands glob patterns (e.g. /var/log/httpd/*access_log*) in
+// patterns into the matching file names. Plain paths are returned unchanged,
+// duplicates are removed. A pattern without matches is reported and skipped.
+func ExpandFiles(patterns []string) []string {
+	var files []string
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil || len(matches) == 0 {
+				fmt.Println("no files match " + pattern)
+				continue
+			}
+		}
+		for _, match := range matches {
+			if !StringInSlice(match, files) {
+				files = append(files, match)
+			}
+		}
+	}
+	return files
+}
+
 // SortMapByValueDesc is a stub. TODO: not yet implemented.
 func SortMapByValueDesc() {}
 
@@ -132,12 +187,16 @@ func SortMapByValueAsc() {}
 // BuildOutputHeader formats a human-readable header summarizing the analysis.
 // If timestamps contains exactly two entries they are shown as a time range.
 // The infos map is rendered as key-value pairs below the filename line.
-func BuildOutputHeader(logfile string, datetime string, timestamps []string, infos map[string]string) string {
+func BuildOutputHeader(logfiles []string, datetime string, timestamps []string, infos map[string]string) string {
 	header := "We analyzed "
 	if len(timestamps) == 2 {
 		header += "the time between " + timestamps[0] + " and " + timestamps[1] + " in\n"
 	}
-	header += "the file: " + logfile
+	if len(logfiles) == 1 {
+		header += "the file: " + logfiles[0]
+	} else {
+		header += "the files: " + strings.Join(logfiles, ", ")
+	}
 	header += "\n================================================================================\n"
 	for key, count := range infos {
 		header += "\n\t" + key + "\t: " + count
@@ -231,7 +231,7 @@ func TestBuildOutputHeader(t *testing.T) {
 	t.Run("with timestamps", func(t *testing.T) {
 		timestamps := []string{"2026-02-10 12:00", "2026-02-10 12:05"}
 		infos := map[string]string{"Total requests": "100"}
-		got := BuildOutputHeader("test.log", "20260210_120500", timestamps, infos)
+		got := BuildOutputHeader([]string{"test.log"}, "20260210_120500", timestamps, infos)
 		if !contains(got, "the time between 2026-02-10 12:00 and 2026-02-10 12:05") {
 			t.Errorf("header missing time range, got: %s", got)
 		}
@@ -243,7 +243,7 @@ func TestBuildOutputHeader(t *testing.T) {
 		}
 	})
 	t.Run("without timestamps", func(t *testing.T) {
-		got := BuildOutputHeader("test.log", "20260210_120500", nil, map[string]string{})
+		got := BuildOutputHeader([]string{"test.log"}, "20260210_120500", nil, map[string]string{})
 		if contains(got, "the time between") {
 			t.Errorf("header should not contain time range, got: %s", got)
 		}
@@ -253,19 +253,66 @@ func TestBuildOutputHeader(t *testing.T) {
 	})
 	t.Run("with infos", func(t *testing.T) {
 		infos := map[string]string{"key1": "val1", "key2": "val2"}
-		got := BuildOutputHeader("test.log", "20260210_120500", nil, infos)
+		got := BuildOutputHeader([]string{"test.log"}, "20260210_120500", nil, infos)
 		if !contains(got, "key1") || !contains(got, "val1") {
 			t.Errorf("header missing info entries, got: %s", got)
 		}
 	})
 	t.Run("without infos", func(t *testing.T) {
-		got := BuildOutputHeader("test.log", "20260210_120500", nil, map[string]string{})
+		got := BuildOutputHeader([]string{"test.log"}, "20260210_120500", nil, map[string]string{})
 		if !contains(got, "test.log") {
 			t.Errorf("header missing filename, got: %s", got)
 		}
 	})
 }
 
+func TestBuildOutputHeaderMultipleFiles(t *testing.T) {
+	got := BuildOutputHeader([]string{"a.log", "b.log"}, "20260210_120500", nil, map[string]string{})
+	if !contains(got, "the files: a.log, b.log") {
+		t.Errorf("header missing file list, got: %s", got)
+	}
+}
+
+// ──────────────────────────────────────────────
+// stringList / ExpandFiles
+// ──────────────────────────────────────────────
+
+func TestStringListReplacesDefault(t *testing.T) {
+	l := &stringList{values: []string{"default"}}
+	l.Set("a")
+	l.Set("b")
+	if got := l.String(); got != "a,b" {
+		t.Errorf("got %q, want %q", got, "a,b")
+	}
+}
+
+func TestExpandFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"ssl_access_log", "ssl_access_log.1", "error_log"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(""), 0644)
+	}
+
+	got := ExpandFiles([]string{
+		filepath.Join(dir, "*access_log*"),
+		filepath.Join(dir, "ssl_access_log"), // duplicate of a glob match
+		filepath.Join(dir, "missing*"),       // no match
+		"/plain/path",
+	})
+	want := []string{
+		filepath.Join(dir, "ssl_access_log"),
+		filepath.Join(dir, "ssl_access_log.1"),
+		"/plain/path",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
 // contains is a small test helper for substring matching.
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && searchSubstring(s, substr)
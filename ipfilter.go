@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// ipFilter is a set of IP addresses and networks for the -i and -ni filters.
+// The networks are stored in a binary prefix trie per address family, so a
+// lookup takes at most 32 (IPv4) or 128 (IPv6) steps however long the list is.
+type ipFilter struct {
+	v4, v6 *trieNode
+	size   int
+}
+
+// trieNode is a node of the prefix trie; end marks the last bit of a network.
+type trieNode struct {
+	child [2]*trieNode
+	end   bool
+}
+
+// newIPFilter builds a filter from values: IP addresses, CIDRs and @file
+// references to files listing one address or CIDR per line (empty lines and
+// lines starting with # are ignored).
+func newIPFilter(values []string) (*ipFilter, error) {
+	f := &ipFilter{v4: &trieNode{}, v6: &trieNode{}}
+	for _, value := range values {
+		if name, ok := strings.CutPrefix(value, "@"); ok {
+			if err := f.addFile(name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := f.add(value); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// addFile adds the addresses and networks listed in the file name.
+func (f *ipFilter) addFile(name string) error {
+	file, err := os.Open(GetCleanPath(name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		value := strings.TrimSpace(scanner.Text())
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+		if err := f.add(value); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// add inserts a single address or CIDR into the trie.
+func (f *ipFilter) add(value string) error {
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an IP address or CIDR", value)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	node := f.v6
+	if prefix.Addr().Is4() {
+		node = f.v4
+	}
+	bytes := prefix.Addr().AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := bytes[i/8] >> (7 - i%8) & 1
+		if node.child[bit] == nil {
+			node.child[bit] = &trieNode{}
+		}
+		node = node.child[bit]
+	}
+	node.end = true
+	f.size++
+	return nil
+}
+
+// Contains reports whether ip lies in one of the networks of the filter.
+// Malformed addresses are never contained.
+func (f *ipFilter) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+	node := f.v6
+	if addr.Is4() {
+		node = f.v4
+	}
+	bytes := addr.AsSlice()
+	for i := 0; node != nil; i++ {
+		if node.end {
+			return true
+		}
+		if i == addr.BitLen() {
+			return false
+		}
+		node = node.child[bytes[i/8]>>(7-i%8)&1]
+	}
+	return false
+}
+
+// Len returns the number of addresses and networks in the filter.
+func (f *ipFilter) Len() int {
+	return f.size
+}
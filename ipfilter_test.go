@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ──────────────────────────────────────────────
+// newIPFilter / Contains
+// ──────────────────────────────────────────────
+
+func TestIPFilterExactAddress(t *testing.T) {
+	f, err := newIPFilter([]string{"10.1.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Contains("10.1.1.1") {
+		t.Error("10.1.1.1 should be contained")
+	}
+	// the old string prefix comparison matched these as well
+	for _, ip := range []string{"10.1.1.100", "10.1.1.10", "10.1.1"} {
+		if f.Contains(ip) {
+			t.Errorf("%s should not be contained", ip)
+		}
+	}
+}
+
+func TestIPFilterCIDRAndIPv6(t *testing.T) {
+	f, err := newIPFilter([]string{"10.0.0.0/8", "192.0.2.128/25", "2001:db8:abcd::/48", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"10.200.3.4":           true,
+		"11.0.0.1":             false,
+		"192.0.2.200":          true,
+		"192.0.2.127":          false,
+		"2001:db8:abcd:12::1":  true,
+		"2001:db8:abce::1":     false,
+		"::1":                  true,
+		"[::1]":                true,
+		"::ffff:10.1.2.3":      true,
+		"fe80::1%eth0":         false,
+		"-":                    false,
+		"":                     false,
+		"2001:db8:abcd::/48":   false,
+		"not-an-address.local": false,
+	}
+	for ip, want := range tests {
+		if got := f.Contains(ip); got != want {
+			t.Errorf("%q: got %v, want %v", ip, got, want)
+		}
+	}
+	if f.Len() != 4 {
+		t.Errorf("Len: got %d, want 4", f.Len())
+	}
+}
+
+func TestIPFilterWholeFamily(t *testing.T) {
+	f, err := newIPFilter([]string{"0.0.0.0/0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Contains("203.0.113.5") || f.Contains("2001:db8::1") {
+		t.Error("0.0.0.0/0 should contain all IPv4 and no IPv6 addresses")
+	}
+}
+
+func TestIPFilterFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "internal.txt")
+	content := "# monitoring\n198.51.100.7\n\n  10.0.0.0/8  \n# IPv6\n2001:db8::/32\n"
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newIPFilter([]string{"@" + name, "203.0.113.9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"198.51.100.7", "10.9.9.9", "2001:db8:1::1", "203.0.113.9"} {
+		if !f.Contains(ip) {
+			t.Errorf("%s should be contained", ip)
+		}
+	}
+	if f.Len() != 4 {
+		t.Errorf("Len: got %d, want 4", f.Len())
+	}
+}
+
+func TestIPFilterErrors(t *testing.T) {
+	if _, err := newIPFilter([]string{"10.1.1"}); err == nil {
+		t.Error("expected an error for an incomplete address")
+	}
+	if _, err := newIPFilter([]string{"@/nonexistent/list.txt"}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	name := filepath.Join(t.TempDir(), "bad.txt")
+	os.WriteFile(name, []byte("10.0.0.1\nnonsense\n"), 0644)
+	if _, err := newIPFilter([]string{"@" + name}); err == nil {
+		t.Error("expected an error for an invalid line")
+	}
+}
+
+func TestIPFilterLargeList(t *testing.T) {
+	values := make([]string, 0, 65536)
+	for i := 0; i < 65536; i++ {
+		values = append(values, fmt.Sprintf("10.%d.%d.0/24", i/256, i%256))
+	}
+	f, err := newIPFilter(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Contains("10.200.100.7") || f.Contains("11.0.0.1") {
+		t.Error("wrong result for a large list")
+	}
+}
+
+// ──────────────────────────────────────────────
+// matches with IP filters
+// ──────────────────────────────────────────────
+
+func TestMatchesIPFilters(t *testing.T) {
+	setupTestGlobals()
+	include, _ := newIPFilter([]string{"10.0.0.0/8"})
+	exclude, _ := newIPFilter([]string{"10.1.1.1"})
+	l := &Log2Analyze{IPFilter: include, NotIPFilter: exclude}
+	tests := map[string]bool{
+		"10.1.1.1":    false,
+		"10.1.1.100":  true,
+		"192.168.1.1": false,
+	}
+	for ip, want := range tests {
+		if got := l.matches(LogEntry{IP: ip}, 0); got != want {
+			t.Errorf("%s: got %v, want %v", ip, got, want)
+		}
+	}
+
+	l = &Log2Analyze{NotIPFilter: exclude}
+	if !l.matches(LogEntry{IP: "-"}, 0) {
+		t.Error("a malformed IP should not be excluded by -ni")
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields of a LogEntry a log format directive can be mapped to. Directives
+// mapped to fieldIgnore are skipped.
+const (
+	fieldIgnore      = ""
+	fieldIP          = "ip"
+	fieldTime        = "time"
+	fieldTimeISO8601 = "time_iso8601"
+	fieldTimeMsec    = "msec"
+	fieldRequestLine = "request_line"
+	fieldMethod      = "method"
+	fieldRequest     = "request"
+	fieldCode        = "code"
+	fieldRTime       = "rtime"
+	fieldUserAgent   = "ua"
+	fieldReferer     = "referer"
+	fieldVHost       = "vhost"
+)
+
+// apacheDirectives maps the Apache mod_log_config directives to their field.
+// Directives with a {parameter} are handled by apacheField.
+var apacheDirectives = map[string]string{
+	"h": fieldIP,
+	"a": fieldIP,
+	"t": fieldTime,
+	"r": fieldRequestLine,
+	"m": fieldMethod,
+	"U": fieldRequest,
+	"s": fieldCode,
+	"D": fieldRTime,
+	"T": fieldRTime,
+	"v": fieldVHost,
+	"V": fieldVHost,
+}
+
+// nginxVariables maps the nginx log_format variables to their field.
+var nginxVariables = map[string]string{
+	"remote_addr":            fieldIP,
+	"realip_remote_addr":     fieldIP,
+	"time_local":             fieldTime,
+	"time_iso8601":           fieldTimeISO8601,
+	"msec":                   fieldTimeMsec,
+	"request":                fieldRequestLine,
+	"request_method":         fieldMethod,
+	"request_uri":            fieldRequest,
+	"uri":                    fieldRequest,
+	"status":                 fieldCode,
+	"request_time":           fieldRTime,
+	"upstream_response_time": fieldRTime,
+	"http_user_agent":        fieldUserAgent,
+	"http_referer":           fieldReferer,
+	"host":                   fieldVHost,
+	"server_name":            fieldVHost,
+}
+
+// splitFields splits a log line into its fields. Fields are separated by
+// spaces, except within double quotes, where \" and \\ are unescaped, and
+// within a field starting with "[", which ends at the next "]". Quotes and
+// brackets are removed, so `[10/Feb/2026:12:00:00 +0100] "GET / HTTP/1.1"`
+// gives the two fields `10/Feb/2026:12:00:00 +0100` and `GET / HTTP/1.1`.
+func splitFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	i := 0
+	for i < len(line) {
+		if line[i] == ' ' {
+			i++
+			continue
+		}
+		field.Reset()
+		if line[i] == '[' {
+			end := strings.IndexByte(line[i:], ']')
+			if end < 0 {
+				end = len(line) - i
+			}
+			fields = append(fields, line[i+1:i+end])
+			i += end + 1
+			continue
+		}
+		for i < len(line) && line[i] != ' ' {
+			if line[i] != '"' {
+				field.WriteByte(line[i])
+				i++
+				continue
+			}
+			// quoted section, up to the next unescaped quote
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+					i++
+				}
+				field.WriteByte(line[i])
+			}
+			i++
+		}
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// lineFormat is a log format compiled from an Apache LogFormat or nginx
+// log_format string (LogFormatConfig.Format). Its tokens correspond to the
+// fields of splitFields applied to a log line.
+//
+// rtimeUnit is the divisor converting the response time to seconds, derived
+// from the response-time directive of the format (0 if it has none).
+type lineFormat struct {
+	tokens    []formatToken
+	rtimeUnit int
+}
+
+// formatToken is a token of a lineFormat: the fields it contains, surrounded
+// by literal text. literals has one element more than fields, e.g. for
+// "rt=%D" literals is ["rt=", ""] and fields is [rtime]. rtimeUnit is the
+// unit of its response-time field, if it has one.
+type formatToken struct {
+	literals  []string
+	fields    []string
+	rtimeUnit int
+}
+
+// compileLogFormat compiles an Apache LogFormat string such as
+// `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i" %D`, or an nginx
+// log_format string such as `$remote_addr - $remote_user [$time_local]
+// "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`.
+// Directives and variables without a LogEntry field are skipped. Two
+// directives must be separated by literal text, so "%U%q" is an error; use
+// "%r" instead.
+func compileLogFormat(format string) (*lineFormat, error) {
+	f := &lineFormat{}
+	nginx := strings.Contains(format, "$")
+	tokens := splitFields(format)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("log format %q has no fields", format)
+	}
+	for _, text := range tokens {
+		var token formatToken
+		var err error
+		if nginx {
+			token, err = parseNginxToken(text)
+		} else {
+			token, err = parseApacheToken(text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("log format %q: %w", format, err)
+		}
+		for i := 1; i < len(token.fields); i++ {
+			if token.literals[i] == "" {
+				return nil, fmt.Errorf("log format %q: %q has two fields without a separator", format, text)
+			}
+		}
+		if token.rtimeUnit > 0 {
+			f.rtimeUnit = token.rtimeUnit
+		}
+		f.tokens = append(f.tokens, token)
+	}
+	return f, nil
+}
+
+// parseApacheToken parses a token of an Apache LogFormat string. A directive
+// is "%", an optional "{parameter}", optional "<" or ">" modifiers or status
+// conditions, and a letter; "%%" is a literal "%".
+func parseApacheToken(text string) (formatToken, error) {
+	token := formatToken{literals: []string{""}}
+	for i := 0; i < len(text); i++ {
+		if text[i] != '%' {
+			token.literals[len(token.literals)-1] += text[i : i+1]
+			continue
+		}
+		i++
+		if i < len(text) && text[i] == '%' {
+			token.literals[len(token.literals)-1] += "%"
+			continue
+		}
+		param := ""
+		if i < len(text) && text[i] == '{' {
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				return token, fmt.Errorf("unterminated %%{ in %q", text)
+			}
+			param = text[i+1 : i+end]
+			i += end + 1
+		}
+		for i < len(text) && strings.IndexByte("<>!,0123456789", text[i]) >= 0 {
+			i++
+		}
+		if i >= len(text) {
+			return token, fmt.Errorf("incomplete directive in %q", text)
+		}
+		field, unit := apacheField(text[i:i+1], param)
+		if unit > 0 {
+			token.rtimeUnit = unit
+		}
+		token.fields = append(token.fields, field)
+		token.literals = append(token.literals, "")
+	}
+	return token, nil
+}
+
+// apacheField returns the field of the Apache directive %{param}letter and,
+// for the response time, its unit: microseconds for %D and %{us}T,
+// milliseconds for %{ms}T and seconds for %T.
+func apacheField(letter, param string) (field string, rtimeUnit int) {
+	switch {
+	case letter == "i" && strings.EqualFold(param, "User-Agent"):
+		return fieldUserAgent, 0
+	case letter == "i" && strings.EqualFold(param, "Referer"):
+		return fieldReferer, 0
+	case letter == "D" || letter == "T" && param == "us":
+		return fieldRTime, 1000000
+	case letter == "T" && param == "ms":
+		return fieldRTime, 1000
+	case letter == "T":
+		return fieldRTime, 1
+	case param != "" && letter != "t" && !(letter == "a" && param == "c"):
+		return fieldIgnore, 0
+	}
+	return apacheDirectives[letter], 0
+}
+
+// parseNginxToken parses a token of an nginx log_format string. A variable
+// is "$name" or "${name}".
+func parseNginxToken(text string) (formatToken, error) {
+	token := formatToken{literals: []string{""}}
+	for i := 0; i < len(text); i++ {
+		if text[i] != '$' {
+			token.literals[len(token.literals)-1] += text[i : i+1]
+			continue
+		}
+		var name string
+		if i+1 < len(text) && text[i+1] == '{' {
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				return token, fmt.Errorf("unterminated ${ in %q", text)
+			}
+			name = text[i+2 : i+end]
+			i += end
+		} else {
+			j := i + 1
+			for j < len(text) && (text[j] == '_' || text[j] >= 'a' && text[j] <= 'z' || text[j] >= 'A' && text[j] <= 'Z' || text[j] >= '0' && text[j] <= '9') {
+				j++
+			}
+			name = text[i+1 : j]
+			i = j - 1
+		}
+		if name == "" {
+			return token, fmt.Errorf("empty variable in %q", text)
+		}
+		field := nginxVariables[name]
+		if field == fieldRTime {
+			token.rtimeUnit = 1
+		}
+		token.fields = append(token.fields, field)
+		token.literals = append(token.literals, "")
+	}
+	return token, nil
+}
+
+// values returns the value of each field of t in the log line field text.
+// The leading literal is removed, and each field extends to the next
+// literal, or to the end for the last one.
+func (t formatToken) values(text string) []string {
+	rest := strings.TrimPrefix(text, t.literals[0])
+	values := make([]string, len(t.fields))
+	for i := range t.fields {
+		next := t.literals[i+1]
+		j := -1
+		if next != "" {
+			j = strings.Index(rest, next)
+		}
+		if j < 0 {
+			values[i], rest = strings.TrimSuffix(rest, next), ""
+			continue
+		}
+		values[i], rest = rest[:j], rest[j+len(next):]
+	}
+	return values
+}
+
+// parse extracts the fields of a log line. A line with fewer fields than
+// the format is rejected.
+func (f *lineFormat) parse(line string) LogEntry {
+	var entry LogEntry
+	parts := splitFields(line)
+	if len(parts) < len(f.tokens) {
+		entry.reject = rejectFields
+	}
+	for i, token := range f.tokens {
+		if len(token.fields) == 0 {
+			continue
+		}
+		for j, value := range token.values(safeGet(parts, i)) {
+			setField(&entry, token.fields[j], value, line)
+		}
+	}
+	entry.Class = ipToClass(entry.IP)
+	return entry
+}
+
+// setField sets field of entry to value.
+func setField(entry *LogEntry, field, value, line string) {
+	switch field {
+	case fieldIP:
+		entry.IP = value
+	case fieldTime:
+		entry.TimeStamp = parseLogTime(value, log2Analyze.DateLayout)
+	case fieldTimeISO8601:
+		entry.TimeStamp = parseLogTime(value, time.RFC3339)
+	case fieldTimeMsec:
+		entry.TimeStamp = parseEpoch(value)
+	case fieldRequestLine:
+		entry.Method, entry.Request = splitRequestLine(value)
+	case fieldMethod:
+		entry.Method = value
+	case fieldRequest:
+		entry.Request = value
+	case fieldCode:
+		var ok bool
+		if entry.Code, ok = parseCode(value, line); !ok && entry.reject == "" {
+			entry.reject = rejectCode
+		}
+	case fieldRTime:
+		entry.RTime = value
+	case fieldUserAgent:
+		entry.UserAgent = value
+	case fieldReferer:
+		entry.Referer = value
+	case fieldVHost:
+		entry.VHost = value
+	}
+}
+
+// splitRequestLine splits a request line such as "GET /a%20b HTTP/1.1" into
+// method and request. The request may contain spaces; a request line
+// without a space (e.g. "-") is returned as request.
+func splitRequestLine(line string) (method, request string) {
+	method, request, ok := strings.Cut(line, " ")
+	if !ok {
+		return "", line
+	}
+	if i := strings.LastIndexByte(request, ' '); i >= 0 && strings.HasPrefix(request[i+1:], "HTTP/") {
+		request = request[:i]
+	}
+	return method, request
+}
+
+// parseEpoch parses a Unix time in seconds with an optional fraction, as
+// written by nginx $msec (e.g. "1707566400.123").
+func parseEpoch(value string) time.Time {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		LogIt.Debug("Error parsing timestamp: " + value + " as Unix time")
+		return time.Time{}
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(math.Round(frac*1000))*int64(time.Millisecond))
+}
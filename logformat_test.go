@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// splitFields
+// ──────────────────────────────────────────────
+
+func TestSplitFields(t *testing.T) {
+	tests := map[string][]string{
+		`1.2.3.4 - - [10/Feb/2026:12:00:00 +0100] "GET /a b HTTP/1.1" 200`: {"1.2.3.4", "-", "-", "10/Feb/2026:12:00:00 +0100", "GET /a b HTTP/1.1", "200"},
+		`"say \"hi\"" "back\\slash" ""`:                                    {`say "hi"`, `back\slash`, ""},
+		`ua="Mozilla/5.0 (X11)" rt=0.1`:                                    {"ua=Mozilla/5.0 (X11)", "rt=0.1"},
+		`  a   b  `:                                                        {"a", "b"},
+		`[unterminated bracket`:                                            {"unterminated bracket"},
+		`"unterminated quote`:                                              {"unterminated quote"},
+	}
+	for line, want := range tests {
+		if got := splitFields(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", line, got, want)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// compileLogFormat
+// ──────────────────────────────────────────────
+
+func TestCompileApacheLogFormat(t *testing.T) {
+	f, err := compileLogFormat(`%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i" %D`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for _, token := range f.tokens {
+		fields = append(fields, token.fields...)
+	}
+	want := []string{fieldIP, fieldIgnore, fieldIgnore, fieldTime, fieldRequestLine, fieldCode, fieldIgnore, fieldReferer, fieldUserAgent, fieldRTime}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields: got %q, want %q", fields, want)
+	}
+	if f.rtimeUnit != 1000000 {
+		t.Errorf("rtimeUnit: got %d, want 1000000", f.rtimeUnit)
+	}
+}
+
+func TestCompileLogFormatRTimeUnits(t *testing.T) {
+	tests := map[string]int{
+		`%h %T`:                      1,
+		`%h %{ms}T`:                  1000,
+		`%h %{us}T`:                  1000000,
+		`%h rt=%D`:                   1000000,
+		`%h`:                         0,
+		`$remote_addr $request_time`: 1,
+	}
+	for format, want := range tests {
+		f, err := compileLogFormat(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.rtimeUnit != want {
+			t.Errorf("%s: got %d, want %d", format, f.rtimeUnit, want)
+		}
+	}
+}
+
+func TestCompileLogFormatErrors(t *testing.T) {
+	for _, format := range []string{``, `%h %U%q`, `%h %{Referer`, `%h %`, `$remote_addr ${host`, `$remote_addr $`} {
+		if _, err := compileLogFormat(format); err == nil {
+			t.Errorf("%q: expected an error", format)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// parsing with a compiled format
+// ──────────────────────────────────────────────
+
+func TestLineFormatParseApache(t *testing.T) {
+	setupTestGlobals()
+	f, err := compileLogFormat(`%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i" %D`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := `10.0.0.1 - - [10/Feb/2026:12:00:00 +0100] "GET /search?q=a b HTTP/1.1" 200 512 "https://example.org/say \"hi\"" "Mozilla/5.0 (X11; Linux)" 45000`
+	got := f.parse(line)
+	want := LogEntry{
+		IP:        "10.0.0.1",
+		Class:     "10.0.0.1",
+		TimeStamp: time.Date(2026, 2, 10, 12, 0, 0, 0, time.FixedZone("", 3600)),
+		Method:    "GET",
+		Request:   "/search?q=a b",
+		Code:      200,
+		RTime:     "45000",
+		UserAgent: "Mozilla/5.0 (X11; Linux)",
+		Referer:   `https://example.org/say "hi"`,
+	}
+	if !got.TimeStamp.Equal(want.TimeStamp) {
+		t.Errorf("timestamp: got %v, want %v", got.TimeStamp, want.TimeStamp)
+	}
+	got.TimeStamp = want.TimeStamp
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestLineFormatParseNginx(t *testing.T) {
+	setupTestGlobals()
+	f, err := compileLogFormat(`$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" host=$host rt=$request_time`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := `2001:db8::1 - alice [10/Feb/2026:12:00:00 +0000] "POST /api/v1/login HTTP/2.0" 401 0 "-" "curl/8.0" host=example.org rt=0.045`
+	got := f.parse(line)
+	if got.IP != "2001:db8::1" || got.Method != "POST" || got.Request != "/api/v1/login" || got.Code != 401 ||
+		got.UserAgent != "curl/8.0" || got.Referer != "-" || got.VHost != "example.org" || got.RTime != "0.045" {
+		t.Errorf("got %+v", got)
+	}
+	if !got.TimeStamp.Equal(time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("timestamp: got %v", got.TimeStamp)
+	}
+}
+
+func TestLineFormatParseTimes(t *testing.T) {
+	setupTestGlobals()
+	want := time.Date(2026, 2, 10, 12, 0, 0, 123000000, time.UTC)
+	tests := map[string]string{
+		`$remote_addr $time_iso8601`: `10.0.0.1 2026-02-10T12:00:00.123Z`,
+		`$remote_addr $msec`:         `10.0.0.1 1770724800.123`,
+	}
+	for format, line := range tests {
+		f, err := compileLogFormat(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.parse(line).TimeStamp; !got.Equal(want) {
+			t.Errorf("%s: got %v, want %v", format, got, want)
+		}
+	}
+}
+
+func TestSplitRequestLine(t *testing.T) {
+	tests := map[string][2]string{
+		"GET /a HTTP/1.1":   {"GET", "/a"},
+		"GET /a b HTTP/1.0": {"GET", "/a b"},
+		"GET /no-protocol":  {"GET", "/no-protocol"},
+		"-":                 {"", "-"},
+		"\\x16\\x03\\x01":   {"", "\\x16\\x03\\x01"},
+	}
+	for line, want := range tests {
+		if method, request := splitRequestLine(line); method != want[0] || request != want[1] {
+			t.Errorf("%q: got %q %q, want %q %q", line, method, request, want[0], want[1])
+		}
+	}
+}
+
+func TestParseGenericWithFormat(t *testing.T) {
+	setupTestGlobals()
+	config.LogType = "custom"
+	config.LogFormat = LogFormatConfig{Format: `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i" %{ms}T`}
+	if err := config.compileFormat(); err != nil {
+		t.Fatal(err)
+	}
+	defer setupTestGlobals()
+	if config.LogFormat.RTime.Unit != 1000 {
+		t.Errorf("RTime.Unit: got %d, want 1000", config.LogFormat.RTime.Unit)
+	}
+	entry := createEntry(`10.0.0.1 - - [10/Feb/2026:12:00:00 +0100] "GET /a b HTTP/1.1" 200 512 "-" "Mozilla/5.0 (X11)" 250`)
+	if entry.Request != "/a b" || entry.UserAgent != "Mozilla/5.0 (X11)" || entry.Class != "10.0.0.1" {
+		t.Errorf("got %+v", entry)
+	}
+	if rt, ok := rtimeSeconds(entry.RTime); !ok || rt != 0.25 {
+		t.Errorf("rtime: got %v, %v", rt, ok)
+	}
+}
+
+func TestInitializeLogFormatString(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "logs"), 0750)
+	os.MkdirAll(filepath.Join(dir, "output"), 0750)
+	yamlContent := `OutputFolder: "` + filepath.Join(dir, "output") + `"
+LogType: custom
+LogFormat:
+  Format: '$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"'
+LogConfig:
+  LogFolder: "` + filepath.Join(dir, "logs") + `"
+`
+	cfgFile := filepath.Join(dir, "topFive.yml")
+	if err := os.WriteFile(cfgFile, []byte(yamlContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var cfg ApplicationConfig
+	cfg.Initialize(&cfgFile)
+	if err := cfg.compileFormat(); err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := cfg.LogFormat.compiled.(*lineFormat); !ok || len(f.tokens) != 9 {
+		t.Errorf("Format was not compiled: %+v", cfg.LogFormat)
+	}
+}
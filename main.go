@@ -1,5 +1,5 @@
 // Package main implements topFive, a CLI tool that analyses web server log files
-// (Apache, Rosetta, logfmt) and reports the top N IP addresses by request count
+// (Apache, nginx, HAProxy, Rosetta, JSON, logfmt) and reports the top N IP addresses by request count
 // within a configurable time window.
 package main
 
@@ -7,8 +7,12 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
+	"os/signal"
 	"sort"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -21,19 +25,38 @@ var (
 	timeRange          = flag.Int("m", 5, "use -m to provide a custom time range in minutes to analyze, set to zero (0) to do the whole file ")
 	endtime            = flag.String("t", time.Now().Format("15:04"), "use -t to provide a custom End-Time (e.g. 15:04) to analyze from backwards")
 	topIPsCount        = flag.Int("n", 5, "use -n to provide the number of top IPs to show")
-	IPclass            = flag.String("k", "D", "use -k to summarize the IP class instead of IP addresses: A means X.255.255.255 C means X.Y.Z.255")
+	IPclass            = flag.String("k", "D", "use -k to summarize networks instead of IP addresses: A, B, C (IPv4 /8, /16, /24; IPv6 /32, /48, /64), a prefix length like /24 for IPv4 or /48 for IPv6, or one per family like /24,/48")
+	groupBy            = flag.String("by", "class", "use -by to count the requests by other fields than the IP class, one or more of ip,class,path,path-prefix[:N],ua,ua-class,method,code,referer,vhost,asn,country (e.g. -by path or -by ip,ua)")
 	log2Analyze        *Log2Analyze
-	file2parse         = flag.String("f", "/var/log/httpd/ssl_access_log", "use -f to provide a custom path to the file  to parse")
+	file2parse         = &stringList{values: []string{"/var/log/httpd/ssl_access_log"}}
 	dateLayout         = flag.String("dl", "02/Jan/2006:15:04:05 -0700", "use -dl to provide annother layout for the datestamps within the logfile to analyze")
 	date2analyze       = flag.String("d", time.Now().Format("2006-01-02"), "use -d to provide the date to analyze")
-	ipAddress          = flag.String("i", "", "use -i to provide an IP adress to analyze")
-	notIP              = flag.String("ni", "", "use -ni to provide an IP adress to ignore in analysis")
+	ipAddress          = &stringList{}
+	notIP              = &stringList{}
 	queryString        = flag.String("q", "", "use -q to provide a string to query the logfile for")
-	logType            = flag.String("lt", "apache_combined", "use -lt to provide a log type (apache_combined | apache_common | apache_atmire | nginx_combined | haproxy_http | rosetta | custom)")
+	envelope           = flag.String("envelope", "", "use -envelope to read log lines wrapped in a syslog header or journalctl -o json output (syslog | journald)")
+	program            = flag.String("program", "", "use -program to only analyze the syslog or journald messages of this program (e.g. haproxy)")
+	logType            = flag.String("lt", "apache_combined", "use -lt to provide a log type (apache_combined | apache_common | apache_atmire | nginx_combined | haproxy_http | rosetta | custom | regex | json | logfmt | auto)")
 	responseCode       = flag.Int("r", 0, "use -r to provide a response code to filter for")
 	noResponseCode     = flag.Int("nr", 0, "use -nr to provide a response code to ignore in analysis")
+	enrich             = flag.Bool("enrich", false, "use -enrich to annotate the top IPs with PTR name, autonomous system and country from the databases in the config file")
+	verifyCrawlers     = flag.Bool("verify", false, "use -verify to check by reverse and forward DNS whether top IPs claiming a search-engine crawler in the User-Agent really are one")
+	uaClass            = flag.String("ua-class", "", "use -ua-class to only analyze requests of these User-Agent classes, or to ignore them with a leading ! (e.g. browser,headless or !search-engine,!monitoring)")
 	combinedFile       = flag.Bool("combined", false, "use -combined to write all top-IPs into one file")
 	rt                 = flag.Bool("rt", false, "Show top N slowest requests by response time")
+	rtStat             = flag.String("rt-stat", "max", "use -rt-stat to provide the response-time statistic -rt ranks by (max | mean | total | p50 | p90 | p99)")
+	follow             = flag.Bool("follow", false, "use -follow to tail the log file(s) and redraw the top IPs of the last -m minutes continuously")
+	followInterval     = flag.Duration("interval", 10*time.Second, "use -interval to provide how often the -follow view is redrawn (e.g. 5s)")
+	outputFormat       = flag.String("o", "text", "use -o to provide the output format on stdout (text | json | ndjson)")
+	tui                = flag.Bool("tui", false, "use -tui to browse the result in an interactive terminal dashboard (live together with -follow)")
+	exportFormat       = flag.String("export", "text", "use -export to write the per-IP and -combined files as spreadsheet tables (text | csv | tsv)")
+	blockFormat        = flag.String("block", "", "use -block to write a firewall block list of the top IPs (nftables | ipset | apache | nginx | haproxy)")
+	blockMinCount      = flag.Int("block-min", 0, "use -block-min to provide the minimum number of requests for an IP (class) to be blocked")
+	blockMinRate       = flag.Float64("block-rate", 0, "use -block-rate to provide the minimum number of requests per second for an IP (class) to be blocked")
+	timelineBucket     = flag.Duration("timeline", 0, "use -timeline to write the requests per bucket (e.g. 1s or 1m) of the window and of the top IPs as charts and detect bursts")
+	burstFactor        = flag.Float64("burst", 5, "use -burst to provide how many times its median rate an IP (class) must exceed in a -timeline bucket to be reported as a burst")
+	strict             = flag.Bool("strict", false, "use -strict to fail with exit code 1 when more than MaxRejectRatio (default 1%) of the lines read are malformed")
+	workers            = flag.Int("j", 0, "use -j to provide the number of parallel parsing workers (0 = one per CPU, 1 = sequential)")
 )
 
 // sortByRtime returns a formatted string listing the entries of rtimeMap
@@ -80,11 +103,62 @@ func sortByRcount(ipRcount map[string]int) string {
 	return output
 }
 
+// exitAfterCleanup removes the spill files and the reject bucket of the
+// analysis and closes the databases before exiting with code; os.Exit does
+// not run the deferred calls of main.
+func exitAfterCleanup(code int) {
+	log2Analyze.Close()
+	ipDatabases.Close()
+	os.Exit(code)
+}
+
+func init() {
+	flag.Var(file2parse, "f", "use -f to provide a custom path to the file to parse; may be repeated or be a glob pattern (e.g. /var/log/httpd/*access_log*); use - to read from stdin")
+	flag.Var(ipAddress, "i", "use -i to provide an IP adress or CIDR to analyze, string prefixes like 192.168. are not accepted; may be repeated or be @file with one address or CIDR per line")
+	flag.Var(notIP, "ni", "use -ni to provide an IP adress or CIDR to ignore in analysis, string prefixes like 192.168. are not accepted; may be repeated or be @file with one address or CIDR per line")
+}
+
 func main() {
 	pst := time.Now()
 
 	flag.Parse()
 
+	// with machine-readable output only the report goes to stdout, all
+	// other messages are sent to stderr
+	stdout := os.Stdout
+	if *outputFormat != "text" {
+		if *outputFormat != "json" && *outputFormat != "ndjson" {
+			fmt.Println("unknown output format " + *outputFormat + ", use text, json or ndjson")
+			os.Exit(1)
+		}
+		os.Stdout = os.Stderr
+	}
+
+	if err := applyIPClass(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := applyGroupBy(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *blockFormat != "" && !groupsByAddress() {
+		fmt.Println("-block needs the top IPs, it cannot be combined with -by " + *groupBy)
+		os.Exit(1)
+	}
+	if _, ok := exportSeparators[*exportFormat]; !ok && *exportFormat != "text" {
+		fmt.Println("unknown export format " + *exportFormat + ", use text, csv or tsv")
+		os.Exit(1)
+	}
+	if _, ok := rtimeStatistics[*rtStat]; !ok {
+		fmt.Println("unknown response-time statistic " + *rtStat + ", use max, mean, total, p50, p90 or p99")
+		os.Exit(1)
+	}
+	if _, ok := blockListFormats[*blockFormat]; !ok && *blockFormat != "" {
+		fmt.Println("unknown block list format " + *blockFormat + ", use nftables, ipset, apache, nginx or haproxy")
+		os.Exit(1)
+	}
+
 	config.Initialize(configPath)
 	// now setup logging
 	LogIt = SetupLogging(config.Logcfg)
@@ -92,6 +166,7 @@ func main() {
 	fmt.Println("will log to", config.Logcfg.LogFolder)
 
 	log2Analyze = new(Log2Analyze)
+	defer log2Analyze.Close()
 	if FlagIsPassed("dl") {
 		log2Analyze.DateLayout = *dateLayout
 		LogIt.Info("setting DateLayout to " + *dateLayout + " instead of DateLayout from config file, because -l is passed")
@@ -99,6 +174,17 @@ func main() {
 	} else {
 		log2Analyze.DateLayout = config.DateLayout
 	}
+	if FlagIsPassed("i") {
+		filter, err := newIPFilter(ipAddress.values)
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			os.Exit(1)
+		}
+		log2Analyze.IPFilter = filter
+		LogIt.Info("ip to analyze is set to " + ipAddress.String() + " (" + fmt.Sprint(filter.Len()) + " addresses or networks)")
+		fmt.Println("ip to analyze is set to " + ipAddress.String() + " (" + fmt.Sprint(filter.Len()) + " addresses or networks)")
+	}
 	if FlagIsPassed("i") && !FlagIsPassed("m") {
 		*timeRange = 0
 		LogIt.Info("setting timeRange to 0, because an IP adress and no timeRange is given")
@@ -106,8 +192,50 @@ func main() {
 		fmt.Println("  which means: will analyze the whole file")
 	}
 	if FlagIsPassed("ni") {
-		LogIt.Info("ip to ignore is set to " + fmt.Sprint(*notIP))
-		fmt.Println("ip to ignore is set to " + fmt.Sprint(*notIP))
+		filter, err := newIPFilter(notIP.values)
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			os.Exit(1)
+		}
+		log2Analyze.NotIPFilter = filter
+		LogIt.Info("ip to ignore is set to " + notIP.String() + " (" + fmt.Sprint(filter.Len()) + " addresses or networks)")
+		fmt.Println("ip to ignore is set to " + notIP.String() + " (" + fmt.Sprint(filter.Len()) + " addresses or networks)")
+	}
+	if err := checkUserAgentRules(config.UserAgentRules); err != nil {
+		fmt.Println(err)
+		LogIt.Error(err.Error())
+		os.Exit(1)
+	}
+	loadUserAgentRules(config.UserAgentRules)
+	if *enrich || groupByUses("asn") || groupByUses("country") {
+		databases, err := newEnricher(config.Enrich, net.DefaultResolver, config.DNSTimeout)
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			os.Exit(1)
+		}
+		defer databases.Close()
+		ipDatabases = databases
+		if groupByUses("asn") && config.Enrich.ASNDatabase == "" {
+			fmt.Println("-by asn needs an ASNDatabase in the Enrich section of the config file")
+			os.Exit(1)
+		}
+		if groupByUses("country") && !databases.knowsCountries() {
+			fmt.Println("-by country needs a CountryDatabase, or an ip2asn ASNDatabase with countries, in the Enrich section of the config file")
+			os.Exit(1)
+		}
+	}
+	if FlagIsPassed("ua-class") {
+		filter, err := newUAClassFilter(*uaClass)
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			os.Exit(1)
+		}
+		log2Analyze.UAClasses = filter
+		LogIt.Info("User-Agent classes are set to " + *uaClass)
+		fmt.Println("User-Agent classes are set to " + *uaClass)
 	}
 	if FlagIsPassed("lt") || config.LogType == "" {
 		config.LogType = *logType
@@ -115,6 +243,32 @@ func main() {
 		LogIt.Info("setting LogType to " + *logType)
 		fmt.Println("setting LogType to " + *logType)
 	}
+	if FlagIsPassed("envelope") {
+		config.Envelope.Type = *envelope
+		LogIt.Info("setting envelope to " + *envelope)
+	}
+	if FlagIsPassed("program") {
+		config.Envelope.Program = *program
+		LogIt.Info("only analyzing messages of " + *program)
+	}
+	if err := config.compileFormat(); err != nil {
+		fmt.Println(err)
+		LogIt.Error(err.Error())
+		os.Exit(1)
+	}
+	if FlagIsPassed("j") {
+		config.Workers = *workers
+		LogIt.Info("setting Workers to " + fmt.Sprint(*workers))
+	}
+	if FlagIsPassed("block-min") {
+		config.BlockList.MinCount = *blockMinCount
+	}
+	if FlagIsPassed("block-rate") {
+		config.BlockList.MinRate = *blockMinRate
+	}
+	if FlagIsPassed("burst") {
+		config.BurstFactor = *burstFactor
+	}
 	if FlagIsPassed("d") {
 		log2Analyze.Date2analyze = *date2analyze
 	} else {
@@ -141,50 +295,249 @@ func main() {
 
 	fmt.Println("output is written to", config.OutputFolder)
 	// start working
-	if FlagIsPassed("f") || config.DefaultFile2analyze == "" {
-		log2Analyze.FileName = *file2parse
-		LogIt.Info("setting FileName to " + *file2parse)
-		fmt.Println("setting FileName to " + *file2parse)
+	if FlagIsPassed("f") || len(config.DefaultFile2analyze) == 0 {
+		log2Analyze.FileNames = ExpandFiles(file2parse.values)
+		LogIt.Info("setting FileNames to " + strings.Join(log2Analyze.FileNames, ", "))
+		fmt.Println("setting FileNames to " + strings.Join(log2Analyze.FileNames, ", "))
 	} else {
-		log2Analyze.FileName = config.DefaultFile2analyze
+		log2Analyze.FileNames = ExpandFiles(config.DefaultFile2analyze)
+	}
+	if len(log2Analyze.FileNames) == 0 {
+		fmt.Println("no files to analyze")
+		os.Exit(1)
+	}
+	if config.LogType == "auto" {
+		layouts := append([]string{log2Analyze.DateLayout}, commonDateLayouts...)
+		if FlagIsPassed("dl") {
+			layouts = []string{*dateLayout}
+		}
+		detected, err := log2Analyze.AutoDetect(layouts)
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			os.Exit(1)
+		}
+		LogIt.Info("detected " + detected.String())
+		fmt.Println("detected " + detected.String())
+	}
+
+	if *follow {
+		if FlagIsPassed("interval") {
+			config.FollowInterval = *followInterval
+		}
+		if *tui {
+			f, err := newFollower(log2Analyze, *timeRange)
+			if err != nil {
+				fmt.Println(err)
+				LogIt.Error(err.Error())
+				os.Exit(1)
+			}
+			defer f.Close()
+			keys, err := keyboard(log2Analyze.files())
+			if err != nil {
+				fmt.Println(err)
+				LogIt.Error(err.Error())
+				os.Exit(1)
+			}
+			if err := RunDashboard(f.snapshot, followPollInterval, keys, os.Stdout); err != nil {
+				fmt.Println(err)
+				LogIt.Error(err.Error())
+			}
+			return
+		}
+		stop := make(chan struct{})
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			close(stop)
+		}()
+		if err := log2Analyze.Follow(*timeRange, config.FollowInterval, os.Stdout, stop); err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			os.Exit(1)
+		}
+		return
 	}
 
 	log2Analyze.RetrieveEntries(*endtime, *timeRange)
+	if rejected := log2Analyze.Rejects.Total(); rejected > 0 {
+		name, err := log2Analyze.Rejects.WriteRejectFile()
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+		} else {
+			LogIt.Warn(fmt.Sprintf("%d malformed lines written to %s", rejected, name))
+			fmt.Printf("%d malformed lines written to %s\n", rejected, name)
+		}
+		if ratio := log2Analyze.Rejects.Ratio(log2Analyze.LinesRead); *strict && ratio > config.MaxRejectRatio {
+			fmt.Println(log2Analyze.Rejects.Summary(log2Analyze.LinesRead))
+			message := fmt.Sprintf("%.1f%% of the lines read are malformed, more than the MaxRejectRatio of %.1f%%", ratio*100, config.MaxRejectRatio*100)
+			fmt.Println(message)
+			LogIt.Error(message)
+			exitAfterCleanup(1)
+		}
+	}
 
 	topIPs, codeCount := log2Analyze.GetTopIPs()
 
 	log2Analyze.WriteOutputFiles(topIPs, codeCount)
+	if *blockFormat != "" {
+		name, count, err := log2Analyze.WriteBlockListFile(topIPs, *blockFormat)
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			exitAfterCleanup(1)
+		}
+		LogIt.Info(fmt.Sprintf("block list with %d networks written to %s", count, name))
+		fmt.Printf("block list with %d networks written to %s\n", count, name)
+	}
+	if *tui {
+		keys, err := keyboard(log2Analyze.files())
+		if err == nil {
+			err = RunDashboard(log2Analyze.dashboardSnapshot, 0, keys, os.Stdout)
+		}
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+		} else {
+			return
+		}
+	}
+	var enrichment map[string]ipInfo
+	if *enrich {
+		enrichment = ipDatabases.Annotate(sortedByCount(topIPs))
+	}
+	var crawlerChecks map[string]CrawlerCheck
+	if *verifyCrawlers {
+		crawlerChecks = log2Analyze.VerifyCrawlers(sortedByCount(topIPs), newCrawlerVerifier(net.DefaultResolver, config.DNSTimeout))
+	}
+	if *outputFormat != "text" {
+		report := log2Analyze.BuildReport(topIPs, codeCount, log2Analyze.GetTopLongRequests(), *topIPsCount > 0)
+		report.AddCrawlerChecks(crawlerChecks)
+		report.AddEnrichment(enrichment)
+		if err := report.WriteReport(stdout, *outputFormat); err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			exitAfterCleanup(1)
+		}
+		fmt.Printf("finished in %v\n", time.Since(pst))
+		return
+	}
 	// print output
 	infos := make(map[string]string)
 	var timestamps []string
 	infos["Total requests"] = fmt.Sprintf("%v", log2Analyze.EntryCount)
+	if rejected := log2Analyze.Rejects.Total(); rejected > 0 {
+		infos["Total requests"] += fmt.Sprintf(" (not counted: %d malformed lines, %.1f%%)", rejected, log2Analyze.Rejects.Ratio(log2Analyze.LinesRead)*100)
+	}
 	if *timeRange != 0 {
 		timestamps = append(timestamps, log2Analyze.StartTime.Format("2006-01-02 15:04"))
 		timestamps = append(timestamps, log2Analyze.EndTime.Format("2006-01-02 15:04"))
-		infos["Requests per second"] = fmt.Sprintf("%v", log2Analyze.EntryCount/(*timeRange*60))
+	}
+	if rate, ok := log2Analyze.requestsPerSecond(); ok {
+		infos["Requests per second"] = fmt.Sprintf("%.2f", rate)
 	}
 	if log2Analyze.QueryString != "" {
 		infos["query string"] = log2Analyze.QueryString
 	}
+	log2Analyze.addSourceInfos(infos)
 
-	header := BuildOutputHeader(log2Analyze.FileName, time.Now().Local().Format("20060102_150405"), timestamps, infos)
+	header := BuildOutputHeader(log2Analyze.files(), time.Now().Local().Format("20060102_150405"), timestamps, infos)
 	fmt.Println(header)
 	LogIt.Info(header)
+	if log2Analyze.Rejects.Total() > 0 {
+		rejects := log2Analyze.Rejects.Summary(log2Analyze.LinesRead)
+		fmt.Println("")
+		fmt.Println("\tMalformed lines\t\t: count")
+		fmt.Println("\t------------------------------")
+		fmt.Print(rejects)
+		LogIt.Info(rejects)
+	}
 	sortedIPs := sortByRcount(topIPs)
 	fmt.Println("")
-	fmt.Println("\tTop IPs\t\t: count")
+	fmt.Println("\tTop " + groupLabel() + "\t\t: count")
 	fmt.Println("\t------------------------------")
 	fmt.Println(sortedIPs)
 	LogIt.Info(sortedIPs)
+	if note := log2Analyze.aggregate().ErrorNote(); note != "" {
+		fmt.Println("\t" + note + "\n")
+		LogIt.Warn(note)
+	}
+	uaClasses := formatUAClasses(log2Analyze.aggregate().UAClassCount, log2Analyze.EntryCount)
+	fmt.Println("\tUser-Agent class\t: count")
+	fmt.Println("\t------------------------------")
+	fmt.Println(uaClasses)
+	LogIt.Info(uaClasses)
+	var uaMix string
+	topUAClasses := log2Analyze.UAClassesOf(sortedByCount(topIPs))
+	for _, class := range sortedByCount(topIPs) {
+		uaMix += fmt.Sprintf("\t%s\t: %s\n", class, formatUAClassMix(topUAClasses[class]))
+	}
+	fmt.Println("\tUser-Agent classes of the top " + groupLabel())
+	fmt.Println("\t------------------------------")
+	fmt.Println(uaMix)
+	LogIt.Info(uaMix)
+	if *enrich {
+		output := formatEnrichment(sortedByCount(topIPs), enrichment)
+		fmt.Println("\tTop " + groupLabel() + ": network")
+		fmt.Println("\t------------------------------")
+		fmt.Println(output)
+		LogIt.Info(output)
+	}
+	if *verifyCrawlers {
+		output := formatCrawlerChecks(sortedByCount(topIPs), crawlerChecks)
+		if output == "" {
+			output = "\tno top " + groupLabel() + " claim to be a search-engine crawler\n"
+		}
+		fmt.Println("\tCrawler verification (reverse and forward DNS)")
+		fmt.Println("\t------------------------------")
+		fmt.Println(output)
+		LogIt.Info(output)
+	}
 	if FlagIsPassed("rt") {
 		topLongRequests := log2Analyze.GetTopLongRequests()
 		log2Analyze.WriteResponseTimeFile(topLongRequests)
-		sortedRequests := sortByRtime(topLongRequests)
+		agg := log2Analyze.aggregate()
+		sortedRequests := formatRTimeStats(sortedByRtime(topLongRequests), agg.RTimes)
 		fmt.Println("")
-		fmt.Println("\tTop long Requests: Response Time (s)")
+		fmt.Println("\tTop " + groupLabel() + " by " + *rtStat + " Response Time (s)")
 		fmt.Println("\t------------------------------------")
 		fmt.Println(sortedRequests)
 		LogIt.Info(sortedRequests)
+		sortedPaths := formatRTimeStats(log2Analyze.TopPathRTimes(), agg.PathRTimes)
+		fmt.Println("\tTop paths by " + *rtStat + " Response Time (s)")
+		fmt.Println("\t------------------------------------")
+		fmt.Println(sortedPaths)
+		LogIt.Info(sortedPaths)
+	}
+	if *timelineBucket > 0 {
+		total, perClass, err := log2Analyze.Timelines(sortedByCount(topIPs), *timelineBucket)
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			exitAfterCleanup(1)
+		}
+		name, err := log2Analyze.WriteTimelineFile(total, perClass, topIPs, config.BurstFactor)
+		if err != nil {
+			fmt.Println(err)
+			LogIt.Error(err.Error())
+			exitAfterCleanup(1)
+		}
+		fmt.Println("")
+		fmt.Printf("\tRequests per %v\n", *timelineBucket)
+		fmt.Println("\t------------------------------------")
+		if len(total.Counts) <= 120 {
+			fmt.Println(total.Chart(50, config.BurstFactor))
+		}
+		fmt.Println("\tcharts of all top " + groupLabel() + " written to " + name)
+		for _, class := range sortedByCount(topIPs) {
+			if bursts := perClass[class].Bursts(config.BurstFactor); len(bursts) > 0 {
+				output := fmt.Sprintf("\n\tbursts of %s (above %.0fx its median rate):\n", class, config.BurstFactor) + formatBursts(bursts, perClass[class].timeLayout())
+				fmt.Print(output)
+				LogIt.Info(output)
+			}
+		}
 	}
 	fmt.Printf("finished in %v\n", time.Since(pst))
 }
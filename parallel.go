@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// parallelMinChunk is the smallest byte range handed to a worker. Smaller
+// files are parsed with fewer workers, as splitting them costs more than it
+// saves.
+var parallelMinChunk int64 = 4 << 20
+
+// parallelWorkers returns the number of workers to use for n bytes of log,
+// based on config.Workers (0 means one per CPU).
+func parallelWorkers(n int64) int {
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if limit := n / parallelMinChunk; int64(workers) > limit {
+		workers = int(limit)
+	}
+	return max(workers, 1)
+}
+
+// chunkBoundaries splits the byte range [start, end) of r into n chunks and
+// returns the n+1 boundaries. Every inner boundary is moved forward to the
+// start of the next line, so no line is split between two chunks.
+func chunkBoundaries(r io.ReaderAt, start, end int64, n int) []int64 {
+	bounds := []int64{start}
+	buf := make([]byte, 4096)
+	for i := 1; i < n; i++ {
+		pos := start + (end-start)*int64(i)/int64(n)
+		if prev := bounds[len(bounds)-1]; pos < prev {
+			pos = prev
+		}
+		for pos < end {
+			read, err := r.ReadAt(buf, pos)
+			if j := bytes.IndexByte(buf[:read], '\n'); j >= 0 {
+				pos += int64(j) + 1
+				break
+			}
+			pos += int64(read)
+			if err != nil {
+				pos = end
+			}
+		}
+		bounds = append(bounds, min(pos, end))
+	}
+	return append(bounds, end)
+}
+
+// chunkResult is what a worker produced for one chunk. part is a worker-local
+// Log2Analyze holding the partial aggregate and the retained entries.
+type chunkResult struct {
+	part    *Log2Analyze
+	lines   int
+	last    time.Time
+	stopped bool
+	err     error
+}
+
+// retrieveParallel parses the byte range [start, end) of r with the given
+// number of workers and merges their partial results into l in file order,
+// so that the result is identical to a sequential scan. It returns the
+// latest timestamp of the chunks read.
+func (l *Log2Analyze) retrieveParallel(r io.ReaderAt, source string, start, end int64, timerange int, stopAfterEnd bool, workers int) time.Time {
+	bounds := chunkBoundaries(r, start, end, workers)
+	results := make([]chunkResult, len(bounds)-1)
+	maxEntries := workerEntryLimit(len(results))
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			part := &Log2Analyze{
+				DateLayout:  l.DateLayout,
+				StartTime:   l.StartTime,
+				EndTime:     l.EndTime,
+				QueryString: l.QueryString,
+				IPFilter:    l.IPFilter,
+				NotIPFilter: l.NotIPFilter,
+				UAClasses:   l.UAClasses,
+				Rejects:     newRejects(),
+				maxEntries:  maxEntries,
+				keep:        l.keep,
+				rescan:      l.rescan,
+			}
+			section := io.NewSectionReader(r, bounds[i], bounds[i+1]-bounds[i])
+			res := &results[i]
+			res.part = part
+			res.lines, res.last, res.stopped, res.err = part.scan(section, source, timerange, stopAfterEnd, part.collect)
+		}(i)
+	}
+	wg.Wait()
+
+	var last time.Time
+	merged := true
+	for _, res := range results {
+		if merged {
+			l.merge(res.part)
+			l.LinesRead += res.lines
+			if res.last.After(last) {
+				last = res.last
+			}
+			if res.err != nil {
+				fmt.Println("Error reading from file:", res.err)
+			}
+			// a sequential scan would not have read past this point
+			merged = !res.stopped
+		}
+		res.part.Close()
+	}
+	return last
+}
+
+// workerEntryLimit returns the entries each of n workers keeps in memory, so
+// that together they keep no more than config.MaxEntriesInMemory. 0 means
+// unbounded.
+func workerEntryLimit(n int) int {
+	if config.MaxEntriesInMemory <= 0 {
+		return 0
+	}
+	return max(config.MaxEntriesInMemory/n, 1)
+}
+
+// merge adds the counters, retained entries and rejected lines of part to l.
+func (l *Log2Analyze) merge(part *Log2Analyze) {
+	if part.Rejects.Total() > 0 {
+		if l.Rejects == nil {
+			l.Rejects = newRejects()
+		}
+		l.Rejects.Merge(part.Rejects)
+	}
+	if part.Agg != nil {
+		if l.Agg == nil {
+			l.Agg = NewAggregate(config.MaxTrackedClasses)
+		}
+		l.Agg.Merge(part.Agg)
+	}
+	if part.overflow {
+		l.dropEntries()
+	}
+	part.EachEntry(l.retain)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// chunkBoundaries
+// ──────────────────────────────────────────────
+
+func TestChunkBoundariesAlignOnLines(t *testing.T) {
+	content := "aaaa\nbbbbbbbb\ncc\ndddddddddddd\ne\n"
+	r := strings.NewReader(content)
+
+	bounds := chunkBoundaries(r, 0, int64(len(content)), 4)
+
+	if len(bounds) != 5 {
+		t.Fatalf("expected 5 boundaries, got %v", bounds)
+	}
+	if bounds[0] != 0 || bounds[4] != int64(len(content)) {
+		t.Errorf("outer boundaries: got %v", bounds)
+	}
+	for _, b := range bounds[1:4] {
+		if b != int64(len(content)) && content[b-1] != '\n' {
+			t.Errorf("boundary %d is not at the start of a line (%v)", b, bounds)
+		}
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] < bounds[i-1] {
+			t.Errorf("boundaries not ascending: %v", bounds)
+		}
+	}
+}
+
+func TestParallelWorkersRespectsMinChunk(t *testing.T) {
+	setupTestGlobals()
+	config.Workers = 8
+
+	if got := parallelWorkers(parallelMinChunk / 2); got != 1 {
+		t.Errorf("small input: got %d workers, want 1", got)
+	}
+	if got := parallelWorkers(parallelMinChunk * 3); got != 3 {
+		t.Errorf("3 chunks of input: got %d workers, want 3", got)
+	}
+	if got := parallelWorkers(parallelMinChunk * 100); got != 8 {
+		t.Errorf("large input: got %d workers, want 8", got)
+	}
+}
+
+func TestWorkerEntryLimit(t *testing.T) {
+	setupTestGlobals()
+	config.MaxEntriesInMemory = 1000
+	if got := workerEntryLimit(4); got != 250 {
+		t.Errorf("4 workers: got %d, want 250", got)
+	}
+	if got := workerEntryLimit(3000); got != 1 {
+		t.Errorf("more workers than entries: got %d, want 1", got)
+	}
+	config.MaxEntriesInMemory = 0
+	if got := workerEntryLimit(4); got != 0 {
+		t.Errorf("unbounded: got %d, want 0", got)
+	}
+}
+
+// ──────────────────────────────────────────────
+// RetrieveEntries — sequential vs. parallel
+// ──────────────────────────────────────────────
+
+// retrieveWithWorkers runs RetrieveEntries on file with the given number of workers.
+func retrieveWithWorkers(file string, workers int, endtime string, timerange int) *Log2Analyze {
+	config.Workers = workers
+	l := &Log2Analyze{
+		FileName:     file,
+		DateLayout:   "02/Jan/2006:15:04:05 -0700",
+		Date2analyze: "2026-02-10",
+	}
+	log2Analyze = l
+	l.RetrieveEntries(endtime, timerange)
+	return l
+}
+
+func TestRetrieveEntriesParallelMatchesSequential(t *testing.T) {
+	setupTestGlobals()
+	defer func(old int64) { parallelMinChunk = old }(parallelMinChunk)
+	parallelMinChunk = 16 * 1024
+
+	start := time.Date(2026, 2, 10, 0, 0, 0, 0, time.Now().Location())
+	content := buildOrderedLog(start, 20000)
+	// the requests in the first third of the file are answered with 404
+	content = strings.ReplaceAll(content, "\" 200 100", "\" 404 100")[:len(content)/3] + content[len(content)/3:]
+	tmpFile := writeTempLogFile(t, content)
+	defer os.Remove(tmpFile)
+
+	for _, tr := range []int{0, 60} {
+		seq := retrieveWithWorkers(tmpFile, 1, "05:00", tr)
+		par := retrieveWithWorkers(tmpFile, 6, "05:00", tr)
+		defer seq.Close()
+		defer par.Close()
+
+		if seq.EntryCount == 0 {
+			t.Fatalf("timerange %d: no entries found", tr)
+		}
+		if par.EntryCount != seq.EntryCount {
+			t.Errorf("timerange %d: EntryCount parallel %d, sequential %d", tr, par.EntryCount, seq.EntryCount)
+		}
+		if par.LinesRead != seq.LinesRead {
+			t.Errorf("timerange %d: LinesRead parallel %d, sequential %d", tr, par.LinesRead, seq.LinesRead)
+		}
+		if !par.EndTime.Equal(seq.EndTime) {
+			t.Errorf("timerange %d: EndTime parallel %v, sequential %v", tr, par.EndTime, seq.EndTime)
+		}
+		seqTop, seqCodes := seq.GetTopIPs()
+		parTop, parCodes := par.GetTopIPs()
+		if !reflect.DeepEqual(parTop, seqTop) {
+			t.Errorf("timerange %d: top IPs parallel %v, sequential %v", tr, parTop, seqTop)
+		}
+		if !reflect.DeepEqual(parCodes, seqCodes) {
+			t.Errorf("timerange %d: codes parallel %v, sequential %v", tr, parCodes, seqCodes)
+		}
+		if !reflect.DeepEqual(par.Entries, seq.Entries) {
+			t.Errorf("timerange %d: retained entries differ between parallel and sequential", tr)
+		}
+	}
+}
+
+func TestRetrieveEntriesParallelMalformedTail(t *testing.T) {
+	setupTestGlobals()
+	defer func(old int64) { parallelMinChunk = old }(parallelMinChunk)
+	parallelMinChunk = 16 * 1024
+	config.OutputFolder = t.TempDir() + "/"
+
+	// the last chunk holds malformed lines only
+	start := time.Date(2026, 2, 10, 0, 0, 0, 0, time.Now().Location())
+	content := buildOrderedLog(start, 2000) + strings.Repeat("malformed line without any fields\n", 10000)
+	tmpFile := writeTempLogFile(t, content)
+	defer os.Remove(tmpFile)
+
+	seq := retrieveWithWorkers(tmpFile, 1, "05:00", 0)
+	defer seq.Close()
+	par := retrieveWithWorkers(tmpFile, 4, "05:00", 0)
+	defer par.Close()
+
+	want := start.Add(1999 * time.Second)
+	if !seq.EndTime.Equal(want) || !par.EndTime.Equal(want) {
+		t.Errorf("EndTime: parallel %v, sequential %v, want %v", par.EndTime, seq.EndTime, want)
+	}
+	if par.Rejects.Total() != 10000 {
+		t.Errorf("rejects: got %d, want 10000", par.Rejects.Total())
+	}
+}
+
+func TestRetrieveEntriesParallelBeyondLimit(t *testing.T) {
+	setupTestGlobals()
+	defer func(old int64) { parallelMinChunk = old }(parallelMinChunk)
+	parallelMinChunk = 16 * 1024
+	config.MaxEntriesInMemory = 600
+
+	start := time.Date(2026, 2, 10, 0, 0, 0, 0, time.Now().Location())
+	tmpFile := writeTempLogFile(t, buildOrderedLog(start, 5000))
+	defer os.Remove(tmpFile)
+
+	// the entries of the top 5 classes fit in memory; with -n 0 all classes
+	// are top classes and their entries are spilled by the second pass
+	for _, n := range []int{5, 0} {
+		topIPsCount = &n
+		seq := retrieveWithWorkers(tmpFile, 1, "05:00", 0)
+		defer seq.Close()
+		par := retrieveWithWorkers(tmpFile, 4, "05:00", 0)
+		defer par.Close()
+
+		if par.keep == nil || seq.keep == nil {
+			t.Fatalf("-n %d: the entries of the top classes should have been read again", n)
+		}
+		if spilled := n == 0; (par.spill != nil) != spilled || (seq.spill != nil) != spilled {
+			t.Errorf("-n %d: spill file: parallel %v, sequential %v, want %v", n, par.spill != nil, seq.spill != nil, spilled)
+		}
+		topIPs, _ := seq.GetTopIPs()
+		want := 0
+		for _, count := range topIPs {
+			want += count
+		}
+		var seqEntries, parEntries []LogEntry
+		seq.EachEntry(func(e LogEntry) { seqEntries = append(seqEntries, e) })
+		par.EachEntry(func(e LogEntry) { parEntries = append(parEntries, e) })
+		if len(seqEntries) != want || !reflect.DeepEqual(parEntries, seqEntries) {
+			t.Errorf("-n %d: retained entries: parallel %d, sequential %d, want %d", n, len(parEntries), len(seqEntries), want)
+		}
+		for _, e := range seqEntries {
+			if _, ok := topIPs[e.Class]; !ok {
+				t.Errorf("-n %d: entry of %s is not in the top classes", n, e.Class)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// lineParser extracts the fields of a log line. It is implemented by the
+// compiled log formats (see ApplicationConfig.compileFormat).
+type lineParser interface {
+	parse(line string) LogEntry
+}
+
+// regexGroups maps the named groups of a LogFormat.Pattern to their field.
+// bytes is accepted but not used. request is parsed as a request line
+// ("GET /path HTTP/1.1") unless the pattern has a method group.
+var regexGroups = map[string]string{
+	"ip":      fieldIP,
+	"ts":      fieldTime,
+	"method":  fieldMethod,
+	"request": fieldRequestLine,
+	"code":    fieldCode,
+	"rtime":   fieldRTime,
+	"ua":      fieldUserAgent,
+	"referer": fieldReferer,
+	"bytes":   fieldIgnore,
+	"host":    fieldVHost,
+}
+
+// regexMandatoryGroups are the groups every Pattern must have.
+var regexMandatoryGroups = []string{"ip", "ts"}
+
+// regexFormat is a log format given by a regular expression with named
+// groups (LogType regex).
+type regexFormat struct {
+	re     *regexp.Regexp
+	fields []string
+}
+
+// compileRegexFormat compiles pattern, whose named groups (see regexGroups)
+// capture the fields. Unknown and missing mandatory groups are errors.
+func compileRegexFormat(pattern string) (*regexFormat, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("log type regex needs a LogFormat.Pattern")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Pattern: %w", err)
+	}
+	f := &regexFormat{re: re, fields: make([]string, re.NumSubexp()+1)}
+	groups := make(map[string]bool)
+	var unknown []string
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		field, ok := regexGroups[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		groups[name] = true
+		f.fields[i] = field
+	}
+	if len(unknown) > 0 {
+		known := make([]string, 0, len(regexGroups))
+		for name := range regexGroups {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown groups %s in Pattern, use %s", strings.Join(unknown, ", "), strings.Join(known, ", "))
+	}
+	var missing []string
+	for _, name := range regexMandatoryGroups {
+		if !groups[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the Pattern has no group %s", strings.Join(missing, ", "))
+	}
+	if groups["method"] {
+		for i, field := range f.fields {
+			if field == fieldRequestLine {
+				f.fields[i] = fieldRequest
+			}
+		}
+	}
+	return f, nil
+}
+
+// parse extracts the fields of a log line. A line that does not match gives
+// an entry without fields.
+func (f *regexFormat) parse(line string) LogEntry {
+	var entry LogEntry
+	match := f.re.FindStringSubmatch(line)
+	if match == nil {
+		LogIt.Debug("line does not match Pattern: " + line)
+		entry.reject = rejectFields
+	}
+	for i, value := range match {
+		setField(&entry, f.fields[i], value, line)
+	}
+	entry.Class = ipToClass(entry.IP)
+	return entry
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// cdnPattern matches a CDN export line such as
+// 2026-02-10T12:00:00Z 10.0.0.1 cdn.example.org GET /a?b=1 200 512 0.120 "curl/8.0"
+const cdnPattern = `^(?P<ts>\S+) (?P<ip>\S+) (?P<host>\S+) (?P<method>\S+) (?P<request>\S+) (?P<code>\d+) (?P<bytes>\d+) (?P<rtime>[\d.]+) "(?P<ua>[^"]*)"`
+
+func setupRegexConfig(t *testing.T, pattern string) {
+	t.Helper()
+	setupTestGlobals()
+	config.LogType = "regex"
+	config.LogFormat = LogFormatConfig{Pattern: pattern, RTime: RTimeConfig{Unit: 1}}
+	if err := config.compileFormat(); err != nil {
+		t.Fatal(err)
+	}
+	log2Analyze.DateLayout = time.RFC3339
+	t.Cleanup(setupTestGlobals)
+}
+
+func TestRegexFormatParse(t *testing.T) {
+	setupRegexConfig(t, cdnPattern)
+	entry := createEntry(`2026-02-10T12:00:00Z 10.0.0.1 cdn.example.org GET /a?b=1 200 512 0.120 "curl/8.0"`)
+	want := LogEntry{
+		IP:        "10.0.0.1",
+		Class:     "10.0.0.1",
+		TimeStamp: time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC),
+		Method:    "GET",
+		Request:   "/a?b=1",
+		Code:      200,
+		RTime:     "0.120",
+		UserAgent: "curl/8.0",
+		UAClass:   uaHTTPLibrary,
+		VHost:     "cdn.example.org",
+	}
+	if entry != want {
+		t.Errorf("got %+v, want %+v", entry, want)
+	}
+	if rt, ok := rtimeSeconds(entry.RTime); !ok || rt != 0.12 {
+		t.Errorf("rtime: got %v, %v", rt, ok)
+	}
+}
+
+func TestRegexFormatRequestLine(t *testing.T) {
+	setupRegexConfig(t, `^(?P<ip>\S+) \[(?P<ts>[^\]]+)\] "(?P<request>[^"]*)" (?P<code>\d+)`)
+	entry := createEntry(`10.0.0.1 [2026-02-10T12:00:00Z] "POST /a b HTTP/1.1" 201`)
+	if entry.Method != "POST" || entry.Request != "/a b" || entry.Code != 201 {
+		t.Errorf("got %+v", entry)
+	}
+}
+
+func TestRegexFormatNoMatch(t *testing.T) {
+	setupRegexConfig(t, cdnPattern)
+	entry := createEntry(`garbage`)
+	if entry.IP != "" || !entry.TimeStamp.IsZero() || entry.Class != invalidClass {
+		t.Errorf("got %+v", entry)
+	}
+}
+
+func TestCompileRegexFormatErrors(t *testing.T) {
+	tests := map[string]string{
+		``:                                    "needs a LogFormat.Pattern",
+		`(?P<ip>\S+) (?P<ts>`:                 "invalid Pattern",
+		`(?P<ip>\S+) (?P<ts>\S+) (?P<uri>.*)`: "unknown groups uri",
+		`(?P<ip>\S+) (?P<code>\d+)`:           "no group ts",
+		`(?P<request>.*)`:                     "no group ip, ts",
+	}
+	for pattern, want := range tests {
+		_, err := compileRegexFormat(pattern)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want an error containing %q", pattern, err, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// reasons why a malformed line is rejected
+const (
+	rejectFields    = "too few fields" // or the line does not match the format
+	rejectTimestamp = "timestamp"
+	rejectCode      = "code"
+)
+
+// rejectReasons lists the reasons in the order they are reported.
+var rejectReasons = []string{rejectFields, rejectTimestamp, rejectCode}
+
+// rejectSampleCount is the number of lines kept per reason for the summary.
+const rejectSampleCount = 3
+
+// Rejects counts the malformed lines of a run by reason. The first lines of
+// each reason are kept as samples; all of them are written to a temporary
+// bucket file, which WriteRejectFile copies to the output folder and Close
+// removes.
+type Rejects struct {
+	Count   map[string]int
+	Samples map[string][]string
+	bucket  *os.File
+	w       *bufio.Writer
+}
+
+// newRejects returns empty reject counters.
+func newRejects() *Rejects {
+	return &Rejects{Count: make(map[string]int), Samples: make(map[string][]string)}
+}
+
+// Add counts line as rejected for reason and writes it to the bucket file,
+// prefixed with the reason.
+func (r *Rejects) Add(reason, line string) {
+	r.Count[reason]++
+	if len(r.Samples[reason]) < rejectSampleCount {
+		r.Samples[reason] = append(r.Samples[reason], line)
+	}
+	if err := r.openBucket(); err != nil {
+		LogIt.Error("Error creating the reject bucket: " + err.Error())
+		return
+	}
+	r.w.WriteString(reason + "\t" + line + "\n")
+}
+
+// openBucket creates the temporary bucket file unless it exists.
+func (r *Rejects) openBucket() error {
+	if r.bucket != nil {
+		return nil
+	}
+	file, err := os.CreateTemp("", "topFive-rejects-*")
+	if err != nil {
+		return err
+	}
+	r.bucket, r.w = file, bufio.NewWriter(file)
+	return nil
+}
+
+// Total returns the number of rejected lines.
+func (r *Rejects) Total() int {
+	if r == nil {
+		return 0
+	}
+	total := 0
+	for _, count := range r.Count {
+		total += count
+	}
+	return total
+}
+
+// Merge adds the counts, samples and bucket of other to r.
+func (r *Rejects) Merge(other *Rejects) {
+	if other == nil {
+		return
+	}
+	for reason, count := range other.Count {
+		r.Count[reason] += count
+	}
+	for reason, samples := range other.Samples {
+		free := rejectSampleCount - len(r.Samples[reason])
+		r.Samples[reason] = append(r.Samples[reason], samples[:min(free, len(samples))]...)
+	}
+	if other.bucket == nil {
+		return
+	}
+	err := r.openBucket()
+	if err == nil {
+		err = other.rewind()
+	}
+	if err == nil {
+		_, err = io.Copy(r.w, other.bucket)
+	}
+	if err != nil {
+		LogIt.Error("Error merging the reject buckets: " + err.Error())
+	}
+}
+
+// rewind flushes the bucket file and positions it at its start.
+func (r *Rejects) rewind() error {
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	_, err := r.bucket.Seek(0, io.SeekStart)
+	return err
+}
+
+// Ratio returns the share of the rejected lines of lines read.
+func (r *Rejects) Ratio(linesRead int) float64 {
+	if linesRead == 0 {
+		return 0
+	}
+	return float64(r.Total()) / float64(linesRead)
+}
+
+// Summary formats the counts per reason with their sample lines.
+func (r *Rejects) Summary(linesRead int) string {
+	var b strings.Builder
+	for _, reason := range rejectReasons {
+		if r.Count[reason] == 0 {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("\t%s\t: %d (%.1f%%)\n", reason, r.Count[reason], float64(r.Count[reason])*100/float64(max(linesRead, 1))))
+		for _, line := range r.Samples[reason] {
+			b.WriteString("\t\t" + line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// WriteRejectFile writes the rejected lines (reason, tab, line) to the
+// output folder and returns the file name.
+func (r *Rejects) WriteRejectFile() (string, error) {
+	name := config.OutputFolder + "rejects-" + time.Now().Local().Format("20060102_150405") + ".txt"
+	if r.bucket == nil {
+		return name, fmt.Errorf("no reject bucket to write")
+	}
+	if err := r.rewind(); err != nil {
+		return name, err
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return name, err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, r.bucket); err != nil {
+		return name, err
+	}
+	// further lines are appended at the end of the bucket
+	_, err = r.bucket.Seek(0, io.SeekEnd)
+	return name, err
+}
+
+// Close closes and removes the bucket file.
+func (r *Rejects) Close() error {
+	if r == nil || r.bucket == nil {
+		return nil
+	}
+	err := r.bucket.Close()
+	if rmErr := os.Remove(r.bucket.Name()); err == nil {
+		err = rmErr
+	}
+	r.bucket = nil
+	return err
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	rejectGoodLine      = `10.0.0.1 - - [10/Feb/2026:12:00:00 +0000] "GET /a HTTP/1.1" 200 100 "-" "-"`
+	rejectBadCodeLine   = `10.0.0.2 - - [10/Feb/2026:12:01:00 +0000] "GET /a HTTP/1.1" abc 100 "-" "-"`
+	rejectBadTimeLine   = `10.0.0.3 - - [yesterday noon] "GET / HTTP/1.1" 200 100 "-" "-"`
+	rejectTooShortLine  = `garbage`
+	rejectBadBothLine   = `10.0.0.4 - - [yesterday noon] "GET / HTTP/1.1" abc 100 "-" "-"`
+	rejectTestLogLines  = rejectGoodLine + "\n" + rejectBadCodeLine + "\n" + rejectTooShortLine + "\n" + rejectBadTimeLine + "\n"
+	rejectTestLineCount = 4
+)
+
+// ──────────────────────────────────────────────
+// reject reasons of the parsers
+// ──────────────────────────────────────────────
+
+func TestParsePositionsRejects(t *testing.T) {
+	setupTestGlobals()
+	tests := map[string]string{
+		rejectGoodLine:     "",
+		rejectBadCodeLine:  rejectCode,
+		rejectBadTimeLine:  rejectTimestamp,
+		rejectTooShortLine: rejectFields,
+		rejectBadBothLine:  rejectTimestamp,
+		"":                 rejectFields,
+	}
+	for line, want := range tests {
+		if got := createEntry(line).reject; got != want {
+			t.Errorf("%q: got %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestParsePositionsWithoutCode(t *testing.T) {
+	setupTestGlobals()
+	config.LogFormat.Code = -1
+	if entry := createEntry(rejectBadCodeLine); entry.reject != "" || entry.Code != 0 {
+		t.Errorf("got %+v", entry)
+	}
+}
+
+func TestCompiledFormatRejects(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	config.LogType = "custom"
+	config.LogFormat = LogFormatConfig{Format: `%h %l %u %t "%r" %>s %b`}
+	if err := config.compileFormat(); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		rejectGoodLine:                       "",
+		rejectBadCodeLine:                    rejectCode,
+		`10.0.0.1 - - [10/Feb/2026:12:00:00`: rejectFields,
+	}
+	for line, want := range tests {
+		if got := createEntry(line).reject; got != want {
+			t.Errorf("%q: got %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestRegexFormatRejects(t *testing.T) {
+	setupRegexConfig(t, cdnPattern)
+	if got := createEntry("garbage").reject; got != rejectFields {
+		t.Errorf("got %q, want %q", got, rejectFields)
+	}
+}
+
+func TestStructuredFormatRejects(t *testing.T) {
+	setupStructuredConfig(t, "json", FieldKeys{IP: "ip", TimeStamp: "ts", Code: "status"}, 1)
+	tests := map[string]string{
+		`{"ip":"10.0.0.1","ts":"2026-02-10T12:00:00Z","status":200}`:   "",
+		`{"ip":"10.0.0.1","ts":"2026-02-10T12:00:00Z","status":"n/a"}`: rejectCode,
+		`{"ip":"10.0.0.1","ts":"yesterday","status":200}`:              rejectTimestamp,
+		`{"ip":"10.0.0.1",`: rejectFields,
+	}
+	for line, want := range tests {
+		if got := createEntry(line).reject; got != want {
+			t.Errorf("%s: got %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestEnvelopeFilteredNotRejected(t *testing.T) {
+	setupEnvelopeConfig(t, EnvelopeConfig{Type: "syslog", Program: "haproxy"})
+	if entry := createEntry("Feb  6 12:14:15 lb1 sshd[99]: Accepted publickey for root"); !entry.filtered || entry.reject != "" {
+		t.Errorf("got %+v", entry)
+	}
+}
+
+// ──────────────────────────────────────────────
+// Rejects
+// ──────────────────────────────────────────────
+
+func TestRejectsAdd(t *testing.T) {
+	setupTestGlobals()
+	r := newRejects()
+	defer r.Close()
+	for i := 0; i < rejectSampleCount+2; i++ {
+		r.Add(rejectCode, strings.Repeat("x", i+1))
+	}
+	r.Add(rejectFields, "garbage")
+
+	if r.Total() != rejectSampleCount+3 || r.Count[rejectCode] != rejectSampleCount+2 {
+		t.Errorf("counts: got %v", r.Count)
+	}
+	if len(r.Samples[rejectCode]) != rejectSampleCount || r.Samples[rejectCode][0] != "x" {
+		t.Errorf("samples: got %q", r.Samples[rejectCode])
+	}
+	if got := r.Ratio(100); got != float64(rejectSampleCount+3)/100 {
+		t.Errorf("ratio: got %v", got)
+	}
+	summary := r.Summary(100)
+	if !strings.Contains(summary, "\ttoo few fields\t: 1 (1.0%)\n\t\tgarbage\n") {
+		t.Errorf("summary: got %q", summary)
+	}
+	if strings.Index(summary, rejectFields) > strings.Index(summary, rejectCode) {
+		t.Errorf("summary not in the order of rejectReasons: %q", summary)
+	}
+}
+
+func TestRejectsNil(t *testing.T) {
+	var r *Rejects
+	if r.Total() != 0 || r.Close() != nil {
+		t.Error("nil Rejects should be empty")
+	}
+	if newReportRejects(r, 10) != nil {
+		t.Error("no report for nil Rejects")
+	}
+}
+
+func TestRejectsMergeAndWriteFile(t *testing.T) {
+	setupTestGlobals()
+	config.OutputFolder = t.TempDir() + "/"
+	a, b := newRejects(), newRejects()
+	defer a.Close()
+	defer b.Close()
+	a.Add(rejectCode, "a1")
+	a.Add(rejectCode, "a2")
+	b.Add(rejectCode, "b1")
+	b.Add(rejectCode, "b2")
+	b.Add(rejectTimestamp, "b3")
+	a.Merge(b)
+
+	if a.Total() != 5 || a.Count[rejectCode] != 4 {
+		t.Errorf("counts: got %v", a.Count)
+	}
+	if !reflect.DeepEqual(a.Samples[rejectCode], []string{"a1", "a2", "b1"}) {
+		t.Errorf("samples: got %q", a.Samples[rejectCode])
+	}
+	name, err := a.WriteRejectFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "code\ta1\ncode\ta2\ncode\tb1\ncode\tb2\ntimestamp\tb3\n"
+	if string(data) != want {
+		t.Errorf("reject file: got %q, want %q", data, want)
+	}
+	// the bucket can still be appended to and written again
+	a.Add(rejectFields, "a3")
+	if name, err = a.WriteRejectFile(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ = os.ReadFile(name); string(data) != want+"too few fields\ta3\n" {
+		t.Errorf("reject file after Add: got %q", data)
+	}
+}
+
+func TestRejectsCloseRemovesBucket(t *testing.T) {
+	setupTestGlobals()
+	r := newRejects()
+	r.Add(rejectCode, "line")
+	name := r.bucket.Name()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("bucket %s was not removed", name)
+	}
+}
+
+// ──────────────────────────────────────────────
+// RetrieveEntries with malformed lines
+// ──────────────────────────────────────────────
+
+func TestRetrieveEntriesRejects(t *testing.T) {
+	setupTestGlobals()
+	tmpFile := writeTempLogFile(t, rejectTestLogLines)
+	defer os.Remove(tmpFile)
+
+	l := retrieveWithWorkers(tmpFile, 1, "12:05", 0)
+	defer l.Close()
+
+	if l.EntryCount != 1 || l.LinesRead != rejectTestLineCount {
+		t.Errorf("EntryCount %d, LinesRead %d: want 1 and %d", l.EntryCount, l.LinesRead, rejectTestLineCount)
+	}
+	want := map[string]int{rejectCode: 1, rejectFields: 1, rejectTimestamp: 1}
+	if !reflect.DeepEqual(l.Rejects.Count, want) {
+		t.Errorf("rejects: got %v, want %v", l.Rejects.Count, want)
+	}
+	if _, codes := l.GetTopIPs(); codes[0] != 0 {
+		t.Errorf("a line with an invalid code was counted: %v", codes)
+	}
+	report := l.BuildReport(map[string]int{}, map[int]int{}, map[string]float64{}, false)
+	if report.Rejects == nil || report.Rejects.Total != 3 || report.Rejects.Ratio != 0.75 || len(report.Rejects.Reasons) != 3 {
+		t.Errorf("report: got %+v", report.Rejects)
+	}
+}
+
+func TestRetrieveEntriesRejectsParallel(t *testing.T) {
+	setupTestGlobals()
+	defer func(old int64) { parallelMinChunk = old }(parallelMinChunk)
+	parallelMinChunk = 16 * 1024
+
+	start := time.Date(2026, 2, 10, 0, 0, 0, 0, time.Now().Location())
+	content := buildOrderedLog(start, 5000)
+	lines := strings.SplitAfter(content, "\n")
+	for i := 100; i < len(lines); i += 1000 {
+		lines[i] = "malformed line " + lines[i][:10] + "\n"
+	}
+	tmpFile := writeTempLogFile(t, strings.Join(lines, ""))
+	defer os.Remove(tmpFile)
+	config.OutputFolder = t.TempDir() + "/"
+
+	seq := retrieveWithWorkers(tmpFile, 1, "05:00", 0)
+	defer seq.Close()
+	par := retrieveWithWorkers(tmpFile, 4, "05:00", 0)
+	defer par.Close()
+
+	if seq.Rejects.Total() != 5 || par.Rejects.Total() != 5 {
+		t.Errorf("rejects: sequential %d, parallel %d, want 5", seq.Rejects.Total(), par.Rejects.Total())
+	}
+	if !reflect.DeepEqual(par.Rejects.Samples, seq.Rejects.Samples) {
+		t.Errorf("samples: parallel %q, sequential %q", par.Rejects.Samples, seq.Rejects.Samples)
+	}
+	seqName, _ := seq.Rejects.WriteRejectFile()
+	seqData, _ := os.ReadFile(seqName)
+	os.Remove(seqName)
+	parName, _ := par.Rejects.WriteRejectFile()
+	parData, _ := os.ReadFile(parName)
+	if len(seqData) == 0 || string(parData) != string(seqData) {
+		t.Errorf("reject files differ: parallel %q, sequential %q", parData, seqData)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// ReportSchemaVersion is the version of the JSON report schema (-o json and
+// -o ndjson). It is raised whenever a field is removed or changes its
+// meaning; new fields may be added without raising it.
+const ReportSchemaVersion = 3
+
+// Report is the machine-readable result of an analysis.
+type Report struct {
+	SchemaVersion   int             `json:"schema_version"`
+	Generated       time.Time       `json:"generated"`
+	Files           []string        `json:"files"`
+	Window          ReportWindow    `json:"window"`
+	Filters         ReportFilters   `json:"filters"`
+	LinesRead       int             `json:"lines_read"`
+	TotalEntries    int             `json:"total_entries"`
+	CountErrorBound int             `json:"count_error_bound,omitempty"`
+	TopClasses      []ReportClass   `json:"top_classes"`
+	ResponseCodes   []ReportCode    `json:"response_codes"`
+	UAClasses       []ReportUAClass `json:"user_agent_classes"`
+	LongestRequests []ReportLongest `json:"longest_requests"`
+	ResponseTimes   ReportRTimes    `json:"response_times"`
+	Rejects         *ReportRejects  `json:"rejects,omitempty"`
+}
+
+// ReportWindow is the analyzed time window. Start is null when the whole
+// file was analyzed.
+type ReportWindow struct {
+	Start   *time.Time `json:"start"`
+	End     time.Time  `json:"end"`
+	Minutes int        `json:"minutes"`
+}
+
+// ReportFilters lists the filters applied to the entries. IP and NotIP hold
+// the values of -i and -ni as given (addresses, CIDRs or @file references).
+type ReportFilters struct {
+	IP             []string `json:"ip,omitempty"`
+	NotIP          []string `json:"not_ip,omitempty"`
+	ResponseCode   int      `json:"response_code,omitempty"`
+	NoResponseCode int      `json:"no_response_code,omitempty"`
+	Query          string   `json:"query,omitempty"`
+	UAClass        string   `json:"ua_class,omitempty"`
+	IPClass        string   `json:"ip_class"`
+	LogType        string   `json:"log_type"`
+}
+
+// ReportClass is one of the top classes with the number of its requests per
+// User-Agent class and its requests.
+type ReportClass struct {
+	Class     string          `json:"class"`
+	Count     int             `json:"count"`
+	UAClasses []ReportUAClass `json:"ua_classes,omitempty"`
+	Crawler   *ReportCrawler  `json:"crawler,omitempty"`
+	Network   *ReportNetwork  `json:"network,omitempty"`
+	Requests  []ReportRequest `json:"requests,omitempty"`
+}
+
+// ReportCrawler is the DNS verification (-verify) of a class whose requests
+// claim to come from the search-engine crawler Name. Status is verified,
+// spoofed or unknown.
+type ReportCrawler struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Host      string `json:"host,omitempty"`
+	Addresses int    `json:"addresses"`
+}
+
+// ReportUAClass is the number of requests of a User-Agent class.
+type ReportUAClass struct {
+	UAClass string `json:"ua_class"`
+	Count   int    `json:"count"`
+}
+
+// newReportUAClasses converts counts into ReportUAClasses, most requests
+// first.
+func newReportUAClasses(counts map[string]int) []ReportUAClass {
+	uaClasses := []ReportUAClass{}
+	for _, class := range sortedByCount(counts) {
+		uaClasses = append(uaClasses, ReportUAClass{UAClass: class, Count: counts[class]})
+	}
+	return uaClasses
+}
+
+// ReportRequest is a single request of a top class.
+type ReportRequest struct {
+	Time      time.Time `json:"time"`
+	IP        string    `json:"ip"`
+	Method    string    `json:"method"`
+	Request   string    `json:"request"`
+	Code      int       `json:"code"`
+	RTime     *float64  `json:"rtime,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Source    string    `json:"source,omitempty"`
+}
+
+// ReportRejects are the malformed lines that were not counted. Ratio is
+// their share of the lines read.
+type ReportRejects struct {
+	Total   int            `json:"total"`
+	Ratio   float64        `json:"ratio"`
+	Reasons []ReportReject `json:"reasons"`
+}
+
+// ReportReject is the number of lines rejected for Reason, with the first
+// of them as samples.
+type ReportReject struct {
+	Reason  string   `json:"reason"`
+	Count   int      `json:"count"`
+	Samples []string `json:"samples"`
+}
+
+// newReportRejects converts r into ReportRejects, nil if no line was
+// rejected.
+func newReportRejects(r *Rejects, linesRead int) *ReportRejects {
+	if r.Total() == 0 {
+		return nil
+	}
+	rejects := &ReportRejects{Total: r.Total(), Ratio: r.Ratio(linesRead), Reasons: []ReportReject{}}
+	for _, reason := range rejectReasons {
+		if r.Count[reason] > 0 {
+			rejects.Reasons = append(rejects.Reasons, ReportReject{Reason: reason, Count: r.Count[reason], Samples: r.Samples[reason]})
+		}
+	}
+	return rejects
+}
+
+// ReportCode is the number of requests answered with Code.
+type ReportCode struct {
+	Code  int `json:"code"`
+	Count int `json:"count"`
+}
+
+// ReportLongest is the response time (in seconds) of a class by the
+// statistic of -rt-stat (ReportRTimes.Stat).
+type ReportLongest struct {
+	Class string  `json:"class"`
+	RTime float64 `json:"rtime"`
+}
+
+// ReportRTimes are the response-time statistics of the top classes and the
+// top request paths, ranked by Stat (-rt-stat).
+type ReportRTimes struct {
+	Stat    string        `json:"stat"`
+	Classes []ReportRTime `json:"classes"`
+	Paths   []ReportRTime `json:"paths"`
+}
+
+// ReportRTime are the response-time statistics (in seconds) of a class or a
+// path. The percentiles are accurate to 1%.
+type ReportRTime struct {
+	Key   string  `json:"key"`
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+	Total float64 `json:"total"`
+}
+
+// newReportRTimes returns the statistics of the top N keys of stats ranked by
+// stat.
+func newReportRTimes(stats map[string]*RTimeStats, stat string) []ReportRTime {
+	rtimes := []ReportRTime{}
+	for _, key := range rankByRTime(stats, stat, *topIPsCount) {
+		s := stats[key]
+		rtimes = append(rtimes, ReportRTime{
+			Key:   key,
+			Count: s.Count,
+			Mean:  s.Mean(),
+			P50:   s.Quantile(0.5),
+			P90:   s.Quantile(0.9),
+			P99:   s.Quantile(0.99),
+			Max:   s.Max,
+			Total: s.Total,
+		})
+	}
+	return rtimes
+}
+
+// newReportRequest converts entry into a ReportRequest, with the response
+// time in seconds.
+func newReportRequest(entry LogEntry) ReportRequest {
+	req := ReportRequest{
+		Time:      entry.TimeStamp,
+		IP:        entry.IP,
+		Method:    entry.Method,
+		Request:   entry.Request,
+		Code:      entry.Code,
+		UserAgent: entry.UserAgent,
+		Source:    entry.Source,
+	}
+	if rt, ok := rtimeSeconds(entry.RTime); ok {
+		req.RTime = &rt
+	}
+	return req
+}
+
+// BuildReport assembles the report of the analysis in l. longest are the
+// classes by the -rt-stat response time (see GetTopLongRequests). With
+// details the requests of each top class are included.
+func (l Log2Analyze) BuildReport(topIPs map[string]int, codeCounts map[int]int, longest map[string]float64, details bool) Report {
+	report := Report{
+		SchemaVersion: ReportSchemaVersion,
+		Generated:     time.Now(),
+		Files:         l.files(),
+		Window:        ReportWindow{End: l.EndTime, Minutes: *timeRange},
+		Filters: ReportFilters{
+			IP:             ipAddress.values,
+			NotIP:          notIP.values,
+			ResponseCode:   *responseCode,
+			NoResponseCode: *noResponseCode,
+			Query:          l.QueryString,
+			UAClass:        *uaClass,
+			IPClass:        *IPclass,
+			LogType:        config.LogType,
+		},
+		LinesRead:       l.LinesRead,
+		TotalEntries:    l.EntryCount,
+		CountErrorBound: l.aggregate().ErrorBound,
+		TopClasses:      []ReportClass{},
+		ResponseCodes:   []ReportCode{},
+		LongestRequests: []ReportLongest{},
+	}
+	if *timeRange != 0 {
+		start := l.StartTime
+		report.Window.Start = &start
+	}
+
+	index := make(map[string]int, len(topIPs))
+	uaClasses := l.UAClassesOf(sortedByCount(topIPs))
+	for i, class := range sortedByCount(topIPs) {
+		index[class] = i
+		report.TopClasses = append(report.TopClasses, ReportClass{Class: class, Count: topIPs[class], UAClasses: newReportUAClasses(uaClasses[class])})
+	}
+	if details {
+		l.EachEntry(func(entry LogEntry) {
+			if i, ok := index[entry.Class]; ok {
+				report.TopClasses[i].Requests = append(report.TopClasses[i].Requests, newReportRequest(entry))
+			}
+		})
+	}
+
+	for code, count := range codeCounts {
+		report.ResponseCodes = append(report.ResponseCodes, ReportCode{Code: code, Count: count})
+	}
+	sort.Slice(report.ResponseCodes, func(i, j int) bool {
+		a, b := report.ResponseCodes[i], report.ResponseCodes[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Code < b.Code
+	})
+
+	for _, class := range sortedByRtime(longest) {
+		report.LongestRequests = append(report.LongestRequests, ReportLongest{Class: class, RTime: longest[class]})
+	}
+	agg := l.aggregate()
+	report.UAClasses = newReportUAClasses(agg.UAClassCount)
+	report.ResponseTimes = ReportRTimes{
+		Stat:    *rtStat,
+		Classes: newReportRTimes(agg.RTimes, *rtStat),
+		Paths:   newReportRTimes(agg.PathRTimes, *rtStat),
+	}
+	report.Rejects = newReportRejects(l.Rejects, l.LinesRead)
+	return report
+}
+
+// ReportNetwork is the enrichment (-enrich) of a class: its PTR name, its
+// autonomous system and its country.
+type ReportNetwork struct {
+	PTR     string `json:"ptr,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	Org     string `json:"as_org,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// AddEnrichment adds the enrichment of the top classes.
+func (report *Report) AddEnrichment(infos map[string]ipInfo) {
+	for i, class := range report.TopClasses {
+		if info, ok := infos[class.Class]; ok {
+			report.TopClasses[i].Network = &ReportNetwork{PTR: info.PTR, ASN: info.ASN, Org: info.Org, Country: info.Country}
+		}
+	}
+}
+
+// AddCrawlerChecks marks the top classes with their crawler verification.
+func (report *Report) AddCrawlerChecks(checks map[string]CrawlerCheck) {
+	for i, class := range report.TopClasses {
+		if check, ok := checks[class.Class]; ok {
+			report.TopClasses[i].Crawler = &ReportCrawler{Name: check.Crawler, Status: check.Status, Host: check.Host, Addresses: check.Addresses}
+		}
+	}
+}
+
+// WriteJSON writes report as one indented JSON document.
+func (report Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// ndjsonRecord is one line of the -o ndjson output. Type is "summary" for
+// the first line (the report without requests), "class" for each top class
+// and "request" for each request of a top class. Class names the top class
+// of "class" and "request" records.
+type ndjsonRecord struct {
+	Type  string `json:"type"`
+	Class string `json:"class,omitempty"`
+	*Report
+	*ReportClass
+	*ReportRequest
+}
+
+// WriteNDJSON writes report as newline-delimited JSON: a summary record,
+// then for each top class a class record followed by its request records.
+func (report Report) WriteNDJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	classes := report.TopClasses
+	summary := report
+	summary.TopClasses = make([]ReportClass, len(classes))
+	for i, class := range classes {
+		summary.TopClasses[i] = class
+		summary.TopClasses[i].Requests = nil
+	}
+	if err := enc.Encode(ndjsonRecord{Type: "summary", Report: &summary}); err != nil {
+		return err
+	}
+	for _, class := range classes {
+		c := class
+		c.Class, c.Requests = "", nil
+		if err := enc.Encode(ndjsonRecord{Type: "class", Class: class.Class, ReportClass: &c}); err != nil {
+			return err
+		}
+		for i := range class.Requests {
+			if err := enc.Encode(ndjsonRecord{Type: "request", Class: class.Class, ReportRequest: &class.Requests[i]}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteReport writes report in the given output format ("json" or "ndjson").
+func (report Report) WriteReport(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return report.WriteJSON(w)
+	case "ndjson":
+		return report.WriteNDJSON(w)
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
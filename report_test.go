@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/")
+
+// reportTestAnalysis returns a small analysis with fixed content for the
+// golden-file tests.
+func reportTestAnalysis() Log2Analyze {
+	ts := time.Date(2026, 2, 10, 12, 1, 0, 0, time.UTC)
+	return Log2Analyze{
+		FileName:   "access.log",
+		DateLayout: "02/Jan/2006:15:04:05 -0700",
+		StartTime:  time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC),
+		EndTime:    time.Date(2026, 2, 10, 12, 5, 0, 0, time.UTC),
+		LinesRead:  5,
+		EntryCount: 4,
+		Entries: []LogEntry{
+			{IP: "1.1.1.1", Class: "1.1.1.1", TimeStamp: ts, Method: "GET", Request: "/a", Code: 200, RTime: "1500", UserAgent: "curl/8.0", UAClass: uaHTTPLibrary, Source: "access.log"},
+			{IP: "2.2.2.2", Class: "2.2.2.2", TimeStamp: ts.Add(time.Second), Method: "POST", Request: "/b", Code: 500, RTime: "4000", UAClass: uaOther, Source: "access.log"},
+			{IP: "1.1.1.1", Class: "1.1.1.1", TimeStamp: ts.Add(2 * time.Second), Method: "GET", Request: "/c?q=\"x\"", Code: 404, UAClass: uaOther, Source: "access.log"},
+			{IP: "3.3.3.3", Class: "3.3.3.3", TimeStamp: ts.Add(3 * time.Second), Method: "GET", Request: "/d", Code: 200, RTime: "10", UAClass: uaOther, Source: "access.log"},
+		},
+	}
+}
+
+// buildTestReport builds the report of reportTestAnalysis for the top 2 classes.
+func buildTestReport() Report {
+	setupTestGlobals()
+	n := 2
+	topIPsCount = &n
+	l := reportTestAnalysis()
+	topIPs, codeCounts := l.GetTopIPs()
+	report := l.BuildReport(topIPs, codeCounts, l.GetTopLongRequests(), true)
+	report.Generated = time.Date(2026, 2, 10, 12, 5, 1, 0, time.UTC)
+	return report
+}
+
+// checkGolden compares got with the golden file testdata/name, or rewrites
+// the golden file when the tests are run with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := "testdata/" + name
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from golden file:\n got: %s\nwant: %s", name, got, want)
+	}
+}
+
+// ──────────────────────────────────────────────
+// BuildReport
+// ──────────────────────────────────────────────
+
+func TestBuildReport(t *testing.T) {
+	report := buildTestReport()
+
+	if report.SchemaVersion != ReportSchemaVersion {
+		t.Errorf("SchemaVersion: got %d", report.SchemaVersion)
+	}
+	if report.Window.Start == nil || report.Window.Minutes != 5 {
+		t.Errorf("Window: got %+v", report.Window)
+	}
+	if len(report.TopClasses) != 2 || report.TopClasses[0].Class != "1.1.1.1" || len(report.TopClasses[0].Requests) != 2 {
+		t.Fatalf("TopClasses: got %+v", report.TopClasses)
+	}
+	if rt := report.TopClasses[0].Requests[0].RTime; rt == nil || *rt != 1.5 {
+		t.Errorf("RTime should be normalized to seconds, got %v", rt)
+	}
+	if report.TopClasses[0].Requests[1].RTime != nil {
+		t.Error("RTime should be null when the log has none")
+	}
+	if report.ResponseCodes[0].Code != 200 || report.ResponseCodes[0].Count != 2 {
+		t.Errorf("ResponseCodes: got %+v", report.ResponseCodes)
+	}
+	if report.LongestRequests[0].Class != "2.2.2.2" || report.LongestRequests[0].RTime != 4.0 {
+		t.Errorf("LongestRequests: got %+v", report.LongestRequests)
+	}
+}
+
+func TestBuildReportWholeFile(t *testing.T) {
+	setupTestGlobals()
+	tr := 0
+	timeRange = &tr
+	l := reportTestAnalysis()
+	topIPs, codeCounts := l.GetTopIPs()
+	report := l.BuildReport(topIPs, codeCounts, nil, false)
+
+	if report.Window.Start != nil {
+		t.Errorf("Window.Start should be null for -m 0, got %v", report.Window.Start)
+	}
+	for _, class := range report.TopClasses {
+		if len(class.Requests) != 0 {
+			t.Errorf("requests should not be included without details, got %+v", class)
+		}
+	}
+	if report.LongestRequests == nil {
+		t.Error("LongestRequests should be an empty list, not null")
+	}
+}
+
+// ──────────────────────────────────────────────
+// WriteJSON / WriteNDJSON (golden files)
+// ──────────────────────────────────────────────
+
+func TestWriteJSONGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := buildTestReport().WriteReport(&buf, "json"); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "report.json", buf.Bytes())
+
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+}
+
+func TestWriteNDJSONGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := buildTestReport().WriteReport(&buf, "ndjson"); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "report.ndjson", buf.Bytes())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	types := make([]string, 0, len(lines))
+	for _, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line is not valid JSON: %v\n%s", err, line)
+		}
+		types = append(types, record["type"].(string))
+		if record["type"] != "summary" && record["class"] == nil {
+			t.Errorf("%s record without class: %s", record["type"], line)
+		}
+	}
+	want := "summary class request request class request"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("record types: got %q, want %q", got, want)
+	}
+}
+
+func TestWriteReportUnknownFormat(t *testing.T) {
+	if err := buildTestReport().WriteReport(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
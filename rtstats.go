@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// rtimeSketchAccuracy is the relative error of the quantiles returned by an
+// rtimeSketch.
+const rtimeSketchAccuracy = 0.01
+
+// rtimeSketchMin is the smallest response time (in seconds) that gets a
+// bucket of its own; smaller values are counted as zero.
+const rtimeSketchMin = 1e-6
+
+var rtimeSketchGamma = (1 + rtimeSketchAccuracy) / (1 - rtimeSketchAccuracy)
+
+// rtimeSketch is a mergeable quantile sketch (DDSketch). Values are counted
+// in buckets whose width grows logarithmically with the value, so each
+// quantile is within rtimeSketchAccuracy of the true value no matter how many
+// values were added, and about a thousand buckets cover 1µs to one hour.
+// Merging two sketches adds their buckets.
+type rtimeSketch struct {
+	Buckets map[int]int
+	Zero    int
+	Count   int
+}
+
+// Add counts the value v (in seconds).
+func (s *rtimeSketch) Add(v float64) {
+	s.Count++
+	if v < rtimeSketchMin {
+		s.Zero++
+		return
+	}
+	if s.Buckets == nil {
+		s.Buckets = make(map[int]int)
+	}
+	s.Buckets[int(math.Ceil(math.Log(v)/math.Log(rtimeSketchGamma)))]++
+}
+
+// Merge adds the values counted in o to s.
+func (s *rtimeSketch) Merge(o *rtimeSketch) {
+	s.Count += o.Count
+	s.Zero += o.Zero
+	if len(o.Buckets) > 0 && s.Buckets == nil {
+		s.Buckets = make(map[int]int, len(o.Buckets))
+	}
+	for i, n := range o.Buckets {
+		s.Buckets[i] += n
+	}
+}
+
+// Quantile returns the q-quantile (0 <= q <= 1) of the values, e.g. the
+// median for 0.5. It returns 0 for an empty sketch.
+func (s *rtimeSketch) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := q * float64(s.Count-1)
+	seen := s.Zero
+	if float64(seen) > rank {
+		return 0
+	}
+	indexes := make([]int, 0, len(s.Buckets))
+	for i := range s.Buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		seen += s.Buckets[i]
+		if float64(seen) > rank {
+			return 2 * math.Pow(rtimeSketchGamma, float64(i)) / (rtimeSketchGamma + 1)
+		}
+	}
+	return 2 * math.Pow(rtimeSketchGamma, float64(indexes[len(indexes)-1])) / (rtimeSketchGamma + 1)
+}
+
+// RTimeStats are the response-time statistics (in seconds) of a class or of
+// a request path.
+type RTimeStats struct {
+	Count  int
+	Total  float64
+	Max    float64
+	Sketch rtimeSketch
+}
+
+// Add counts a request with the response time rt.
+func (s *RTimeStats) Add(rt float64) {
+	s.Count++
+	s.Total += rt
+	s.Max = max(s.Max, rt)
+	s.Sketch.Add(rt)
+}
+
+// Merge adds the requests counted in o to s.
+func (s *RTimeStats) Merge(o *RTimeStats) {
+	s.Count += o.Count
+	s.Total += o.Total
+	s.Max = max(s.Max, o.Max)
+	s.Sketch.Merge(&o.Sketch)
+}
+
+// Mean returns the average response time.
+func (s *RTimeStats) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / float64(s.Count)
+}
+
+// Quantile returns the q-quantile of the response times (see rtimeSketch),
+// never more than Max.
+func (s *RTimeStats) Quantile(q float64) float64 {
+	return min(s.Sketch.Quantile(q), s.Max)
+}
+
+// rtimeStatistics are the statistics the -rt output can be ranked by with
+// -rt-stat.
+var rtimeStatistics = map[string]func(*RTimeStats) float64{
+	"max":   func(s *RTimeStats) float64 { return s.Max },
+	"mean":  (*RTimeStats).Mean,
+	"total": func(s *RTimeStats) float64 { return s.Total },
+	"p50":   func(s *RTimeStats) float64 { return s.Quantile(0.5) },
+	"p90":   func(s *RTimeStats) float64 { return s.Quantile(0.9) },
+	"p99":   func(s *RTimeStats) float64 { return s.Quantile(0.99) },
+}
+
+// rankByRTime returns the keys of stats ordered by descending value of the
+// statistic stat (see rtimeStatistics), at most n of them (all when n <= 0).
+// Ties are ordered by key.
+func rankByRTime(stats map[string]*RTimeStats, stat string, n int) []string {
+	value := rtimeStatistics[stat]
+	values := make(map[string]float64, len(stats))
+	for key, s := range stats {
+		values[key] = value(s)
+	}
+	keys := sortedByRtime(values)
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// pruneRTimes drops all but the keep keys of stats with the highest total
+// response time.
+func pruneRTimes(stats map[string]*RTimeStats, keep int) {
+	for _, key := range rankByRTime(stats, "total", 0)[keep:] {
+		delete(stats, key)
+	}
+}
+
+// formatRTimeStats returns a table of the statistics of keys, one line per
+// key, in the given order. Keys without statistics are skipped.
+func formatRTimeStats(keys []string, stats map[string]*RTimeStats) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("\t%-40s %8s %8s %8s %8s %8s %8s %10s\n", "", "count", "mean", "p50", "p90", "p99", "max", "total"))
+	for _, key := range keys {
+		s, ok := stats[key]
+		if !ok {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("\t%-40s %8d %8.3f %8.3f %8.3f %8.3f %8.3f %10.1f\n", key, s.Count, s.Mean(), s.Quantile(0.5), s.Quantile(0.9), s.Quantile(0.99), s.Max, s.Total))
+	}
+	return b.String()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// ──────────────────────────────────────────────
+// rtimeSketch
+// ──────────────────────────────────────────────
+
+func TestRTimeSketchQuantileAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var s rtimeSketch
+	values := make([]float64, 100000)
+	for i := range values {
+		// log-normal, median about 0.1 s with a long tail
+		values[i] = math.Exp(rng.NormFloat64()*1.5 - 2.3)
+		s.Add(values[i])
+	}
+	sort.Float64s(values)
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		want := values[int(q*float64(len(values)-1))]
+		got := s.Quantile(q)
+		if math.Abs(got-want)/want > 2*rtimeSketchAccuracy {
+			t.Errorf("p%.0f: got %v, want %v", q*100, got, want)
+		}
+	}
+	if len(s.Buckets) > 2000 {
+		t.Errorf("too many buckets: %d", len(s.Buckets))
+	}
+}
+
+func TestRTimeSketchMerge(t *testing.T) {
+	var a, b, all rtimeSketch
+	for i := 1; i <= 1000; i++ {
+		v := float64(i) / 100
+		all.Add(v)
+		if i%2 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+	}
+	a.Merge(&b)
+	for _, q := range []float64{0, 0.5, 0.9, 0.99, 1} {
+		if a.Quantile(q) != all.Quantile(q) {
+			t.Errorf("q %v: merged %v, want %v", q, a.Quantile(q), all.Quantile(q))
+		}
+	}
+}
+
+func TestRTimeSketchZeroAndEmpty(t *testing.T) {
+	var s rtimeSketch
+	if s.Quantile(0.5) != 0 {
+		t.Error("an empty sketch should return 0")
+	}
+	s.Add(0)
+	s.Add(0)
+	s.Add(2)
+	if s.Quantile(0.5) != 0 || math.Abs(s.Quantile(1)-2) > 2*rtimeSketchAccuracy {
+		t.Errorf("got p50 %v, p100 %v", s.Quantile(0.5), s.Quantile(1))
+	}
+}
+
+// ──────────────────────────────────────────────
+// RTimeStats
+// ──────────────────────────────────────────────
+
+func TestRTimeStats(t *testing.T) {
+	var s RTimeStats
+	for _, rt := range []float64{0.1, 0.1, 0.1, 0.1, 30} {
+		s.Add(rt)
+	}
+	if s.Count != 5 || s.Max != 30 || math.Abs(s.Total-30.4) > 1e-9 || math.Abs(s.Mean()-6.08) > 1e-9 {
+		t.Errorf("got %+v, mean %v", s, s.Mean())
+	}
+	if p50 := s.Quantile(0.5); math.Abs(p50-0.1) > 0.1*rtimeSketchAccuracy*2 {
+		t.Errorf("p50: got %v, the outlier should not move the median", p50)
+	}
+	if s.Quantile(1) > s.Max {
+		t.Errorf("p100 %v is above the maximum", s.Quantile(1))
+	}
+}
+
+func TestRankByRTime(t *testing.T) {
+	stats := map[string]*RTimeStats{}
+	// one slow outlier
+	addRTime(stats, "outlier", 20)
+	// many moderately slow requests
+	for i := 0; i < 100; i++ {
+		addRTime(stats, "busy", 0.5)
+	}
+	addRTime(stats, "fast", 0.01)
+
+	tests := map[string][]string{
+		"max":   {"outlier", "busy", "fast"},
+		"p50":   {"outlier", "busy", "fast"},
+		"total": {"busy", "outlier", "fast"},
+	}
+	for stat, want := range tests {
+		if got := rankByRTime(stats, stat, 0); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: got %v, want %v", stat, got, want)
+		}
+	}
+	if got := rankByRTime(stats, "total", 1); len(got) != 1 || got[0] != "busy" {
+		t.Errorf("n=1: got %v", got)
+	}
+}
+
+func TestFormatRTimeStats(t *testing.T) {
+	stats := map[string]*RTimeStats{}
+	addRTime(stats, "/slow", 2)
+	addRTime(stats, "/slow", 4)
+	out := formatRTimeStats([]string{"/slow", "/missing"}, stats)
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "/slow") || !strings.HasSuffix(lines[1], "6.0") {
+		t.Errorf("got:\n%s", out)
+	}
+}
+
+// ──────────────────────────────────────────────
+// Aggregate / GetTopLongRequests with -rt-stat
+// ──────────────────────────────────────────────
+
+func TestAggregateRTimesPerClassAndPath(t *testing.T) {
+	setupTestGlobals()
+	a := NewAggregate(0)
+	a.Add(LogEntry{Class: "1.1.1.1", Request: "/search?q=a", RTime: "1000"})
+	a.Add(LogEntry{Class: "1.1.1.1", Request: "/search?q=b", RTime: "3000"})
+	b := NewAggregate(0)
+	b.Add(LogEntry{Class: "2.2.2.2", Request: "/", RTime: "500"})
+	b.Add(LogEntry{Class: "2.2.2.2", Request: "/search"})
+	a.Merge(b)
+
+	if s := a.RTimes["1.1.1.1"]; s == nil || s.Count != 2 || s.Total != 4 {
+		t.Errorf("1.1.1.1: got %+v", s)
+	}
+	if s := a.PathRTimes["/search"]; s == nil || s.Count != 2 || s.Max != 3 {
+		t.Errorf("/search: got %+v", s)
+	}
+	if s := a.PathRTimes["/"]; s == nil || s.Count != 1 {
+		t.Errorf("/: got %+v", s)
+	}
+}
+
+func TestAggregatePrunesPathRTimes(t *testing.T) {
+	setupTestGlobals()
+	a := NewAggregate(10)
+	a.Add(LogEntry{Class: "1.1.1.1", Request: "/heavy", RTime: "60000"})
+	for i := 0; i < 100; i++ {
+		a.Add(LogEntry{Class: "1.1.1.1", Request: "/item/" + strings.Repeat("x", i), RTime: "10"})
+	}
+	if len(a.PathRTimes) > 10 {
+		t.Errorf("PathRTimes not bounded: %d", len(a.PathRTimes))
+	}
+	if _, ok := a.PathRTimes["/heavy"]; !ok {
+		t.Error("the path with the highest total should be kept")
+	}
+}
+
+func TestGetTopLongRequestsByStat(t *testing.T) {
+	setupTestGlobals()
+	l := Log2Analyze{Entries: []LogEntry{{Class: "outlier", RTime: "20000"}}}
+	for i := 0; i < 100; i++ {
+		l.Entries = append(l.Entries, LogEntry{Class: "busy", RTime: "500"})
+	}
+
+	got := l.GetTopLongRequests()
+	if got["outlier"] != 20 || got["busy"] != 0.5 {
+		t.Errorf("max: got %v", got)
+	}
+
+	stat := "total"
+	rtStat = &stat
+	n := 1
+	topIPsCount = &n
+	got = l.GetTopLongRequests()
+	if len(got) != 1 || got["busy"] != 50 {
+		t.Errorf("total: got %v", got)
+	}
+}
+
+func TestTopPathRTimes(t *testing.T) {
+	setupTestGlobals()
+	stat := "p50"
+	rtStat = &stat
+	l := Log2Analyze{Entries: []LogEntry{
+		{Class: "a", Request: "/fast", RTime: "10"},
+		{Class: "a", Request: "/slow?id=1", RTime: "2000"},
+		{Class: "b", Request: "/slow?id=2", RTime: "3000"},
+	}}
+	if got := l.TopPathRTimes(); strings.Join(got, ",") != "/slow,/fast" {
+		t.Errorf("got %v", got)
+	}
+}
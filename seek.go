@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// seekBlockSize is the number of bytes read when sampling a line during the
+// binary search. The search stops once the remaining range is smaller than
+// one block, because scanning it is then cheaper than seeking further.
+const seekBlockSize = 64 * 1024
+
+// seekSampleLines is the number of lines tried after a seek before giving up
+// on finding one with a parsable timestamp.
+const seekSampleLines = 16
+
+// seekOrderSamples is the number of lines spread over the log that
+// timeOrdered checks.
+const seekOrderSamples = 16
+
+// sampleTimestamp returns the timestamp of the first complete line at or
+// after offset that has a parsable timestamp, together with the offset at
+// which that line starts. If offset is not 0 the (possibly partial) line
+// containing offset is skipped. ok is false if no such line is found within
+// one block.
+func sampleTimestamp(r io.ReaderAt, offset, size int64) (ts time.Time, lineStart int64, ok bool) {
+	n := int64(seekBlockSize)
+	if offset+n > size {
+		n = size - offset
+	}
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return ts, 0, false
+	}
+	buf = buf[:read]
+	pos := 0
+	if offset > 0 {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return ts, 0, false
+		}
+		pos = i + 1
+	}
+	for tries := 0; tries < seekSampleLines && pos < len(buf); tries++ {
+		end := bytes.IndexByte(buf[pos:], '\n')
+		if end < 0 && offset+int64(len(buf)) < size {
+			// the line is cut off by the end of the block
+			return ts, 0, false
+		}
+		if end < 0 {
+			end = len(buf) - pos
+		}
+		if entry := createEntry(string(buf[pos : pos+end])); !entry.TimeStamp.IsZero() {
+			return entry.TimeStamp, offset + int64(pos), true
+		}
+		pos += end + 1
+	}
+	return ts, 0, false
+}
+
+// timeOrdered samples seekOrderSamples lines spread evenly over the log and
+// reports whether their timestamps ascend, allowing them to go back by
+// config.SeekTolerance. Lines without a parsable timestamp are not counted.
+func timeOrdered(r io.ReaderAt, size int64) bool {
+	var latest time.Time
+	for i := int64(0); i < seekOrderSamples; i++ {
+		ts, _, ok := sampleTimestamp(r, size*i/seekOrderSamples, size)
+		if !ok {
+			continue
+		}
+		if ts.Before(latest.Add(-config.SeekTolerance)) {
+			return false
+		}
+		if ts.After(latest) {
+			latest = ts
+		}
+	}
+	return true
+}
+
+// seekOffset binary-searches the byte offsets of a time-ordered log for the
+// start of a line that lies before the first line with a timestamp at or
+// after target. The returned offset is always the start of a line (or 0).
+// If a sampled block has no parsable line the search stops early, so the
+// result errs on the side of reading more.
+func seekOffset(r io.ReaderAt, size int64, target time.Time) int64 {
+	lo, hi := int64(0), size
+	for hi-lo > seekBlockSize {
+		mid := lo + (hi-lo)/2
+		ts, lineStart, ok := sampleTimestamp(r, mid, size)
+		if !ok {
+			break
+		}
+		if ts.Before(target) {
+			lo = lineStart
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
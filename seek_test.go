@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildOrderedLog returns n apache log lines one second apart starting at start.
+func buildOrderedLog(start time.Time, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		fmt.Fprintf(&b, "10.0.%d.%d - - [%s] \"GET /item/%d HTTP/1.1\" 200 100 \"-\" \"-\"\n",
+			i%7, i%250, ts.Format("02/Jan/2006:15:04:05 -0700"), i)
+	}
+	return b.String()
+}
+
+// ──────────────────────────────────────────────
+// sampleTimestamp / seekOffset
+// ──────────────────────────────────────────────
+
+func TestSampleTimestampSkipsPartialLine(t *testing.T) {
+	setupTestGlobals()
+	start := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	content := buildOrderedLog(start, 3)
+	r := strings.NewReader(content)
+
+	// offset 5 is inside the first line, so the second line is sampled
+	ts, lineStart, ok := sampleTimestamp(r, 5, int64(len(content)))
+	if !ok {
+		t.Fatal("expected a timestamp")
+	}
+	if !ts.Equal(start.Add(time.Second)) {
+		t.Errorf("timestamp: got %v, want %v", ts, start.Add(time.Second))
+	}
+	if lineStart != int64(strings.Index(content, "\n")+1) {
+		t.Errorf("lineStart: got %d, want start of second line", lineStart)
+	}
+}
+
+func TestSampleTimestampSkipsUnparsableLines(t *testing.T) {
+	setupTestGlobals()
+	start := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	content := "garbage\n" + "more garbage\n" + buildOrderedLog(start, 1)
+	r := strings.NewReader(content)
+
+	ts, _, ok := sampleTimestamp(r, 0, int64(len(content)))
+	if !ok || !ts.Equal(start) {
+		t.Errorf("got %v (ok=%v), want %v", ts, ok, start)
+	}
+}
+
+func TestSeekOffset(t *testing.T) {
+	setupTestGlobals()
+	start := time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC)
+	content := buildOrderedLog(start, 20000)
+	r := strings.NewReader(content)
+	target := start.Add(15000 * time.Second)
+
+	offset := seekOffset(r, int64(len(content)), target)
+
+	if offset != 0 && content[offset-1] != '\n' {
+		t.Errorf("offset %d is not at the start of a line", offset)
+	}
+	targetLine := strings.Index(content, target.Format("02/Jan/2006:15:04:05 -0700"))
+	if int64(targetLine) < offset {
+		t.Errorf("offset %d is past the target line at %d", offset, targetLine)
+	}
+	if int64(targetLine)-offset > 2*seekBlockSize {
+		t.Errorf("offset %d is too far before the target line at %d", offset, targetLine)
+	}
+}
+
+func TestSeekOffsetSmallFile(t *testing.T) {
+	setupTestGlobals()
+	content := buildOrderedLog(time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC), 10)
+	if got := seekOffset(strings.NewReader(content), int64(len(content)), time.Now()); got != 0 {
+		t.Errorf("small files should be scanned from the start, got offset %d", got)
+	}
+}
+
+// unorderedLog returns the lines of buildOrderedLog(start, n) with the lines
+// from first to last moved to the beginning.
+func unorderedLog(start time.Time, n, first, last int) string {
+	lines := strings.SplitAfter(buildOrderedLog(start, n), "\n")
+	moved := append([]string{}, lines[first:last]...)
+	return strings.Join(append(moved, append(lines[:first], lines[last:]...)...), "")
+}
+
+func TestTimeOrdered(t *testing.T) {
+	setupTestGlobals()
+	config.SeekTolerance = 30 * time.Second
+	start := time.Date(2026, 2, 10, 0, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		content string
+		want    bool
+	}{
+		"ordered":   {buildOrderedLog(start, 20000), true},
+		"unordered": {unorderedLog(start, 20000, 14300, 14400), false},
+		"garbage":   {"garbage\nmore garbage\n", true},
+	}
+	for name, tt := range tests {
+		if got := timeOrdered(strings.NewReader(tt.content), int64(len(tt.content))); got != tt.want {
+			t.Errorf("%s: got %v, want %v", name, got, tt.want)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// RetrieveEntries with seeking
+// ──────────────────────────────────────────────
+
+func TestRetrieveEntriesSeeksToWindow(t *testing.T) {
+	setupTestGlobals()
+	config.SeekTimeWindow = true
+	config.SeekTolerance = 30 * time.Second
+
+	loc := time.Now().Location()
+	start := time.Date(2026, 2, 10, 0, 0, 0, 0, loc)
+	tmpFile := writeTempLogFile(t, buildOrderedLog(start, 20000))
+	defer os.Remove(tmpFile)
+
+	// 04:00 is 14400 s after start, the window covers (03:55, 04:00)
+	l := &Log2Analyze{
+		FileName:     tmpFile,
+		DateLayout:   "02/Jan/2006:15:04:05 -0700",
+		Date2analyze: "2026-02-10",
+	}
+	log2Analyze = l
+	l.RetrieveEntries("04:00", 5)
+
+	if l.EntryCount != 299 {
+		t.Errorf("EntryCount: got %d, want 299", l.EntryCount)
+	}
+	if l.LinesRead >= 20000/2 {
+		t.Errorf("LinesRead: got %d, seeking should skip most of the file", l.LinesRead)
+	}
+
+	// the result must be the same as without seeking
+	config.SeekTimeWindow = false
+	full := &Log2Analyze{
+		FileName:     tmpFile,
+		DateLayout:   "02/Jan/2006:15:04:05 -0700",
+		Date2analyze: "2026-02-10",
+	}
+	log2Analyze = full
+	full.RetrieveEntries("04:00", 5)
+	if full.EntryCount != l.EntryCount {
+		t.Errorf("EntryCount without seeking: got %d, with seeking %d", full.EntryCount, l.EntryCount)
+	}
+	if full.LinesRead != 20000 {
+		t.Errorf("LinesRead without seeking: got %d, want 20000", full.LinesRead)
+	}
+}
+
+func TestRetrieveEntriesUnorderedLogReadInFull(t *testing.T) {
+	setupTestGlobals()
+	config.SeekTimeWindow = true
+	config.SeekTolerance = 30 * time.Second
+
+	start := time.Date(2026, 2, 10, 0, 0, 0, 0, time.Now().Location())
+	// the requests of 03:58:20 to 03:59:59 are at the start of the file
+	tmpFile := writeTempLogFile(t, unorderedLog(start, 20000, 14300, 14400))
+	defer os.Remove(tmpFile)
+
+	l := &Log2Analyze{
+		FileName:     tmpFile,
+		DateLayout:   "02/Jan/2006:15:04:05 -0700",
+		Date2analyze: "2026-02-10",
+	}
+	log2Analyze = l
+	l.RetrieveEntries("04:00", 5)
+
+	if l.EntryCount != 299 || l.LinesRead != 20000 {
+		t.Errorf("EntryCount %d, LinesRead %d: want 299 and 20000", l.EntryCount, l.LinesRead)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+)
+
+// entrySpill buffers matching log entries in a temporary file, so that the
+// detail lines for the output files do not have to be kept in memory.
+type entrySpill struct {
+	file  *os.File
+	w     *bufio.Writer
+	enc   *gob.Encoder
+	count int
+}
+
+// newEntrySpill creates the temporary spill file.
+func newEntrySpill() (*entrySpill, error) {
+	file, err := os.CreateTemp("", "topFive-spill-*")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(file)
+	return &entrySpill{file: file, w: w, enc: gob.NewEncoder(w)}, nil
+}
+
+// Write appends entry to the spill file.
+func (s *entrySpill) Write(entry LogEntry) error {
+	s.count++
+	return s.enc.Encode(entry)
+}
+
+// Each calls fn for every entry in the spill file, in the order they were
+// written.
+func (s *entrySpill) Each(fn func(LogEntry)) error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// the file is read in full, so the write position is at the end again
+	// afterwards and further entries can be appended
+	dec := gob.NewDecoder(bufio.NewReader(s.file))
+	for {
+		var entry LogEntry
+		err := dec.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(entry)
+	}
+}
+
+// Close closes and removes the spill file.
+func (s *entrySpill) Close() error {
+	err := s.file.Close()
+	if rmErr := os.Remove(s.file.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// entrySpill
+// ──────────────────────────────────────────────
+
+func TestEntrySpillRoundTrip(t *testing.T) {
+	spill, err := newEntrySpill()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := spill.file.Name()
+
+	ts := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	in := []LogEntry{
+		{IP: "1.1.1.1", Class: "1.1.1.1", TimeStamp: ts, Method: "GET", Request: "/a", Code: 200, UserAgent: "tab\there"},
+		{IP: "2.2.2.2", Class: "2.2.2.2", TimeStamp: ts.Add(time.Second), Method: "POST", Request: "/b", Code: 500, RTime: "42"},
+	}
+	for _, e := range in {
+		if err := spill.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out []LogEntry
+	if err := spill.Each(func(e LogEntry) { out = append(out, e) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(in) {
+		t.Fatalf("got %d entries, want %d", len(out), len(in))
+	}
+	for i := range in {
+		if out[i].IP != in[i].IP || out[i].UserAgent != in[i].UserAgent || !out[i].TimeStamp.Equal(in[i].TimeStamp) {
+			t.Errorf("entry %d: got %+v, want %+v", i, out[i], in[i])
+		}
+	}
+
+	if err := spill.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Error("spill file should be removed on Close")
+	}
+}
+
+func TestRetrieveEntriesSpillsBeyondLimit(t *testing.T) {
+	setupTestGlobals()
+	config.MaxEntriesInMemory = 2
+	dir := t.TempDir()
+	config.OutputFolder = dir + "/"
+
+	logContent := `192.168.1.1 - - [10/Feb/2026:12:00:00 +0000] "GET /a HTTP/1.1" 200 100 "-" "-"
+192.168.1.1 - - [10/Feb/2026:12:01:00 +0000] "GET /b HTTP/1.1" 200 100 "-" "-"
+10.0.0.1 - - [10/Feb/2026:12:02:00 +0000] "GET /c HTTP/1.1" 404 100 "-" "-"
+192.168.1.1 - - [10/Feb/2026:12:03:00 +0000] "GET /d HTTP/1.1" 200 100 "-" "-"
+`
+	tmpFile := writeTempLogFile(t, logContent)
+	defer os.Remove(tmpFile)
+
+	l := &Log2Analyze{
+		FileName:   tmpFile,
+		DateLayout: "02/Jan/2006:15:04:05 -0700",
+	}
+	log2Analyze = l
+	defer l.Close()
+
+	l.RetrieveEntries("12:05", 0)
+
+	if l.EntryCount != 4 {
+		t.Errorf("EntryCount: got %d, want 4", l.EntryCount)
+	}
+	if l.spill == nil || len(l.Entries) != 0 {
+		t.Fatalf("entries should have been spilled, got %d in memory", len(l.Entries))
+	}
+
+	topIPs, codeCounts := l.GetTopIPs()
+	if topIPs["192.168.1.1"] != 3 || codeCounts[404] != 1 {
+		t.Errorf("unexpected aggregation: %v %v", topIPs, codeCounts)
+	}
+
+	l.WriteOutputFiles(topIPs, codeCounts)
+	content, err := os.ReadFile(dir + "/00003_192.168.1.1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []string{"/a", "/b", "/d"} {
+		if !strings.Contains(string(content), req) {
+			t.Errorf("per-IP file should contain %s, got: %s", req, content)
+		}
+	}
+	if strings.Contains(string(content), "/c") {
+		t.Errorf("per-IP file should not contain entries of other IPs, got: %s", content)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// stdinName is the file name that reads the log data from standard input,
+// e.g. zcat old.gz | topFive -f -
+const stdinName = "-"
+
+// stdinReplay is the data read from piped standard input before the analysis
+// (the sample of -lt auto). It is read again before the rest of the input.
+var stdinReplay []byte
+
+// stdinReader returns standard input, starting with stdinReplay.
+func stdinReader() io.Reader {
+	return io.MultiReader(bytes.NewReader(stdinReplay), os.Stdin)
+}
+
+// openLogFile opens the log file name, or returns standard input for
+// stdinName.
+func openLogFile(name string) (*os.File, error) {
+	if name == stdinName {
+		return os.Stdin, nil
+	}
+	return os.Open(name)
+}
+
+// closeLogFile closes a file opened by openLogFile. Standard input is left
+// open.
+func closeLogFile(file *os.File) error {
+	if file == os.Stdin {
+		return nil
+	}
+	return file.Close()
+}
+
+// readsStdin reports whether one of files is standard input.
+func readsStdin(files []string) bool {
+	return StringInSlice(stdinName, files)
+}
+
+// canReread reports whether files can be read a second time. Standard input
+// and named pipes can only be read once.
+func canReread(files []string) bool {
+	for _, name := range files {
+		if name == stdinName {
+			return false
+		}
+		if info, err := os.Stat(name); err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+	}
+	return true
+}
+
+// peekCompression returns the compression format of the data in r like
+// detectCompression, without consuming it. It works on pipes, which cannot
+// be read at an offset.
+func peekCompression(r *bufio.Reader) string {
+	header, _ := r.Peek(4)
+	return compressionOf(header)
+}
+
+// keyboard returns the terminal to read the dashboard keys from: standard
+// input, or /dev/tty when the log data is read from standard input.
+func keyboard(files []string) (*os.File, error) {
+	if !readsStdin(files) {
+		return os.Stdin, nil
+	}
+	return os.Open("/dev/tty")
+}
+
+// openStreamTailer follows the lines read from r (e.g. standard input) as
+// they arrive. A pipe cannot be polled for new data without blocking, so the
+// lines are read in the background.
+func openStreamTailer(name string, r io.Reader) *tailer {
+	stream := make(chan string, 1024)
+	t := &tailer{name: name, stream: stream}
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			stream <- scanner.Text()
+		}
+		t.streamErr = scanner.Err()
+		close(stream)
+	}()
+	return t
+}
+
+// streamLines returns the lines read from the stream since the last call.
+// Once the stream has ended, the read error (if any) is returned once.
+func (t *tailer) streamLines() ([]string, error) {
+	var lines []string
+	for {
+		select {
+		case line, ok := <-t.stream:
+			if !ok {
+				t.stream = nil
+				t.streamEnded = true
+				return lines, t.streamErr
+			}
+			lines = append(lines, line)
+		default:
+			return lines, nil
+		}
+	}
+}
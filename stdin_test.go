@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipeToStdin replaces os.Stdin with a pipe that data is written to.
+func pipeToStdin(t *testing.T, data []byte) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+	go func() {
+		w.Write(data)
+		w.Close()
+	}()
+}
+
+// ──────────────────────────────────────────────
+// RetrieveEntries from standard input
+// ──────────────────────────────────────────────
+
+func TestRetrieveEntriesStdin(t *testing.T) {
+	setupTestGlobals()
+	pipeToStdin(t, []byte(compressionTestLog))
+
+	l := &Log2Analyze{
+		FileNames:  []string{stdinName},
+		DateLayout: "02/Jan/2006:15:04:05 -0700",
+	}
+	log2Analyze = l
+	l.RetrieveEntries("12:05", 0)
+
+	if l.EntryCount != 2 {
+		t.Errorf("EntryCount: got %d, want 2", l.EntryCount)
+	}
+	if want := time.Date(2026, 2, 10, 12, 1, 0, 0, time.UTC); !l.EndTime.Equal(want) {
+		t.Errorf("EndTime: got %v, want %v", l.EndTime, want)
+	}
+	if _, err := os.Stdin.Stat(); err != nil {
+		t.Errorf("stdin was closed: %v", err)
+	}
+}
+
+func TestRetrieveEntriesStdinSpillsBeyondLimit(t *testing.T) {
+	setupTestGlobals()
+	config.MaxEntriesInMemory = 1
+	pipeToStdin(t, []byte(compressionTestLog))
+
+	l := &Log2Analyze{
+		FileNames:  []string{stdinName},
+		DateLayout: "02/Jan/2006:15:04:05 -0700",
+	}
+	log2Analyze = l
+	defer l.Close()
+	l.RetrieveEntries("12:05", 0)
+
+	// standard input cannot be read a second time
+	if l.spill == nil || l.keep != nil || l.spill.count != 2 {
+		t.Errorf("entries should have been spilled, got %d in memory", len(l.Entries))
+	}
+}
+
+func TestRetrieveEntriesStdinCompressed(t *testing.T) {
+	setupTestGlobals()
+	for format, data := range compressedTestLogs(t) {
+		pipeToStdin(t, data)
+		l := &Log2Analyze{
+			FileNames:  []string{stdinName},
+			DateLayout: "02/Jan/2006:15:04:05 -0700",
+		}
+		log2Analyze = l
+		l.RetrieveEntries("12:05", 0)
+
+		if l.EntryCount != 2 {
+			t.Errorf("%s: EntryCount got %d, want 2", format, l.EntryCount)
+		}
+	}
+}
+
+func TestRetrieveEntriesStdinTimeRange(t *testing.T) {
+	setupTestGlobals()
+	config.SeekTimeWindow = true
+	tz := time.Now().Format("-0700")
+	var b strings.Builder
+	for _, ts := range []string{"11:50", "11:56", "11:58", "12:01", "12:30"} {
+		fmt.Fprintf(&b, "192.168.1.1 - - [10/Feb/2026:%s:00 %s] \"GET / HTTP/1.1\" 200 100 \"-\" \"-\"\n", ts, tz)
+	}
+	pipeToStdin(t, []byte(b.String()))
+
+	l := &Log2Analyze{
+		FileNames:    []string{stdinName},
+		DateLayout:   "02/Jan/2006:15:04:05 -0700",
+		Date2analyze: "2026-02-10",
+	}
+	log2Analyze = l
+	l.RetrieveEntries("12:00", 5)
+
+	if l.EntryCount != 2 {
+		t.Errorf("EntryCount: got %d, want 2", l.EntryCount)
+	}
+	if l.StartTime.Format("15:04") != "11:55" {
+		t.Errorf("StartTime: got %v", l.StartTime)
+	}
+}
+
+// ──────────────────────────────────────────────
+// helpers
+// ──────────────────────────────────────────────
+
+func TestPeekCompression(t *testing.T) {
+	for format, data := range compressedTestLogs(t) {
+		r := bufio.NewReader(strings.NewReader(string(data)))
+		if got := peekCompression(r); got != format {
+			t.Errorf("%s: detected %q", format, got)
+		}
+		// the magic bytes are still there for the decompressor
+		if rest, _ := io.ReadAll(r); string(rest) != string(data) {
+			t.Errorf("%s: peek consumed data", format)
+		}
+	}
+	if got := peekCompression(bufio.NewReader(strings.NewReader("ab"))); got != "" {
+		t.Errorf("short input: detected %q, want none", got)
+	}
+}
+
+func TestReadsStdin(t *testing.T) {
+	if readsStdin([]string{"access_log", "error_log"}) {
+		t.Error("files without - read stdin")
+	}
+	if !readsStdin([]string{"access_log", stdinName}) {
+		t.Error("- does not read stdin")
+	}
+}
+
+func TestCanReread(t *testing.T) {
+	tmpFile := writeTempLogFile(t, "line\n")
+	defer os.Remove(tmpFile)
+	if !canReread([]string{tmpFile}) {
+		t.Error("a regular file can be read again")
+	}
+	if canReread([]string{tmpFile, stdinName}) || canReread([]string{t.TempDir() + "/missing"}) {
+		t.Error("standard input and missing files cannot be read again")
+	}
+}
+
+func TestKeyboardWithoutStdin(t *testing.T) {
+	keys, err := keyboard([]string{"access_log"})
+	if err != nil || keys != os.Stdin {
+		t.Errorf("got %v, %v, want os.Stdin", keys, err)
+	}
+}
+
+// ──────────────────────────────────────────────
+// following standard input
+// ──────────────────────────────────────────────
+
+func TestStreamTailer(t *testing.T) {
+	r, w := io.Pipe()
+	tl := openStreamTailer(stdinName, r)
+	defer tl.Close()
+
+	// lines returns immediately although nothing was written yet
+	if lines, err := tl.lines(); len(lines) != 0 || err != nil {
+		t.Fatalf("got %q, %v", lines, err)
+	}
+	io.WriteString(w, "first\nsecond\npartial")
+	w.Close()
+
+	var got []string
+	deadline := time.Now().Add(2 * time.Second)
+	for !tl.streamEnded && time.Now().Before(deadline) {
+		lines, err := tl.lines()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, lines...)
+		time.Sleep(time.Millisecond)
+	}
+	if strings.Join(got, ",") != "first,second,partial" {
+		t.Errorf("got %q", got)
+	}
+	if lines, err := tl.lines(); len(lines) != 0 || err != nil {
+		t.Errorf("after the end: got %q, %v", lines, err)
+	}
+}
+
+func TestFollowerStdin(t *testing.T) {
+	setupTestGlobals()
+	now := time.Now()
+	line := func(ip string, ts time.Time) string {
+		return ip + ` - - [` + ts.Format("02/Jan/2006:15:04:05 -0700") + `] "GET / HTTP/1.1" 200 100 "-" "-"` + "\n"
+	}
+	pipeToStdin(t, []byte(line("10.0.0.1", now.Add(-time.Hour))+line("10.0.0.2", now)))
+	log2Analyze.FileNames = []string{stdinName}
+
+	f, err := newFollower(log2Analyze, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for !f.tailers[0].streamEnded && time.Now().Before(deadline) {
+		f.poll(time.Now())
+		time.Sleep(time.Millisecond)
+	}
+	// the old line is read but falls out of the window
+	if len(f.window.entries) != 1 || f.window.entries[0].IP != "10.0.0.2" {
+		t.Errorf("window: got %+v", f.window.entries)
+	}
+}
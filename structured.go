@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldKeys names the keys of the fields in structured logs (LogType json
+// and logfmt). In JSON a key may be a path into nested objects separated by
+// dots, e.g. "request.headers.User-Agent"; of an array the first element is
+// used. IP and TimeStamp are mandatory; this is checked when json or logfmt
+// is the log type in effect (see ApplicationConfig.compileFormat). Without a
+// Method key, Request is parsed as a request line ("GET /path HTTP/1.1").
+type FieldKeys struct {
+	IP        string `yaml:"IP"`
+	TimeStamp string `yaml:"TimeStamp"`
+	Method    string `yaml:"Method"`
+	Request   string `yaml:"Request"`
+	Code      string `yaml:"Code"`
+	RTime     string `yaml:"RTime"`
+	UserAgent string `yaml:"UserAgent"`
+	Referer   string `yaml:"Referer"`
+	VHost     string `yaml:"VHost"`
+}
+
+// structuredFormat parses JSON-lines or logfmt logs. decode returns the
+// fields of a line.
+//
+// rtimeUnit is LogFormat.RTime.Unit: numeric durations are taken as they
+// are, Go duration strings ("1.5ms") are converted to this unit.
+type structuredFormat struct {
+	keys      FieldKeys
+	decode    func(line string) (map[string]any, error)
+	rtimeUnit int
+}
+
+// compileStructuredFormat returns the parser of logType (json or logfmt)
+// reading the fields named by keys.
+func compileStructuredFormat(logType string, keys FieldKeys, rtimeUnit int) (*structuredFormat, error) {
+	var missing []string
+	if keys.IP == "" {
+		missing = append(missing, "IP")
+	}
+	if keys.TimeStamp == "" {
+		missing = append(missing, "TimeStamp")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("log type %s needs LogFormat.Keys for %s", logType, strings.Join(missing, ", "))
+	}
+	f := &structuredFormat{keys: keys, rtimeUnit: rtimeUnit}
+	switch logType {
+	case "json":
+		f.decode = decodeJSONLine
+	case "logfmt":
+		f.decode = decodeLogfmtLine
+	default:
+		return nil, fmt.Errorf("unknown structured log type %q", logType)
+	}
+	return f, nil
+}
+
+// parse extracts the fields of a log line. A line that cannot be decoded
+// gives an entry without fields.
+func (f *structuredFormat) parse(line string) LogEntry {
+	var entry LogEntry
+	fields, err := f.decode(line)
+	if err != nil {
+		LogIt.Debug("Error decoding line: " + err.Error() + ": " + line)
+		entry.Class = ipToClass(entry.IP)
+		entry.reject = rejectFields
+		return entry
+	}
+	get := func(key string) string {
+		if key == "" {
+			return ""
+		}
+		return valueString(lookupPath(fields, key))
+	}
+	entry.IP = get(f.keys.IP)
+	entry.TimeStamp = structuredTime(lookupPath(fields, f.keys.TimeStamp))
+	entry.Method = get(f.keys.Method)
+	entry.Request = get(f.keys.Request)
+	if f.keys.Method == "" {
+		entry.Method, entry.Request = splitRequestLine(entry.Request)
+	}
+	if code := get(f.keys.Code); code != "" {
+		var ok bool
+		if entry.Code, ok = parseCode(code, line); !ok {
+			entry.reject = rejectCode
+		}
+	}
+	if f.keys.RTime != "" {
+		entry.RTime = f.duration(get(f.keys.RTime))
+	}
+	entry.UserAgent = get(f.keys.UserAgent)
+	entry.Referer = get(f.keys.Referer)
+	entry.VHost = get(f.keys.VHost)
+	entry.Class = ipToClass(entry.IP)
+	return entry
+}
+
+// duration returns a duration as RTime: numbers unchanged, Go duration
+// strings converted to rtimeUnit, anything else "".
+func (f *structuredFormat) duration(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatFloat(d.Seconds()*float64(f.rtimeUnit), 'f', -1, 64)
+}
+
+// epochMillisThreshold separates epoch seconds from epoch milliseconds:
+// larger numbers are milliseconds (1e11 seconds is in the year 5138).
+const epochMillisThreshold = 1e11
+
+// structuredTime parses a timestamp given as RFC 3339 string, as epoch
+// seconds or milliseconds (number or string), or else with the DateLayout.
+// Errors are logged and give the zero time.
+func structuredTime(value any) time.Time {
+	s := valueString(value)
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		if n > epochMillisThreshold {
+			return time.UnixMicro(int64(n * 1000))
+		}
+		return parseEpoch(s)
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return ts
+	}
+	return parseLogTime(s, log2Analyze.DateLayout)
+}
+
+// lookupPath returns the value of key in fields. A key not found as a whole
+// is split at its dots and looked up in the nested objects; numeric segments
+// index arrays.
+func lookupPath(fields map[string]any, key string) any {
+	if v, ok := fields[key]; ok {
+		return v
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] != '.' {
+			continue
+		}
+		switch v := fields[key[:i]].(type) {
+		case map[string]any:
+			if found := lookupPath(v, key[i+1:]); found != nil {
+				return found
+			}
+		case []any:
+			rest := key[i+1:]
+			index, tail, _ := strings.Cut(rest, ".")
+			n, err := strconv.Atoi(index)
+			if err != nil || n < 0 || n >= len(v) {
+				continue
+			}
+			if tail == "" {
+				return v[n]
+			}
+			if m, ok := v[n].(map[string]any); ok {
+				if found := lookupPath(m, tail); found != nil {
+					return found
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// valueString returns a decoded value as a string. Of an array the first
+// element is used; objects and null give "".
+func valueString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		if len(v) > 0 {
+			return valueString(v[0])
+		}
+	}
+	return ""
+}
+
+// decodeJSONLine decodes a JSON object. Numbers are kept as json.Number, so
+// large epoch timestamps do not lose precision.
+func decodeJSONLine(line string) (map[string]any, error) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+	return fields, nil
+}
+
+// decodeLogfmtLine decodes a logfmt line: space separated key=value pairs,
+// where a value may be double quoted with \" and \\ escapes. A key without
+// "=" has the value "true".
+func decodeLogfmtLine(line string) (map[string]any, error) {
+	fields := make(map[string]any)
+	i := 0
+	for i < len(line) {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("logfmt: missing key at position %d", start)
+		}
+		if i >= len(line) || line[i] != '=' {
+			fields[key] = "true"
+			continue
+		}
+		i++
+		if i < len(line) && line[i] == '"' {
+			var value strings.Builder
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						value.WriteByte('\n')
+						continue
+					case 't':
+						value.WriteByte('\t')
+						continue
+					}
+				}
+				value.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("logfmt: unterminated quote in value of %s", key)
+			}
+			i++
+			fields[key] = value.String()
+			continue
+		}
+		start = i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		fields[key] = line[start:i]
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("logfmt: empty line")
+	}
+	return fields, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupStructuredConfig(t *testing.T, logType string, keys FieldKeys, unit int) {
+	t.Helper()
+	setupTestGlobals()
+	config.LogType = logType
+	config.LogFormat = LogFormatConfig{Keys: keys, RTime: RTimeConfig{Unit: unit}}
+	if err := config.compileFormat(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(setupTestGlobals)
+}
+
+// ──────────────────────────────────────────────
+// JSON
+// ──────────────────────────────────────────────
+
+func TestStructuredJSONCaddy(t *testing.T) {
+	setupStructuredConfig(t, "json", FieldKeys{
+		IP:        "request.remote_ip",
+		TimeStamp: "ts",
+		Method:    "request.method",
+		Request:   "request.uri",
+		Code:      "status",
+		RTime:     "duration",
+		UserAgent: "request.headers.User-Agent",
+		VHost:     "request.host",
+	}, 0)
+	line := `{"level":"info","ts":1770724800.5,"logger":"http.log.access","request":{"remote_ip":"10.0.0.1","method":"GET","host":"example.org","uri":"/a?b=1","headers":{"User-Agent":["curl/8.0"]}},"duration":0.0123,"status":404}`
+	entry := createEntry(line)
+	want := LogEntry{
+		IP:        "10.0.0.1",
+		Class:     "10.0.0.1",
+		TimeStamp: time.Date(2026, 2, 10, 12, 0, 0, 500000000, time.UTC),
+		Method:    "GET",
+		Request:   "/a?b=1",
+		Code:      404,
+		RTime:     "0.0123",
+		UserAgent: "curl/8.0",
+		UAClass:   uaHTTPLibrary,
+		VHost:     "example.org",
+	}
+	if !entry.TimeStamp.Equal(want.TimeStamp) {
+		t.Errorf("timestamp: got %v, want %v", entry.TimeStamp, want.TimeStamp)
+	}
+	entry.TimeStamp = want.TimeStamp
+	if entry != want {
+		t.Errorf("got %+v, want %+v", entry, want)
+	}
+	if rt, ok := rtimeSeconds(entry.RTime); !ok || rt != 0.0123 {
+		t.Errorf("rtime: got %v, %v (unit %d)", rt, ok, config.LogFormat.RTime.Unit)
+	}
+}
+
+func TestStructuredJSONNginxRequestLine(t *testing.T) {
+	setupStructuredConfig(t, "json", FieldKeys{IP: "remote_addr", TimeStamp: "time", Request: "request", Code: "status", UserAgent: "http_user_agent", Referer: "http_referer"}, 0)
+	entry := createEntry(`{"time":"2026-02-10T12:00:00+01:00","remote_addr":"2001:db8::1","request":"POST /login HTTP/1.1","status":"401","http_referer":"","http_user_agent":"Mozilla/5.0 \"quoted\""}`)
+	if entry.IP != "2001:db8::1" || entry.Method != "POST" || entry.Request != "/login" || entry.Code != 401 || entry.UserAgent != `Mozilla/5.0 "quoted"` {
+		t.Errorf("got %+v", entry)
+	}
+	if !entry.TimeStamp.Equal(time.Date(2026, 2, 10, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("timestamp: got %v", entry.TimeStamp)
+	}
+}
+
+func TestStructuredJSONInvalid(t *testing.T) {
+	setupStructuredConfig(t, "json", FieldKeys{IP: "ip", TimeStamp: "ts"}, 0)
+	for _, line := range []string{`not json`, `[1,2]`, `null`} {
+		entry := createEntry(line)
+		if entry.IP != "" || !entry.TimeStamp.IsZero() || entry.Class != invalidClass {
+			t.Errorf("%s: got %+v", line, entry)
+		}
+	}
+}
+
+func TestLookupPath(t *testing.T) {
+	fields, err := decodeJSONLine(`{"a":{"b":{"c":1}},"x.y":"flat","list":[{"n":"first"},{"n":"second"}],"h":{"User-Agent":["ua1","ua2"]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"a.b.c":          "1",
+		"x.y":            "flat",
+		"list.1.n":       "second",
+		"h.User-Agent":   "ua1",
+		"a.b.missing":    "",
+		"list.7.n":       "",
+		"nothing.at.all": "",
+	}
+	for key, want := range tests {
+		if got := valueString(lookupPath(fields, key)); got != want {
+			t.Errorf("%s: got %q, want %q", key, got, want)
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// timestamps and durations
+// ──────────────────────────────────────────────
+
+func TestStructuredTime(t *testing.T) {
+	setupTestGlobals()
+	want := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	for _, value := range []any{"2026-02-10T12:00:00Z", "2026-02-10T13:00:00+01:00", "1770724800", "1770724800000", "10/Feb/2026:12:00:00 +0000"} {
+		if got := structuredTime(value); !got.Equal(want) {
+			t.Errorf("%v: got %v, want %v", value, got, want)
+		}
+	}
+	if got := structuredTime("1770724800123"); !got.Equal(want.Add(123 * time.Millisecond)) {
+		t.Errorf("epoch millis: got %v", got)
+	}
+	if got := structuredTime(nil); !got.IsZero() {
+		t.Errorf("missing timestamp: got %v", got)
+	}
+}
+
+func TestStructuredDuration(t *testing.T) {
+	tests := map[int]map[string]string{
+		1:       {"0.25": "0.25", "250ms": "0.25", "1m": "60", "-": ""},
+		1000:    {"250": "250", "250ms": "250", "1.5s": "1500"},
+		1000000: {"1µs": "1", "2ms": "2000"},
+	}
+	for unit, values := range tests {
+		f := &structuredFormat{rtimeUnit: unit}
+		for value, want := range values {
+			if got := f.duration(value); got != want {
+				t.Errorf("unit %d, %q: got %q, want %q", unit, value, got, want)
+			}
+		}
+	}
+}
+
+// ──────────────────────────────────────────────
+// logfmt
+// ──────────────────────────────────────────────
+
+func TestDecodeLogfmtLine(t *testing.T) {
+	fields, err := decodeLogfmtLine(`time=2026-02-10T12:00:00Z ip=10.0.0.1 msg="GET /a b" ua="say \"hi\"" empty= flag http.status=200`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"time": "2026-02-10T12:00:00Z", "ip": "10.0.0.1", "msg": "GET /a b", "ua": `say "hi"`, "empty": "", "flag": "true", "http.status": "200"}
+	for key, value := range want {
+		if got := valueString(fields[key]); got != value {
+			t.Errorf("%s: got %q, want %q", key, got, value)
+		}
+	}
+	for _, line := range []string{``, `a="unterminated`, `=value`} {
+		if _, err := decodeLogfmtLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestStructuredLogfmt(t *testing.T) {
+	setupStructuredConfig(t, "logfmt", FieldKeys{IP: "remote", TimeStamp: "ts", Method: "method", Request: "path", Code: "http.status", RTime: "took", UserAgent: "ua"}, 1000)
+	entry := createEntry(`ts=1770724800123 remote=10.0.0.1 method=GET path=/api/v1 http.status=200 took=45ms ua="Go-http-client/1.1"`)
+	if entry.IP != "10.0.0.1" || entry.Method != "GET" || entry.Request != "/api/v1" || entry.Code != 200 || entry.RTime != "45" || entry.UserAgent != "Go-http-client/1.1" {
+		t.Errorf("got %+v", entry)
+	}
+	if rt, ok := rtimeSeconds(entry.RTime); !ok || rt != 0.045 {
+		t.Errorf("rtime: got %v, %v", rt, ok)
+	}
+}
+
+func TestCompileStructuredFormatErrors(t *testing.T) {
+	setupTestGlobals()
+	defer setupTestGlobals()
+	config.LogType = "json"
+	config.LogFormat = LogFormatConfig{Keys: FieldKeys{Request: "uri"}}
+	err := config.compileFormat()
+	if err == nil || !strings.Contains(err.Error(), "IP, TimeStamp") {
+		t.Errorf("expected an error naming IP and TimeStamp, got %v", err)
+	}
+	if _, err := compileStructuredFormat("yaml", FieldKeys{IP: "ip", TimeStamp: "ts"}, 1); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxTimelineBuckets bounds the number of buckets of a timeline, so a tiny
+// bucket on a long window does not exhaust the memory.
+const maxTimelineBuckets = 1000000
+
+// Timeline counts requests per time bucket, starting at Start.
+type Timeline struct {
+	Start  time.Time
+	Bucket time.Duration
+	Counts []int
+}
+
+// newTimeline returns an empty timeline with buckets of the given size
+// covering start to end.
+func newTimeline(start, end time.Time, bucket time.Duration) (*Timeline, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("invalid timeline bucket %v", bucket)
+	}
+	start = start.Truncate(bucket)
+	n := 0
+	if !end.Before(start) {
+		n = int(end.Sub(start)/bucket) + 1
+	}
+	if n > maxTimelineBuckets {
+		return nil, fmt.Errorf("a timeline with %v buckets from %s to %s has %d buckets, use a larger bucket", bucket, start.Format(time.RFC3339), end.Format(time.RFC3339), n)
+	}
+	return &Timeline{Start: start, Bucket: bucket, Counts: make([]int, n)}, nil
+}
+
+// Add counts a request at ts. Requests outside the timeline are ignored.
+func (t *Timeline) Add(ts time.Time) {
+	t.AddN(ts, 1)
+}
+
+// AddN counts n requests at ts.
+func (t *Timeline) AddN(ts time.Time, n int) {
+	if ts.Before(t.Start) {
+		return
+	}
+	if i := int(ts.Sub(t.Start) / t.Bucket); i < len(t.Counts) {
+		t.Counts[i] += n
+	}
+}
+
+// bucketTime returns the start time of bucket i.
+func (t *Timeline) bucketTime(i int) time.Time {
+	return t.Start.Add(time.Duration(i) * t.Bucket)
+}
+
+// Median returns the median number of requests per bucket, counting the
+// buckets without requests.
+func (t *Timeline) Median() float64 {
+	if len(t.Counts) == 0 {
+		return 0
+	}
+	counts := append([]int(nil), t.Counts...)
+	sort.Ints(counts)
+	mid := len(counts) / 2
+	if len(counts)%2 == 0 {
+		return float64(counts[mid-1]+counts[mid]) / 2
+	}
+	return float64(counts[mid])
+}
+
+// Burst is a run of consecutive buckets above the burst threshold.
+type Burst struct {
+	Start  time.Time
+	End    time.Time
+	Peak   int
+	Median float64
+}
+
+// burstThreshold returns the number of requests per bucket above which a
+// bucket is part of a burst: factor times the median, but at least factor
+// requests, so classes that are usually silent are not flagged for every
+// single request.
+func (t *Timeline) burstThreshold(factor float64) float64 {
+	return factor * max(t.Median(), 1)
+}
+
+// Bursts returns the intervals in which the requests per bucket exceed
+// factor times the median (see burstThreshold).
+func (t *Timeline) Bursts(factor float64) []Burst {
+	threshold := t.burstThreshold(factor)
+	median := t.Median()
+	var bursts []Burst
+	var current *Burst
+	for i, count := range t.Counts {
+		if float64(count) <= threshold {
+			current = nil
+			continue
+		}
+		if current == nil {
+			bursts = append(bursts, Burst{Start: t.bucketTime(i), Median: median})
+			current = &bursts[len(bursts)-1]
+		}
+		current.End = t.bucketTime(i + 1)
+		current.Peak = max(current.Peak, count)
+	}
+	return bursts
+}
+
+// timeLayout returns the layout for the bucket times of t: with the date if
+// the timeline spans more than one day, with seconds for sub-minute buckets.
+func (t *Timeline) timeLayout() string {
+	layout := "15:04"
+	if t.Bucket < time.Minute {
+		layout = "15:04:05"
+	}
+	if len(t.Counts) > 0 && t.bucketTime(len(t.Counts)-1).YearDay() != t.Start.YearDay() {
+		layout = "2006-01-02 " + layout
+	}
+	return layout
+}
+
+// Chart renders t as an ASCII bar chart, one line per bucket with bars of at
+// most width characters. Buckets within a burst of factor are marked with
+// "<" (factor 0 disables the marks).
+func (t *Timeline) Chart(width int, factor float64) string {
+	peak := 0
+	for _, count := range t.Counts {
+		peak = max(peak, count)
+	}
+	threshold := t.burstThreshold(factor)
+	layout := t.timeLayout()
+	var b strings.Builder
+	for i, count := range t.Counts {
+		bar := 0
+		if peak > 0 {
+			bar = (count*width + peak - 1) / peak
+		}
+		line := fmt.Sprintf("%s |%-*s| %d", t.bucketTime(i).Format(layout), width, strings.Repeat("#", bar), count)
+		if factor > 0 && float64(count) > threshold {
+			line += " <"
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// writeTimelineSection writes the chart and the bursts of t under title.
+func writeTimelineSection(w io.Writer, title string, t *Timeline, factor float64) {
+	io.WriteString(w, "\n"+title+"\n==================================================================\n")
+	fmt.Fprintf(w, "median %.1f requests per %v, burst above %.1f\n\n", t.Median(), t.Bucket, t.burstThreshold(factor))
+	io.WriteString(w, t.Chart(50, factor))
+	bursts := t.Bursts(factor)
+	if len(bursts) > 0 {
+		io.WriteString(w, "\nbursts:\n")
+		io.WriteString(w, formatBursts(bursts, t.timeLayout()))
+	}
+}
+
+// formatBursts lists bursts, one per line.
+func formatBursts(bursts []Burst, layout string) string {
+	var b strings.Builder
+	for _, burst := range bursts {
+		b.WriteString(fmt.Sprintf("\t%s - %s\tpeak %d (median %.1f)\n", burst.Start.Format(layout), burst.End.Format(layout), burst.Peak, burst.Median))
+	}
+	return b.String()
+}
+
+// timelineWindow returns the time span covered by the timelines: the -m
+// window, or the first to the last request when the whole file is analyzed.
+func (l Log2Analyze) timelineWindow() (start, end time.Time) {
+	if *timeRange != 0 {
+		return l.StartTime, l.EndTime
+	}
+	agg := l.aggregate()
+	return agg.First, agg.Last
+}
+
+// Timelines returns the timeline of all requests and of each of classes,
+// with buckets of the given size. When only the entries of the top classes
+// are retained (see retainTop), the timeline of all requests is built from
+// the requests per second of the aggregate.
+func (l Log2Analyze) Timelines(classes []string, bucket time.Duration) (*Timeline, map[string]*Timeline, error) {
+	start, end := l.timelineWindow()
+	total, err := newTimeline(start, end, bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	perClass := make(map[string]*Timeline, len(classes))
+	for _, class := range classes {
+		perClass[class] = &Timeline{Start: total.Start, Bucket: bucket, Counts: make([]int, len(total.Counts))}
+	}
+	if l.keep != nil {
+		for second, count := range l.aggregate().Seconds {
+			total.AddN(time.Unix(second, 0), count)
+		}
+	}
+	l.EachEntry(func(entry LogEntry) {
+		if l.keep == nil {
+			total.Add(entry.TimeStamp)
+		}
+		if t, ok := perClass[entry.Class]; ok {
+			t.Add(entry.TimeStamp)
+		}
+	})
+	return total, perClass, nil
+}
+
+// WriteTimelineFile writes the timeline of all requests and the timelines of
+// the top classes (see Timelines) as ASCII charts, together with the bursts
+// in which a class exceeds factor times its median rate, to the output
+// folder. It returns the name of the file.
+func (l Log2Analyze) WriteTimelineFile(total *Timeline, perClass map[string]*Timeline, topIPs map[string]int, factor float64) (string, error) {
+	name := config.OutputFolder + "timeline-" + time.Now().Local().Format("20060102_150405") + ".txt"
+	file, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	writeTimelineSection(file, fmt.Sprintf("all requests => %d", l.EntryCount), total, factor)
+	for _, class := range sortedByCount(topIPs) {
+		if t, ok := perClass[class]; ok {
+			writeTimelineSection(file, fmt.Sprintf("%s => %d requests", class, topIPs[class]), t, factor)
+		}
+	}
+	return name, nil
+}
+
+// analyzedSeconds returns the length of the analyzed time window in seconds:
+// the -m window, or the span between the first and the last request when
+// the whole file is analyzed.
+func (l Log2Analyze) analyzedSeconds() float64 {
+	if *timeRange != 0 {
+		return float64(*timeRange * 60)
+	}
+	agg := l.aggregate()
+	return agg.Last.Sub(agg.First).Seconds()
+}
+
+// requestsPerSecond returns the average number of requests per second within
+// the analyzed time window (see analyzedSeconds). ok is false if the span is
+// empty.
+func (l Log2Analyze) requestsPerSecond() (rate float64, ok bool) {
+	seconds := l.analyzedSeconds()
+	if seconds <= 0 {
+		return 0, false
+	}
+	return float64(l.EntryCount) / seconds, true
+}
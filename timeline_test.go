@@ -0,0 +1,255 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var timelineTestStart = time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+
+// timelineTestAnalysis returns an analysis of 10 minutes in which 1.1.1.1
+// sends one request per minute and bursts to 20 requests in minute 6, while
+// 2.2.2.2 sends 2 requests per minute.
+func timelineTestAnalysis() Log2Analyze {
+	l := Log2Analyze{
+		DateLayout: "02/Jan/2006:15:04:05 -0700",
+		StartTime:  timelineTestStart,
+		EndTime:    timelineTestStart.Add(10*time.Minute - time.Second),
+	}
+	for minute := 0; minute < 10; minute++ {
+		ts := timelineTestStart.Add(time.Duration(minute) * time.Minute)
+		n := 1
+		if minute == 6 {
+			n = 20
+		}
+		for i := 0; i < n; i++ {
+			l.Entries = append(l.Entries, LogEntry{IP: "1.1.1.1", Class: "1.1.1.1", TimeStamp: ts.Add(time.Duration(i) * time.Second), Code: 200})
+		}
+		for i := 0; i < 2; i++ {
+			l.Entries = append(l.Entries, LogEntry{IP: "2.2.2.2", Class: "2.2.2.2", TimeStamp: ts.Add(30 * time.Second), Code: 200})
+		}
+	}
+	l.EntryCount = len(l.Entries)
+	return l
+}
+
+// ──────────────────────────────────────────────
+// Timeline
+// ──────────────────────────────────────────────
+
+func TestNewTimeline(t *testing.T) {
+	tl, err := newTimeline(timelineTestStart.Add(90*time.Second), timelineTestStart.Add(5*time.Minute), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tl.Start.Equal(timelineTestStart.Add(time.Minute)) || len(tl.Counts) != 5 {
+		t.Errorf("got start %v, %d buckets", tl.Start, len(tl.Counts))
+	}
+	tl.Add(timelineTestStart)                      // before the start
+	tl.Add(timelineTestStart.Add(time.Hour))       // after the end
+	tl.Add(timelineTestStart.Add(5 * time.Minute)) // last bucket
+	if tl.Counts[4] != 1 || tl.Counts[0] != 0 {
+		t.Errorf("got %v", tl.Counts)
+	}
+}
+
+func TestNewTimelineLimits(t *testing.T) {
+	if _, err := newTimeline(timelineTestStart, timelineTestStart.Add(365*24*time.Hour), time.Second); err == nil {
+		t.Error("expected an error for too many buckets")
+	}
+	if _, err := newTimeline(timelineTestStart, timelineTestStart, 0); err == nil {
+		t.Error("expected an error for a zero bucket")
+	}
+}
+
+func TestTimelineMedian(t *testing.T) {
+	tests := []struct {
+		counts []int
+		want   float64
+	}{
+		{nil, 0},
+		{[]int{5}, 5},
+		{[]int{1, 9, 3}, 3},
+		{[]int{0, 0, 4, 10}, 2},
+	}
+	for _, tt := range tests {
+		tl := Timeline{Counts: tt.counts}
+		if got := tl.Median(); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.counts, got, tt.want)
+		}
+	}
+}
+
+func TestTimelineBursts(t *testing.T) {
+	tl := Timeline{Start: timelineTestStart, Bucket: time.Minute, Counts: []int{2, 3, 2, 30, 40, 2, 2, 11, 2}}
+	bursts := tl.Bursts(5)
+	if len(bursts) != 2 {
+		t.Fatalf("got %+v", bursts)
+	}
+	b := bursts[0]
+	if !b.Start.Equal(timelineTestStart.Add(3*time.Minute)) || !b.End.Equal(timelineTestStart.Add(5*time.Minute)) || b.Peak != 40 || b.Median != 2 {
+		t.Errorf("first burst: got %+v", b)
+	}
+	if bursts[1].Peak != 11 {
+		t.Errorf("second burst: got %+v", bursts[1])
+	}
+}
+
+func TestTimelineBurstsSilentClass(t *testing.T) {
+	// median 0: single requests are not bursts, but more than factor are
+	tl := Timeline{Start: timelineTestStart, Bucket: time.Second, Counts: []int{0, 1, 0, 0, 5, 6, 0}}
+	bursts := tl.Bursts(5)
+	if len(bursts) != 1 || bursts[0].Peak != 6 {
+		t.Errorf("got %+v", bursts)
+	}
+}
+
+func TestTimelineChart(t *testing.T) {
+	tl := Timeline{Start: timelineTestStart, Bucket: time.Minute, Counts: []int{1, 0, 4, 20}}
+	chart := tl.Chart(10, 5)
+	lines := strings.Split(strings.TrimSuffix(chart, "\n"), "\n")
+	want := []string{
+		"12:00 |#         | 1",
+		"12:01 |          | 0",
+		"12:02 |##        | 4",
+		"12:03 |##########| 20 <",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s", chart)
+	}
+}
+
+func TestTimelineLayout(t *testing.T) {
+	tl := Timeline{Start: timelineTestStart, Bucket: time.Second, Counts: make([]int, 3)}
+	if tl.timeLayout() != "15:04:05" {
+		t.Errorf("got %q", tl.timeLayout())
+	}
+	tl = Timeline{Start: timelineTestStart, Bucket: time.Hour, Counts: make([]int, 30)}
+	if tl.timeLayout() != "2006-01-02 15:04" {
+		t.Errorf("got %q", tl.timeLayout())
+	}
+}
+
+// ──────────────────────────────────────────────
+// Timelines / WriteTimelineFile
+// ──────────────────────────────────────────────
+
+func TestTimelines(t *testing.T) {
+	setupTestGlobals()
+	tr := 10
+	timeRange = &tr
+	l := timelineTestAnalysis()
+	total, perClass, err := l.Timelines([]string{"1.1.1.1"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(total.Counts) != 10 || total.Counts[0] != 3 || total.Counts[6] != 22 {
+		t.Errorf("total: got %v", total.Counts)
+	}
+	if _, ok := perClass["2.2.2.2"]; ok {
+		t.Error("only the given classes should get a timeline")
+	}
+	bursts := perClass["1.1.1.1"].Bursts(5)
+	if len(bursts) != 1 || !bursts[0].Start.Equal(timelineTestStart.Add(6*time.Minute)) {
+		t.Errorf("bursts: got %+v", bursts)
+	}
+}
+
+func TestTimelinesTopClassesOnly(t *testing.T) {
+	setupTestGlobals()
+	tr := 10
+	timeRange = &tr
+	l := timelineTestAnalysis()
+	l.Agg = l.aggregate()
+	// as after retainTop: only the entries of the top class are retained
+	var entries []LogEntry
+	for _, entry := range l.Entries {
+		if entry.Class == "1.1.1.1" {
+			entries = append(entries, entry)
+		}
+	}
+	l.Entries, l.keep = entries, map[string]bool{"1.1.1.1": true}
+	total, perClass, err := l.Timelines([]string{"1.1.1.1"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Counts[0] != 3 || total.Counts[6] != 22 {
+		t.Errorf("total should count all requests: got %v", total.Counts)
+	}
+	if perClass["1.1.1.1"].Counts[6] != 20 {
+		t.Errorf("1.1.1.1: got %v", perClass["1.1.1.1"].Counts)
+	}
+}
+
+func TestTimelinesWholeFile(t *testing.T) {
+	setupTestGlobals()
+	tr := 0
+	timeRange = &tr
+	l := timelineTestAnalysis()
+	l.StartTime = time.Time{}
+	total, _, err := l.Timelines(nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// from the first (12:00:00) to the last request (12:09:30)
+	if !total.Start.Equal(timelineTestStart) || len(total.Counts) != 10 {
+		t.Errorf("got start %v, %d buckets", total.Start, len(total.Counts))
+	}
+}
+
+func TestWriteTimelineFile(t *testing.T) {
+	setupTestGlobals()
+	tr := 10
+	timeRange = &tr
+	config.OutputFolder = t.TempDir() + "/"
+	l := timelineTestAnalysis()
+	topIPs := map[string]int{"1.1.1.1": 29, "2.2.2.2": 20}
+	total, perClass, err := l.Timelines(sortedByCount(topIPs), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := l.WriteTimelineFile(total, perClass, topIPs, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(content)
+	for _, want := range []string{"all requests => 49", "1.1.1.1 => 29 requests", "2.2.2.2 => 20 requests", "12:06 - 12:07\tpeak 20 (median 1.0)"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("missing %q in:\n%s", want, s)
+		}
+	}
+	if strings.Index(s, "1.1.1.1 =>") > strings.Index(s, "2.2.2.2 =>") {
+		t.Error("classes should be ordered by count")
+	}
+}
+
+// ──────────────────────────────────────────────
+// requestsPerSecond
+// ──────────────────────────────────────────────
+
+func TestRequestsPerSecond(t *testing.T) {
+	setupTestGlobals()
+	l := Log2Analyze{EntryCount: 450}
+	if rate, ok := l.requestsPerSecond(); !ok || rate != 1.5 {
+		t.Errorf("-m 5: got %v, %v", rate, ok)
+	}
+
+	tr := 0
+	timeRange = &tr
+	l = timelineTestAnalysis()
+	// 49 requests from 12:00:00 to 12:09:30
+	if rate, ok := l.requestsPerSecond(); !ok || rate != 49.0/570 {
+		t.Errorf("-m 0: got %v, %v", rate, ok)
+	}
+
+	l = Log2Analyze{Entries: []LogEntry{{TimeStamp: timelineTestStart}}, EntryCount: 1}
+	if _, ok := l.requestsPerSecond(); ok {
+		t.Error("a single request has no rate")
+	}
+}
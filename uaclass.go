@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// User-Agent classes assigned by classifyUserAgent.
+const (
+	uaSearchEngine = "search-engine"
+	uaAIScraper    = "ai-scraper"
+	uaMonitoring   = "monitoring"
+	uaHTTPLibrary  = "http-library"
+	uaHeadless     = "headless"
+	uaBot          = "bot"
+	uaBrowser      = "browser"
+	uaOther        = "other"
+)
+
+// UserAgentRule assigns Class to every User-Agent containing Match (case
+// insensitive).
+type UserAgentRule struct {
+	Class string `yaml:"Class"`
+	Match string `yaml:"Match"`
+}
+
+// builtinUserAgentRules are checked in order after the rules of the config
+// file; the first match wins. Crawlers often pretend to be a browser
+// ("Mozilla/5.0 (compatible; Googlebot/2.1; ...)"), so the browser rule
+// comes last, after the catch-all for other bots.
+var builtinUserAgentRules = []UserAgentRule{
+	{uaAIScraper, "GPTBot"},
+	{uaAIScraper, "ChatGPT-User"},
+	{uaAIScraper, "OAI-SearchBot"},
+	{uaAIScraper, "ClaudeBot"},
+	{uaAIScraper, "Claude-Web"},
+	{uaAIScraper, "Claude-User"},
+	{uaAIScraper, "anthropic-ai"},
+	{uaAIScraper, "CCBot"},
+	{uaAIScraper, "PerplexityBot"},
+	{uaAIScraper, "Perplexity-User"},
+	{uaAIScraper, "Bytespider"},
+	{uaAIScraper, "Amazonbot"},
+	{uaAIScraper, "Applebot-Extended"},
+	{uaAIScraper, "meta-externalagent"},
+	{uaAIScraper, "cohere-ai"},
+	{uaAIScraper, "Diffbot"},
+	{uaAIScraper, "YouBot"},
+	{uaAIScraper, "Timpibot"},
+	{uaAIScraper, "ImagesiftBot"},
+	{uaAIScraper, "omgili"},
+	{uaSearchEngine, "Googlebot"},
+	{uaSearchEngine, "Google-InspectionTool"},
+	{uaSearchEngine, "Storebot-Google"},
+	{uaSearchEngine, "AdsBot-Google"},
+	{uaSearchEngine, "bingbot"},
+	{uaSearchEngine, "BingPreview"},
+	{uaSearchEngine, "Slurp"},
+	{uaSearchEngine, "DuckDuckBot"},
+	{uaSearchEngine, "Baiduspider"},
+	{uaSearchEngine, "YandexBot"},
+	{uaSearchEngine, "YandexImages"},
+	{uaSearchEngine, "Applebot"},
+	{uaSearchEngine, "Sogou"},
+	{uaSearchEngine, "SeznamBot"},
+	{uaSearchEngine, "Qwantbot"},
+	{uaSearchEngine, "Qwantify"},
+	{uaSearchEngine, "MojeekBot"},
+	{uaSearchEngine, "Exabot"},
+	{uaSearchEngine, "PetalBot"},
+	{uaMonitoring, "UptimeRobot"},
+	{uaMonitoring, "Pingdom"},
+	{uaMonitoring, "StatusCake"},
+	{uaMonitoring, "Site24x7"},
+	{uaMonitoring, "check_http"},
+	{uaMonitoring, "monitoring-plugins"},
+	{uaMonitoring, "Zabbix"},
+	{uaMonitoring, "Datadog"},
+	{uaMonitoring, "NewRelicPinger"},
+	{uaMonitoring, "Better Uptime"},
+	{uaMonitoring, "Blackbox Exporter"},
+	{uaMonitoring, "kube-probe"},
+	{uaMonitoring, "ELB-HealthChecker"},
+	{uaMonitoring, "GoogleHC"},
+	{uaHeadless, "HeadlessChrome"},
+	{uaHeadless, "PhantomJS"},
+	{uaHeadless, "Puppeteer"},
+	{uaHeadless, "Playwright"},
+	{uaHeadless, "Selenium"},
+	{uaHTTPLibrary, "curl/"},
+	{uaHTTPLibrary, "Wget/"},
+	{uaHTTPLibrary, "python-requests"},
+	{uaHTTPLibrary, "python-urllib"},
+	{uaHTTPLibrary, "python-httpx"},
+	{uaHTTPLibrary, "aiohttp"},
+	{uaHTTPLibrary, "Go-http-client"},
+	{uaHTTPLibrary, "Java/"},
+	{uaHTTPLibrary, "okhttp"},
+	{uaHTTPLibrary, "Apache-HttpClient"},
+	{uaHTTPLibrary, "libwww-perl"},
+	{uaHTTPLibrary, "axios/"},
+	{uaHTTPLibrary, "node-fetch"},
+	{uaHTTPLibrary, "GuzzleHttp"},
+	{uaHTTPLibrary, "PostmanRuntime"},
+	{uaHTTPLibrary, "Scrapy"},
+	{uaBot, "bot"},
+	{uaBot, "crawler"},
+	{uaBot, "spider"},
+	{uaBot, "scraper"},
+	{uaBrowser, "Mozilla/"},
+	{uaBrowser, "Opera/"},
+}
+
+// userAgentRules are the rules classifyUserAgent checks, config.UserAgentRules
+// followed by builtinUserAgentRules, with Match in lower case. They are set
+// by loadUserAgentRules.
+var userAgentRules = lowerUserAgentRules(builtinUserAgentRules)
+
+// lowerUserAgentRules returns a copy of rules with Match in lower case.
+func lowerUserAgentRules(rules []UserAgentRule) []UserAgentRule {
+	lower := make([]UserAgentRule, len(rules))
+	for i, rule := range rules {
+		lower[i] = UserAgentRule{Class: rule.Class, Match: strings.ToLower(rule.Match)}
+	}
+	return lower
+}
+
+// loadUserAgentRules sets userAgentRules to rules (from the config file)
+// followed by the built-in rules.
+func loadUserAgentRules(rules []UserAgentRule) {
+	userAgentRules = lowerUserAgentRules(append(slices.Clone(rules), builtinUserAgentRules...))
+}
+
+// userAgentClasses lists the built-in classes.
+var userAgentClasses = []string{uaBrowser, uaSearchEngine, uaAIScraper, uaMonitoring, uaHTTPLibrary, uaHeadless, uaBot, uaOther}
+
+// classifyUserAgent returns the class of the User-Agent ua: the Class of the
+// first of userAgentRules it matches, or "other" (also for an empty
+// User-Agent).
+func classifyUserAgent(ua string) string {
+	if ua == "" || ua == "-" {
+		return uaOther
+	}
+	ua = strings.ToLower(ua)
+	for _, rule := range userAgentRules {
+		if strings.Contains(ua, rule.Match) {
+			return rule.Class
+		}
+	}
+	return uaOther
+}
+
+// checkUserAgentRules returns an error for a rule of rules without Class or
+// Match.
+func checkUserAgentRules(rules []UserAgentRule) error {
+	for i, rule := range rules {
+		if rule.Class == "" || rule.Match == "" {
+			return fmt.Errorf("UserAgentRules entry %d needs a Class and a Match", i+1)
+		}
+	}
+	return nil
+}
+
+// uaClassFilter is the -ua-class filter: an entry matches if its User-Agent
+// class is one of include (or include is empty) and none of exclude.
+type uaClassFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// newUAClassFilter parses the -ua-class value spec, a comma separated list of
+// classes; classes prefixed with "!" are excluded, e.g. "!search-engine,!monitoring".
+func newUAClassFilter(spec string) (*uaClassFilter, error) {
+	f := &uaClassFilter{include: make(map[string]bool), exclude: make(map[string]bool)}
+	known := make(map[string]bool)
+	for _, class := range userAgentClasses {
+		known[class] = true
+	}
+	for _, rule := range config.UserAgentRules {
+		known[rule.Class] = true
+	}
+	for _, class := range strings.Split(spec, ",") {
+		class = strings.TrimSpace(class)
+		target := f.include
+		if name, ok := strings.CutPrefix(class, "!"); ok {
+			class, target = name, f.exclude
+		}
+		if !known[class] {
+			return nil, fmt.Errorf("unknown User-Agent class %q, use %s", class, strings.Join(knownUAClasses(known), ", "))
+		}
+		target[class] = true
+	}
+	return f, nil
+}
+
+// knownUAClasses returns the names in known, sorted.
+func knownUAClasses(known map[string]bool) []string {
+	classes := make([]string, 0, len(known))
+	for class := range known {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// Matches reports whether the User-Agent class passes f. A nil filter
+// matches everything.
+func (f *uaClassFilter) Matches(class string) bool {
+	if f == nil {
+		return true
+	}
+	return (len(f.include) == 0 || f.include[class]) && !f.exclude[class]
+}
+
+// UAClassesOf counts the requests of each of classes per User-Agent class.
+func (l Log2Analyze) UAClassesOf(classes []string) map[string]map[string]int {
+	counts := make(map[string]map[string]int, len(classes))
+	for _, class := range classes {
+		counts[class] = make(map[string]int)
+	}
+	l.EachEntry(func(entry LogEntry) {
+		if c, ok := counts[entry.Class]; ok {
+			c[entry.UAClass]++
+		}
+	})
+	return counts
+}
+
+// formatUAClasses returns the share of each User-Agent class in counts of
+// total requests, one class per line.
+func formatUAClasses(counts map[string]int, total int) string {
+	var b strings.Builder
+	for _, class := range sortedByCount(counts) {
+		share := 0.0
+		if total > 0 {
+			share = float64(counts[class]) * 100 / float64(total)
+		}
+		b.WriteString(fmt.Sprintf("\t%-16s: %d (%.1f%%)\n", class, counts[class], share))
+	}
+	return b.String()
+}
+
+// formatUAClassMix returns the User-Agent classes of counts with their share,
+// e.g. "browser 90%, http-library 10%".
+func formatUAClassMix(counts map[string]int) string {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	parts := make([]string, 0, len(counts))
+	for _, class := range sortedByCount(counts) {
+		parts = append(parts, fmt.Sprintf("%s %.0f%%", class, float64(counts[class])*100/float64(total)))
+	}
+	return strings.Join(parts, ", ")
+}
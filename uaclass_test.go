@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ──────────────────────────────────────────────
+// classifyUserAgent
+// ──────────────────────────────────────────────
+
+func TestClassifyUserAgent(t *testing.T) {
+	setupTestGlobals()
+	tests := map[string]string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)":                                   uaSearchEngine,
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)":                                    uaSearchEngine,
+		"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.2; +https://openai.com/gptbot)":     uaAIScraper,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Applebot-Extended": uaAIScraper,
+		"Mozilla/5.0 (compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)":                                     uaMonitoring,
+		"check_http/v2.3.3 (monitoring-plugins 2.3.3)":                                                               uaMonitoring,
+		"curl/8.5.0":             uaHTTPLibrary,
+		"python-requests/2.31.0": uaHTTPLibrary,
+		"Go-http-client/1.1":     uaHTTPLibrary,
+		"Mozilla/5.0 (X11; Linux x86_64) HeadlessChrome/120.0.0.0 Safari/537.36":                                          uaHeadless,
+		"Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)":                                              uaBot,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36": uaBrowser,
+		"":              uaOther,
+		"-":             uaOther,
+		"SomethingElse": uaOther,
+	}
+	for ua, want := range tests {
+		if got := classifyUserAgent(ua); got != want {
+			t.Errorf("%q: got %s, want %s", ua, got, want)
+		}
+	}
+}
+
+func TestClassifyUserAgentConfigRules(t *testing.T) {
+	setupTestGlobals()
+	config.UserAgentRules = []UserAgentRule{
+		{Class: "internal", Match: "acme-healthcheck"},
+		{Class: uaMonitoring, Match: "Googlebot-Monitor"},
+	}
+	loadUserAgentRules(config.UserAgentRules)
+	if got := classifyUserAgent("ACME-HealthCheck/1.0"); got != "internal" {
+		t.Errorf("got %s, want internal", got)
+	}
+	// config rules are checked before the built-in ones
+	if got := classifyUserAgent("Googlebot-Monitor/1.0"); got != uaMonitoring {
+		t.Errorf("got %s, want %s", got, uaMonitoring)
+	}
+	if got := classifyUserAgent("curl/8.0"); got != uaHTTPLibrary {
+		t.Errorf("built-in rules should still apply, got %s", got)
+	}
+}
+
+func TestCheckUserAgentRules(t *testing.T) {
+	if err := checkUserAgentRules([]UserAgentRule{{Class: "internal", Match: "acme"}}); err != nil {
+		t.Error(err)
+	}
+	if err := checkUserAgentRules([]UserAgentRule{{Class: "internal"}}); err == nil {
+		t.Error("expected an error for a rule without Match")
+	}
+}
+
+// ──────────────────────────────────────────────
+// uaClassFilter
+// ──────────────────────────────────────────────
+
+func TestUAClassFilter(t *testing.T) {
+	setupTestGlobals()
+	exclude, err := newUAClassFilter("!search-engine, !monitoring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exclude.Matches(uaSearchEngine) || exclude.Matches(uaMonitoring) || !exclude.Matches(uaHTTPLibrary) {
+		t.Error("!search-engine,!monitoring: wrong result")
+	}
+
+	include, err := newUAClassFilter("http-library,headless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !include.Matches(uaHTTPLibrary) || include.Matches(uaBrowser) {
+		t.Error("http-library,headless: wrong result")
+	}
+
+	var none *uaClassFilter
+	if !none.Matches(uaSearchEngine) {
+		t.Error("a nil filter should match everything")
+	}
+}
+
+func TestUAClassFilterUnknownClass(t *testing.T) {
+	setupTestGlobals()
+	if _, err := newUAClassFilter("browser,robots"); err == nil {
+		t.Error("expected an error for an unknown class")
+	}
+	config.UserAgentRules = []UserAgentRule{{Class: "internal", Match: "acme"}}
+	if _, err := newUAClassFilter("!internal"); err != nil {
+		t.Errorf("classes of the config rules should be accepted: %v", err)
+	}
+}
+
+func TestRetrieveEntriesUAClassFilter(t *testing.T) {
+	setupTestGlobals()
+	logContent := `10.0.0.1 - - [10/Feb/2026:12:00:00 +0000] "GET / HTTP/1.1" 200 100 "-" "Mozilla/5.0 (compatible; Googlebot/2.1)"
+10.0.0.2 - - [10/Feb/2026:12:01:00 +0000] "GET / HTTP/1.1" 200 100 "-" "python-requests/2.31"
+10.0.0.2 - - [10/Feb/2026:12:02:00 +0000] "GET / HTTP/1.1" 200 100 "-" "python-requests/2.31"
+`
+	tmpFile := writeTempLogFile(t, logContent)
+	defer os.Remove(tmpFile)
+
+	filter, _ := newUAClassFilter("!search-engine")
+	l := &Log2Analyze{FileName: tmpFile, DateLayout: "02/Jan/2006:15:04:05 -0700", UAClasses: filter}
+	log2Analyze = l
+	l.RetrieveEntries("12:05", 0)
+
+	topIPs, _ := l.GetTopIPs()
+	if len(topIPs) != 1 || topIPs["10.0.0.2"] != 2 {
+		t.Errorf("got %v", topIPs)
+	}
+	if got := l.aggregate().UAClassCount; got[uaHTTPLibrary] != 2 || got[uaSearchEngine] != 0 {
+		t.Errorf("UAClassCount: got %v", got)
+	}
+}
+
+// ──────────────────────────────────────────────
+// breakdown per class
+// ──────────────────────────────────────────────
+
+func TestAggregateUAClassCount(t *testing.T) {
+	setupTestGlobals()
+	a := NewAggregate(0)
+	a.Add(LogEntry{Class: "1.1.1.1", UserAgent: "curl/8.0", UAClass: uaHTTPLibrary})
+	b := NewAggregate(0)
+	b.Add(LogEntry{Class: "1.1.1.1", UserAgent: "curl/7.0", UAClass: uaHTTPLibrary})
+	b.Add(LogEntry{Class: "2.2.2.2", UserAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0", UAClass: uaBrowser})
+	a.Merge(b)
+	if a.UAClassCount[uaHTTPLibrary] != 2 || a.UAClassCount[uaBrowser] != 1 {
+		t.Errorf("got %v", a.UAClassCount)
+	}
+}
+
+func TestUAClassesOf(t *testing.T) {
+	setupTestGlobals()
+	l := Log2Analyze{Entries: []LogEntry{
+		{Class: "1.1.1.1", UserAgent: "curl/8.0", UAClass: uaHTTPLibrary},
+		{Class: "1.1.1.1", UserAgent: "curl/8.0", UAClass: uaHTTPLibrary},
+		{Class: "1.1.1.1", UserAgent: "Mozilla/5.0 (X11) Firefox/120.0", UAClass: uaBrowser},
+		{Class: "1.1.1.1", UserAgent: "Go-http-client/1.1", UAClass: uaHTTPLibrary},
+		{Class: "2.2.2.2", UserAgent: "curl/8.0", UAClass: uaHTTPLibrary},
+	}}
+	counts := l.UAClassesOf([]string{"1.1.1.1"})
+	if len(counts) != 1 || counts["1.1.1.1"][uaHTTPLibrary] != 3 || counts["1.1.1.1"][uaBrowser] != 1 {
+		t.Errorf("got %v", counts)
+	}
+	if got := formatUAClassMix(counts["1.1.1.1"]); got != "http-library 75%, browser 25%" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestFormatUAClasses(t *testing.T) {
+	got := formatUAClasses(map[string]int{uaBrowser: 3, uaBot: 1}, 4)
+	want := "\tbrowser         : 3 (75.0%)\n\tbot             : 1 (25.0%)\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFollowWindowUAClasses(t *testing.T) {
+	setupTestGlobals()
+	now := time.Date(2026, 2, 10, 12, 0, 0, 0, time.UTC)
+	w := newFollowWindow(time.Minute)
+	w.add(LogEntry{Class: "1.1.1.1", UserAgent: "curl/8.0", UAClass: uaHTTPLibrary, TimeStamp: now.Add(-2 * time.Minute)})
+	w.add(LogEntry{Class: "1.1.1.1", UserAgent: "Googlebot/2.1", UAClass: uaSearchEngine, TimeStamp: now})
+	w.evict(now)
+	if len(w.uaClassCount) != 1 || w.uaClassCount[uaSearchEngine] != 1 {
+		t.Errorf("got %v", w.uaClassCount)
+	}
+	var out bytes.Buffer
+	w.render(&out, now, []string{"access_log"})
+	if !strings.Contains(out.String(), "search-engine   : 1 (100.0%)") {
+		t.Errorf("got:\n%s", out.String())
+	}
+}
+
+func TestDashboardUAClass(t *testing.T) {
+	setupTestGlobals()
+	entries := []LogEntry{
+		{Class: "1.1.1.1", UserAgent: "curl/8.0", UAClass: uaHTTPLibrary},
+		{Class: "1.1.1.1", UserAgent: "curl/8.0", UAClass: uaHTTPLibrary},
+		{Class: "1.1.1.1", UserAgent: "Mozilla/5.0 (X11) Firefox/120.0", UAClass: uaBrowser},
+	}
+	data := collectDashboardData("test", func(fn func(LogEntry)) {
+		for _, e := range entries {
+			fn(e)
+		}
+	})
+	if len(data.rows) != 1 || data.rows[0].UAClass != uaHTTPLibrary {
+		t.Errorf("got %+v", data.rows)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Results of a crawler verification.
+const (
+	crawlerVerified = "verified"
+	crawlerSpoofed  = "spoofed"
+	crawlerUnknown  = "unknown"
+)
+
+// dnsWorkers is the number of DNS lookups run in parallel.
+const dnsWorkers = 16
+
+// Resolver looks up the host names of an address and the addresses of a host
+// name. *net.Resolver implements it; tests use a fake.
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// knownCrawler is a search-engine crawler that can be verified by DNS: the
+// reverse lookup of its addresses gives a host name within one of Domains,
+// and the forward lookup of that name gives the address back.
+type knownCrawler struct {
+	Name    string
+	Match   string
+	Domains []string
+}
+
+// knownCrawlers are matched against the User-Agent in order (case
+// insensitive), so more specific names come first.
+var knownCrawlers = []knownCrawler{
+	{"Googlebot", "googlebot", []string{"googlebot.com", "google.com"}},
+	// fetchers triggered by users come from Google App Engine; other
+	// googleusercontent.com hosts are Google Cloud VMs anybody can run
+	{"FeedFetcher-Google", "feedfetcher-google", []string{"gae.googleusercontent.com"}},
+	{"Google-InspectionTool", "google-inspectiontool", []string{"googlebot.com", "google.com"}},
+	{"AdsBot-Google", "adsbot-google", []string{"googlebot.com", "google.com"}},
+	{"Storebot-Google", "storebot-google", []string{"googlebot.com", "google.com"}},
+	{"Bingbot", "bingbot", []string{"search.msn.com"}},
+	{"Applebot", "applebot", []string{"applebot.apple.com"}},
+	{"YandexBot", "yandex", []string{"yandex.ru", "yandex.net", "yandex.com"}},
+	{"Baiduspider", "baiduspider", []string{"baidu.com", "baidu.jp"}},
+	{"Yahoo Slurp", "slurp", []string{"crawl.yahoo.net"}},
+	{"SeznamBot", "seznambot", []string{"seznam.cz"}},
+	{"PetalBot", "petalbot", []string{"petalsearch.com"}},
+	{"Sogou", "sogou", []string{"sogou.com"}},
+}
+
+// claimedCrawler returns the known crawler the User-Agent ua claims to be.
+func claimedCrawler(ua string) (knownCrawler, bool) {
+	ua = strings.ToLower(ua)
+	for _, crawler := range knownCrawlers {
+		if strings.Contains(ua, crawler.Match) {
+			return crawler, true
+		}
+	}
+	return knownCrawler{}, false
+}
+
+// crawlerResult is the verification result of one address.
+type crawlerResult struct {
+	Status string
+	Host   string
+}
+
+// crawlerVerifier verifies claimed crawlers by a reverse and a confirming
+// forward DNS lookup. Each lookup is limited to timeout; the results are
+// cached per address and crawler, so an address is looked up only once.
+type crawlerVerifier struct {
+	resolver Resolver
+	timeout  time.Duration
+	mu       sync.Mutex
+	cache    map[string]crawlerResult
+}
+
+// newCrawlerVerifier returns a verifier using resolver.
+func newCrawlerVerifier(resolver Resolver, timeout time.Duration) *crawlerVerifier {
+	return &crawlerVerifier{resolver: resolver, timeout: timeout, cache: make(map[string]crawlerResult)}
+}
+
+// Verify reports whether ip belongs to crawler: verified if its host name is
+// within the domains of crawler and resolves back to ip, spoofed if not, and
+// unknown if a lookup failed (e.g. a timeout).
+func (v *crawlerVerifier) Verify(ip string, crawler knownCrawler) crawlerResult {
+	key := crawler.Name + " " + ip
+	v.mu.Lock()
+	result, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok {
+		return result
+	}
+	result = v.lookup(ip, crawler)
+	v.mu.Lock()
+	v.cache[key] = result
+	v.mu.Unlock()
+	return result
+}
+
+// lookup does the DNS lookups of Verify.
+func (v *crawlerVerifier) lookup(ip string, crawler knownCrawler) crawlerResult {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return crawlerResult{Status: crawlerSpoofed}
+	}
+	addr = addr.Unmap()
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+	names, err := v.resolver.LookupAddr(ctx, addr.String())
+	if err != nil {
+		return crawlerResult{Status: lookupFailure(err)}
+	}
+	result := crawlerResult{Status: crawlerSpoofed}
+	for _, name := range names {
+		host := strings.ToLower(strings.TrimSuffix(name, "."))
+		if result.Host == "" {
+			result.Host = host
+		}
+		if !inDomains(host, crawler.Domains) {
+			continue
+		}
+		result.Host = host
+		addrs, err := v.resolver.LookupHost(ctx, host)
+		if err != nil {
+			if result.Status = lookupFailure(err); result.Status == crawlerUnknown {
+				return result
+			}
+			continue
+		}
+		for _, a := range addrs {
+			if resolved, err := netip.ParseAddr(a); err == nil && resolved.Unmap() == addr {
+				result.Status = crawlerVerified
+				return result
+			}
+		}
+	}
+	return result
+}
+
+// lookupFailure returns the result of a failed lookup: spoofed if the name
+// or address does not exist, since the crawlers always have both, and
+// unknown for any other error.
+func lookupFailure(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return crawlerSpoofed
+	}
+	return crawlerUnknown
+}
+
+// inDomains reports whether host is one of domains or a subdomain of one.
+func inDomains(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// CrawlerCheck is the verification result of a class whose requests claim to
+// come from Crawler. Status is spoofed if any of its addresses is spoofed,
+// unknown if any could not be checked, and verified otherwise. Host is the
+// host name of the first address found for that status; Addresses is the
+// number of addresses checked.
+type CrawlerCheck struct {
+	Crawler   string
+	Status    string
+	Host      string
+	Addresses int
+}
+
+// crawlerStatusRank orders the results of the addresses of a class; the
+// highest one decides.
+var crawlerStatusRank = map[string]int{crawlerVerified: 0, crawlerUnknown: 1, crawlerSpoofed: 2}
+
+// VerifyCrawlers verifies the addresses of classes whose requests claim a
+// known crawler in the User-Agent. Classes without such requests are not in
+// the result.
+func (l Log2Analyze) VerifyCrawlers(classes []string, v *crawlerVerifier) map[string]CrawlerCheck {
+	type claim struct {
+		class, ip string
+		crawler   knownCrawler
+	}
+	wanted := make(map[string]bool, len(classes))
+	for _, class := range classes {
+		wanted[class] = true
+	}
+	seen := make(map[string]bool)
+	var claims []claim
+	l.EachEntry(func(entry LogEntry) {
+		if !wanted[entry.Class] {
+			return
+		}
+		crawler, ok := claimedCrawler(entry.UserAgent)
+		key := entry.Class + " " + entry.IP + " " + crawler.Name
+		if ok && !seen[key] {
+			seen[key] = true
+			claims = append(claims, claim{entry.Class, entry.IP, crawler})
+		}
+	})
+
+	results := make([]crawlerResult, len(claims))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, dnsWorkers)
+	for i, c := range claims {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, c claim) {
+			defer wg.Done()
+			results[i] = v.Verify(c.ip, c.crawler)
+			<-sem
+		}(i, c)
+	}
+	wg.Wait()
+
+	checks := make(map[string]CrawlerCheck)
+	for i, c := range claims {
+		check, ok := checks[c.class]
+		if !ok {
+			check = CrawlerCheck{Crawler: c.crawler.Name, Status: crawlerVerified}
+		}
+		check.Addresses++
+		if r := results[i]; !ok || crawlerStatusRank[r.Status] > crawlerStatusRank[check.Status] {
+			check.Status, check.Host = r.Status, r.Host
+		}
+		checks[c.class] = check
+	}
+	return checks
+}
+
+// formatCrawlerChecks lists the checks of classes, one per line.
+func formatCrawlerChecks(classes []string, checks map[string]CrawlerCheck) string {
+	var b strings.Builder
+	for _, class := range classes {
+		check, ok := checks[class]
+		if !ok {
+			continue
+		}
+		host := check.Host
+		if host == "" {
+			host = "no host name"
+		}
+		b.WriteString(fmt.Sprintf("\t%s\t: %s %s (%s, %d addresses)\n", class, check.Crawler, check.Status, host, check.Addresses))
+	}
+	return b.String()
+}
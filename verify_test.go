@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver answers from fixed tables and counts the lookups. Missing
+// entries fail with a not-found error, addresses in fail with a timeout.
+type fakeResolver struct {
+	mu      sync.Mutex
+	ptr     map[string][]string
+	hosts   map[string][]string
+	fail    map[string]bool
+	lookups int
+}
+
+func (r *fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	if r.fail[addr] {
+		return nil, &net.DNSError{Err: "i/o timeout", Name: addr, IsTimeout: true}
+	}
+	if names, ok := r.ptr[addr]; ok {
+		return names, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// newFakeResolver returns a resolver knowing a real Googlebot (IPv4 and
+// IPv6), an address whose PTR claims googlebot.com without a matching
+// forward record, a Google Cloud VM and an address outside of Google.
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{
+		ptr: map[string][]string{
+			"66.249.66.1":          {"crawl-66-249-66-1.googlebot.com."},
+			"2001:4860:4801:10::1": {"crawl-2001-4860-4801-10--1.googlebot.com."},
+			"203.0.113.7":          {"crawl-66-249-66-1.googlebot.com."},
+			"198.51.100.9":         {"host9.example.net."},
+			"34.66.1.2":            {"2.1.66.34.bc.googleusercontent.com."},
+		},
+		hosts: map[string][]string{
+			"crawl-66-249-66-1.googlebot.com":          {"66.249.66.1"},
+			"crawl-2001-4860-4801-10--1.googlebot.com": {"2001:4860:4801:10::1"},
+			"2.1.66.34.bc.googleusercontent.com":       {"34.66.1.2"},
+		},
+		fail: map[string]bool{"192.0.2.50": true},
+	}
+}
+
+var googlebot, _ = claimedCrawler("Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
+
+// ──────────────────────────────────────────────
+// claimedCrawler / inDomains
+// ──────────────────────────────────────────────
+
+func TestClaimedCrawler(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)": "Bingbot",
+		"Mozilla/5.0 (compatible; YandexBot/3.0; +http://yandex.com/bots)":        "YandexBot",
+		"Mozilla/5.0 (compatible; Googlebot/2.1)":                                 "Googlebot",
+	}
+	for ua, want := range tests {
+		if crawler, ok := claimedCrawler(ua); !ok || crawler.Name != want {
+			t.Errorf("%q: got %q, %v", ua, crawler.Name, ok)
+		}
+	}
+	if _, ok := claimedCrawler("curl/8.0"); ok {
+		t.Error("curl should not claim a crawler")
+	}
+}
+
+func TestInDomains(t *testing.T) {
+	domains := []string{"googlebot.com"}
+	if !inDomains("crawl-1.googlebot.com", domains) || !inDomains("googlebot.com", domains) {
+		t.Error("googlebot.com and its subdomains should match")
+	}
+	if inDomains("evilgooglebot.com", domains) || inDomains("googlebot.com.evil.net", domains) {
+		t.Error("look-alike domains should not match")
+	}
+}
+
+// ──────────────────────────────────────────────
+// crawlerVerifier
+// ──────────────────────────────────────────────
+
+func TestCrawlerVerifierVerify(t *testing.T) {
+	v := newCrawlerVerifier(newFakeResolver(), time.Second)
+	tests := map[string]string{
+		"66.249.66.1":          crawlerVerified,
+		"::ffff:66.249.66.1":   crawlerVerified,
+		"2001:4860:4801:10::1": crawlerVerified,
+		"203.0.113.7":          crawlerSpoofed, // PTR claims googlebot.com, forward does not match
+		"198.51.100.9":         crawlerSpoofed, // PTR outside of the Google domains
+		"34.66.1.2":            crawlerSpoofed, // Google Cloud VM, forward-confirmed
+		"198.51.100.10":        crawlerSpoofed, // no PTR record
+		"192.0.2.50":           crawlerUnknown, // timeout
+		"-":                    crawlerSpoofed,
+	}
+	for ip, want := range tests {
+		if got := v.Verify(ip, googlebot); got.Status != want {
+			t.Errorf("%s: got %+v, want %s", ip, got, want)
+		}
+	}
+	if got := v.Verify("66.249.66.1", googlebot); got.Host != "crawl-66-249-66-1.googlebot.com" {
+		t.Errorf("host: got %q", got.Host)
+	}
+}
+
+func TestCrawlerVerifierCache(t *testing.T) {
+	r := newFakeResolver()
+	v := newCrawlerVerifier(r, time.Second)
+	v.Verify("66.249.66.1", googlebot)
+	lookups := r.lookups
+	v.Verify("66.249.66.1", googlebot)
+	if r.lookups != lookups {
+		t.Errorf("the second verification should be cached, got %d lookups after %d", r.lookups, lookups)
+	}
+}
+
+// slowResolver blocks until the context expires.
+type slowResolver struct{}
+
+func (slowResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (slowResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCrawlerVerifierTimeout(t *testing.T) {
+	v := newCrawlerVerifier(slowResolver{}, 20*time.Millisecond)
+	start := time.Now()
+	got := v.Verify("66.249.66.1", googlebot)
+	if got.Status != crawlerUnknown || time.Since(start) > time.Second {
+		t.Errorf("got %+v after %v", got, time.Since(start))
+	}
+}
+
+func TestLookupFailure(t *testing.T) {
+	if lookupFailure(&net.DNSError{IsNotFound: true}) != crawlerSpoofed {
+		t.Error("not found should be spoofed")
+	}
+	if lookupFailure(errors.New("connection refused")) != crawlerUnknown {
+		t.Error("other errors should be unknown")
+	}
+}
+
+// ──────────────────────────────────────────────
+// VerifyCrawlers / report
+// ──────────────────────────────────────────────
+
+func TestVerifyCrawlers(t *testing.T) {
+	setupTestGlobals()
+	googleUA := "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	l := Log2Analyze{Entries: []LogEntry{
+		{IP: "66.249.66.1", Class: "66.249.66.1", UserAgent: googleUA},
+		{IP: "66.249.66.1", Class: "66.249.66.1", UserAgent: googleUA},
+		{IP: "203.0.113.7", Class: "203.0.113.0/24", UserAgent: googleUA},
+		{IP: "203.0.113.8", Class: "203.0.113.0/24", UserAgent: "curl/8.0"},
+		{IP: "66.249.66.1", Class: "66.249.66.0/24", UserAgent: googleUA},
+		{IP: "192.0.2.50", Class: "66.249.66.0/24", UserAgent: googleUA},
+		{IP: "198.51.100.1", Class: "198.51.100.1", UserAgent: "Mozilla/5.0 (X11) Firefox/120.0"},
+		{IP: "66.249.66.1", Class: "not-top", UserAgent: googleUA},
+	}}
+	r := newFakeResolver()
+	checks := l.VerifyCrawlers([]string{"66.249.66.1", "203.0.113.0/24", "66.249.66.0/24", "198.51.100.1"}, newCrawlerVerifier(r, time.Second))
+
+	want := map[string]CrawlerCheck{
+		"66.249.66.1":    {Crawler: "Googlebot", Status: crawlerVerified, Host: "crawl-66-249-66-1.googlebot.com", Addresses: 1},
+		"203.0.113.0/24": {Crawler: "Googlebot", Status: crawlerSpoofed, Host: "crawl-66-249-66-1.googlebot.com", Addresses: 1},
+		"66.249.66.0/24": {Crawler: "Googlebot", Status: crawlerUnknown, Addresses: 2},
+	}
+	if len(checks) != len(want) {
+		t.Errorf("got %+v", checks)
+	}
+	for class, w := range want {
+		if checks[class] != w {
+			t.Errorf("%s: got %+v, want %+v", class, checks[class], w)
+		}
+	}
+
+	out := formatCrawlerChecks([]string{"203.0.113.0/24", "198.51.100.1"}, checks)
+	if out != "\t203.0.113.0/24\t: Googlebot spoofed (crawl-66-249-66-1.googlebot.com, 1 addresses)\n" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestReportAddCrawlerChecks(t *testing.T) {
+	report := buildTestReport()
+	report.AddCrawlerChecks(map[string]CrawlerCheck{"2.2.2.2": {Crawler: "Bingbot", Status: crawlerSpoofed, Addresses: 1}})
+	var b strings.Builder
+	if err := report.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `"crawler": {
+        "name": "Bingbot",
+        "status": "spoofed",
+        "addresses": 1
+      }`) {
+		t.Errorf("got:\n%s", b.String())
+	}
+	if report.TopClasses[0].Crawler != nil {
+		t.Error("1.1.1.1 should not be marked")
+	}
+}